@@ -0,0 +1,46 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appsignals
+
+import (
+	"istio.io/pkg/log"
+)
+
+// ReopenLogs reopens the rotating log files whenever a notification is triggered, e.g. by SIGUSR1 or a
+// FileTrigger. This lets external logrotate setups move the files away and signal the process to create
+// them anew. It returns a function that stops reopening the files.
+func ReopenLogs() (stop func()) {
+	c := make(chan Signal, 1)
+	Watch(c)
+
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case s := <-c:
+				if err := log.Reopen(); err != nil {
+					log.Warnf("Unable to reopen log files (trigger: %q, signal: %v): %v", s.Source, s.Signal, err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		unwatch(c)
+		close(done)
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appsignals
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"istio.io/pkg/log"
+)
+
+func TestReopenLogs(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "rot.log")
+	o := log.DefaultOptions()
+	o.OutputPaths = []string{}
+	o.RotateOutputPath = file
+	if err := log.Configure(o); err != nil {
+		t.Fatalf("Unable to configure logging: %v", err)
+	}
+	defer func() {
+		_ = log.Configure(log.DefaultOptions())
+	}()
+
+	stop := ReopenLogs()
+	defer stop()
+
+	log.Info("before")
+	if err := os.Rename(file, file+".1"); err != nil {
+		t.Fatal(err)
+	}
+	Notify("logrotate", syscall.SIGUSR1)
+
+	// the files are reopened in the background, so keep logging until a new file appears
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		log.Info("after")
+		if content, err := os.ReadFile(file); err == nil {
+			if !strings.Contains(string(content), "after") || strings.Contains(string(content), "before") {
+				t.Errorf("Got %s, expecting only the messages after reopening", content)
+			}
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("timed out waiting for the log file to be reopened")
+}
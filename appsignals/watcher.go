@@ -56,6 +56,19 @@ func Watch(c chan<- Signal) {
 	handlers.listeners = append(handlers.listeners, c)
 }
 
+// unwatch stops notifying a channel passed to Watch.
+func unwatch(c chan<- Signal) {
+	handlers.Lock()
+	defer handlers.Unlock()
+
+	for i, v := range handlers.listeners {
+		if v == c {
+			handlers.listeners = append(handlers.listeners[:i], handlers.listeners[i+1:]...)
+			return
+		}
+	}
+}
+
 // Directly trigger a notification
 func Notify(trigger string, signal os.Signal) {
 	handlers.Lock()
@@ -19,6 +19,8 @@ import (
 	"fmt"
 	"net/http"
 	"sort"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 
@@ -35,6 +37,16 @@ type scopeInfo struct {
 	OutputLevel     string `json:"output_level"`
 	StackTraceLevel string `json:"stack_trace_level"`
 	LogCallers      bool   `json:"log_callers"`
+	Sampling        string `json:"sampling,omitempty"`
+	DedupWindow     string `json:"dedup_window,omitempty"`
+
+	// rules enabling a lower level for messages with matching labels, in the form of
+	// <level>:<key>=<value>&<key>=<value>
+	LevelRules []string `json:"level_rules,omitempty"`
+
+	// set while the output level is temporarily overridden
+	OverrideExpires string `json:"override_expires,omitempty"`
+	RevertLevel     string `json:"revert_level,omitempty"`
 }
 
 var levelToString = map[log.Level]string{
@@ -67,13 +79,27 @@ func (scopeTopic) Prefix() string {
 }
 
 func getScopeInfo(s *log.Scope) *scopeInfo {
-	return &scopeInfo{
+	info := &scopeInfo{
 		Name:            s.Name(),
 		Description:     s.Description(),
 		OutputLevel:     levelToString[s.GetOutputLevel()],
 		StackTraceLevel: levelToString[s.GetStackTraceLevel()],
 		LogCallers:      s.GetLogCallers(),
 	}
+	if sampling := s.GetSampling(); sampling.Enabled() {
+		info.Sampling = sampling.String()
+	}
+	if window := s.GetDedupWindow(); window > 0 {
+		info.DedupWindow = window.String()
+	}
+	for _, r := range s.GetLevelRules() {
+		info.LevelRules = append(info.LevelRules, r.String())
+	}
+	if o, ok := s.GetLevelOverride(); ok {
+		info.OverrideExpires = o.Expires.UTC().Format(time.RFC3339)
+		info.RevertLevel = levelToString[o.Previous]
+	}
+	return info
 }
 
 func (scopeTopic) Activate(context fw.TopicContext) {
@@ -95,6 +121,7 @@ func (scopeTopic) Activate(context fw.TopicContext) {
 	_ = context.JSONRouter().StrictSlash(true).NewRoute().Methods("GET").Path("/").HandlerFunc(getAllScopes)
 	_ = context.JSONRouter().NewRoute().Methods("GET").Path("/{scope}").HandlerFunc(getScope)
 	_ = context.JSONRouter().NewRoute().Methods("PUT").Path("/{scope}").HandlerFunc(putScope)
+	_ = context.JSONRouter().NewRoute().Methods("DELETE").Path("/{scope}/override").HandlerFunc(deleteOverride)
 }
 
 func getAllScopes(w http.ResponseWriter, _ *http.Request) {
@@ -120,6 +147,16 @@ func getScope(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	// patterns select any number of scopes
+	if strings.Contains(name, "*") {
+		scopeInfos := make([]scopeInfo, 0)
+		for _, s := range log.MatchScopes(name) {
+			scopeInfos = append(scopeInfos, *getScopeInfo(s))
+		}
+		fw.RenderJSON(w, http.StatusOK, scopeInfos)
+		return
+	}
+
 	fw.RenderError(w, http.StatusBadRequest, fmt.Errorf("unknown scope name: %s", name))
 }
 
@@ -127,15 +164,69 @@ func putScope(w http.ResponseWriter, req *http.Request) {
 	vars := mux.Vars(req)
 	name := vars["scope"]
 
+	// a duration makes a change of the output level temporary
+	var duration time.Duration
+	if d := req.URL.Query().Get("duration"); d != "" {
+		var err error
+		if duration, err = time.ParseDuration(d); err != nil || duration <= 0 {
+			fw.RenderError(w, http.StatusBadRequest, fmt.Errorf("invalid duration: %s", d))
+			return
+		}
+	}
+
 	var info scopeInfo
 	if err := json.NewDecoder(req.Body).Decode(&info); err != nil {
 		fw.RenderError(w, http.StatusBadRequest, fmt.Errorf("unable to decode request: %v", err))
 		return
 	}
 
-	if s := log.FindScope(name); s != nil {
+	var sampling log.Sampling
+	if info.Sampling != "" {
+		var err error
+		if sampling, err = log.ParseSampling(info.Sampling); err != nil {
+			fw.RenderError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	// a window of 0 disables deduplication
+	var dedupWindow time.Duration
+	if info.DedupWindow != "" {
+		var err error
+		if dedupWindow, err = time.ParseDuration(info.DedupWindow); err != nil || dedupWindow < 0 {
+			fw.RenderError(w, http.StatusBadRequest, fmt.Errorf("invalid deduplication window: %s", info.DedupWindow))
+			return
+		}
+	}
+
+	// level rules are only replaced when given, and an empty list removes them
+	var rules []log.LevelRule
+	for _, r := range info.LevelRules {
+		rule, err := log.ParseLevelRule(r)
+		if err != nil {
+			fw.RenderError(w, http.StatusBadRequest, err)
+			return
+		}
+		rules = append(rules, rule)
+	}
+
+	// a pattern such as xds.* updates every scope it selects, and a name updates the scope and its
+	// descendants, like the settings of Configure. Names must be registered, as for GET.
+	var matched []*log.Scope
+	if strings.Contains(name, "*") || log.FindScope(name) != nil {
+		matched = log.MatchScopes(name)
+	}
+	if len(matched) == 0 {
+		fw.RenderError(w, http.StatusBadRequest, fmt.Errorf("unknown scope name: %s", name))
+		return
+	}
+
+	for _, s := range matched {
 		level, ok := stringToLevel[info.OutputLevel]
-		if ok {
+		if ok && duration > 0 {
+			s.SetOutputLevelFor(level, duration)
+		} else if ok && level != s.GetOutputLevel() {
+			// leave any temporary override in place when the level is unchanged
 			s.SetOutputLevel(level)
 		}
 
@@ -144,10 +235,34 @@ func putScope(w http.ResponseWriter, req *http.Request) {
 			s.SetStackTraceLevel(level)
 		}
 
+		if info.Sampling != "" {
+			s.SetSampling(sampling)
+		}
+
+		if info.DedupWindow != "" && dedupWindow != s.GetDedupWindow() {
+			s.SetDedupWindow(dedupWindow)
+		}
+
+		if info.LevelRules != nil {
+			s.SetLevelRules(rules)
+		}
+
 		s.SetLogCallers(info.LogCallers)
-		w.WriteHeader(http.StatusAccepted)
-		return
 	}
+	w.WriteHeader(http.StatusAccepted)
+}
 
-	fw.RenderError(w, http.StatusBadRequest, fmt.Errorf("unknown scope name: %s", name))
+func deleteOverride(w http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	name := vars["scope"]
+
+	if log.FindScope(name) == nil {
+		fw.RenderError(w, http.StatusBadRequest, fmt.Errorf("unknown scope name: %s", name))
+		return
+	}
+	if !log.CancelLevelOverride(name) {
+		fw.RenderError(w, http.StatusNotFound, fmt.Errorf("no output level override for scope: %s", name))
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
 }
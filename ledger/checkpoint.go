@@ -0,0 +1,129 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ledger
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// checkpointDomain separates checkpoint signatures from any other use of the same key.
+const checkpointDomain = "istio.io/pkg/ledger checkpoint v1"
+
+// Checkpoint is a signed statement that the ledger's root hash was Root at Timestamp, and that
+// the root hash immediately before it was Previous. A sequence of checkpoints in which each
+// Previous matches the Root of the checkpoint before it forms a hash chain of the ledger's history.
+type Checkpoint struct {
+	// Root is the root hash of the ledger, as returned by RootHash.
+	Root string `json:"root"`
+	// Previous is the root hash that Root replaced. It is empty for the first root of an empty ledger.
+	Previous string `json:"previous"`
+	// Timestamp is the time at which Root was produced.
+	Timestamp time.Time `json:"timestamp"`
+	// Signature is the ed25519 signature over Root, Previous and Timestamp.
+	Signature []byte `json:"signature"`
+}
+
+// message returns the bytes covered by the checkpoint's signature.
+func (c Checkpoint) message() []byte {
+	var buf bytes.Buffer
+	buf.WriteString(checkpointDomain)
+	for _, field := range []string{c.Root, c.Previous} {
+		_ = binary.Write(&buf, binary.BigEndian, uint32(len(field)))
+		buf.WriteString(field)
+	}
+	_ = binary.Write(&buf, binary.BigEndian, c.Timestamp.UnixNano())
+	return buf.Bytes()
+}
+
+// Verify reports whether the checkpoint was signed by the private key matching pub.
+func (c Checkpoint) Verify(pub ed25519.PublicKey) bool {
+	return len(pub) == ed25519.PublicKeySize && ed25519.Verify(pub, c.message(), c.Signature)
+}
+
+// VerifyCheckpoints validates a chain of checkpoints produced by a ledger created with MakeSigned.
+// Every checkpoint must carry a valid signature from pub, link to the root of the checkpoint before
+// it, and not be older than its predecessor. The chain may start at any point in the ledger's history.
+func VerifyCheckpoints(pub ed25519.PublicKey, checkpoints []Checkpoint) error {
+	if len(pub) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid ed25519 public key length %d", len(pub))
+	}
+	for i, c := range checkpoints {
+		if !c.Verify(pub) {
+			return fmt.Errorf("checkpoint %d (root %q) has an invalid signature", i, c.Root)
+		}
+		if i == 0 {
+			continue
+		}
+		prev := checkpoints[i-1]
+		if c.Previous != prev.Root {
+			return fmt.Errorf("checkpoint %d (root %q) does not follow root %q", i, c.Root, prev.Root)
+		}
+		if c.Timestamp.Before(prev.Timestamp) {
+			return fmt.Errorf("checkpoint %d (root %q) is older than its predecessor", i, c.Root)
+		}
+	}
+	return nil
+}
+
+// signer produces a checkpoint for every new root of a ledger.
+type signer struct {
+	// mu serializes tree updates with signing, so checkpoints are produced in root order.
+	mu           sync.Mutex
+	key          ed25519.PrivateKey
+	last         Checkpoint
+	onCheckpoint func(Checkpoint)
+	now          func() time.Time
+}
+
+func newSigner(key ed25519.PrivateKey, onCheckpoint func(Checkpoint)) (*signer, error) {
+	if len(key) != ed25519.PrivateKeySize {
+		return nil, errors.New("invalid ed25519 private key")
+	}
+	return &signer{
+		key:          key,
+		onCheckpoint: onCheckpoint,
+		now:          time.Now,
+	}, nil
+}
+
+// sign records a checkpoint for root, unless root is unchanged. The caller must hold s.mu.
+func (s *signer) sign(root string) {
+	if root == s.last.Root {
+		return
+	}
+	c := Checkpoint{
+		Root:      root,
+		Previous:  s.last.Root,
+		Timestamp: s.now().UTC(),
+	}
+	c.Signature = ed25519.Sign(s.key, c.message())
+	s.last = c
+	if s.onCheckpoint != nil {
+		s.onCheckpoint(c)
+	}
+}
+
+// latest returns the most recent checkpoint.
+func (s *signer) latest() Checkpoint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.last
+}
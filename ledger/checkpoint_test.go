@@ -0,0 +1,118 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ledger
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func makeSignedLedger(t *testing.T) (SignedLedger, ed25519.PublicKey, *[]Checkpoint) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	assert.NilError(t, err)
+	var chain []Checkpoint
+	l, err := MakeSigned(time.Minute, priv, func(c Checkpoint) {
+		chain = append(chain, c)
+	})
+	assert.NilError(t, err)
+	return l, pub, &chain
+}
+
+func TestSignedCheckpoints(t *testing.T) {
+	l, pub, chain := makeSignedLedger(t)
+	_, err := l.Put("foo", "bar")
+	assert.NilError(t, err)
+	_, err = l.Put("second", "value")
+	assert.NilError(t, err)
+	// an unchanged root does not produce a new checkpoint
+	_, err = l.Put("second", "value")
+	assert.NilError(t, err)
+	_, err = l.Put("foo", "baz")
+	assert.NilError(t, err)
+
+	assert.Equal(t, len(*chain), 3)
+	assert.Equal(t, (*chain)[0].Previous, "")
+	assert.DeepEqual(t, l.LatestCheckpoint(), (*chain)[2])
+	assert.Equal(t, l.LatestCheckpoint().Root, l.RootHash())
+	assert.NilError(t, VerifyCheckpoints(pub, *chain))
+
+	// a chain persisted as JSON verifies offline
+	b, err := json.Marshal(*chain)
+	assert.NilError(t, err)
+	var decoded []Checkpoint
+	assert.NilError(t, json.Unmarshal(b, &decoded))
+	assert.NilError(t, VerifyCheckpoints(pub, decoded))
+
+	// a suffix of the chain is still valid
+	assert.NilError(t, VerifyCheckpoints(pub, (*chain)[1:]))
+}
+
+func TestVerifyCheckpointsDetectsTampering(t *testing.T) {
+	l, pub, chain := makeSignedLedger(t)
+	for _, k := range []string{"a", "b", "c"} {
+		_, err := l.Put(k, k)
+		assert.NilError(t, err)
+	}
+	otherPub, _, err := ed25519.GenerateKey(rand.Reader)
+	assert.NilError(t, err)
+
+	cases := []struct {
+		name   string
+		pub    ed25519.PublicKey
+		mutate func(c []Checkpoint) []Checkpoint
+	}{
+		{"wrong key", otherPub, func(c []Checkpoint) []Checkpoint { return c }},
+		{"invalid key", pub[:4], func(c []Checkpoint) []Checkpoint { return c }},
+		{"edited root", pub, func(c []Checkpoint) []Checkpoint {
+			c[1].Root = c[0].Root
+			return c
+		}},
+		{"edited timestamp", pub, func(c []Checkpoint) []Checkpoint {
+			c[2].Timestamp = c[2].Timestamp.Add(time.Hour)
+			return c
+		}},
+		{"removed checkpoint", pub, func(c []Checkpoint) []Checkpoint {
+			return append(c[:1], c[2:]...)
+		}},
+		{"reordered", pub, func(c []Checkpoint) []Checkpoint {
+			c[1], c[2] = c[2], c[1]
+			return c
+		}},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			c := append([]Checkpoint(nil), *chain...)
+			assert.Assert(t, VerifyCheckpoints(tt.pub, tt.mutate(c)) != nil)
+		})
+	}
+}
+
+func TestMakeSignedInvalidKey(t *testing.T) {
+	_, err := MakeSigned(time.Minute, ed25519.PrivateKey{1, 2, 3}, nil)
+	assert.ErrorContains(t, err, "invalid ed25519 private key")
+}
+
+func TestUnsignedLedgerCheckpoint(t *testing.T) {
+	l := smtLedger{tree: newSMT(hasher, nil, time.Minute)}
+	_, err := l.Put("foo", "bar")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, l.LatestCheckpoint(), Checkpoint{})
+}
@@ -19,7 +19,9 @@
 package ledger
 
 import (
+	"crypto/ed25519"
 	"encoding/base64"
+	"io"
 	"time"
 
 	"github.com/spaolacci/murmur3"
@@ -40,10 +42,21 @@ type Ledger interface {
 	RootHash() string
 	// GetPreviousValue executes a get against a previous version of the ledger, using that version's root hash.
 	GetPreviousValue(previousRootHash, key string) (result string, err error)
+	// Export writes the state of the ledger at rootHash to w, so it can be loaded with Import.
+	Export(w io.Writer, rootHash string) error
+}
+
+// SignedLedger is a Ledger which signs every new root hash, see MakeSigned.
+type SignedLedger interface {
+	Ledger
+	// LatestCheckpoint returns the signed checkpoint of the current root hash.
+	LatestCheckpoint() Checkpoint
 }
 
 type smtLedger struct {
 	tree *smt
+	// signer is nil unless the ledger was created with MakeSigned.
+	signer *signer
 }
 
 // Make returns a Ledger which will retain previous nodes after they are deleted.
@@ -51,20 +64,56 @@ func Make(retention time.Duration) Ledger {
 	return smtLedger{tree: newSMT(hasher, nil, retention)}
 }
 
+// MakeSigned returns a Ledger like Make, which additionally signs every new root hash with key.
+// Each Checkpoint is passed to onCheckpoint, if not nil, in the order the roots were produced, so
+// that callers may persist the chain for later verification with VerifyCheckpoints.
+// onCheckpoint is called synchronously and must not call back into the ledger.
+func MakeSigned(retention time.Duration, key ed25519.PrivateKey, onCheckpoint func(Checkpoint)) (SignedLedger, error) {
+	sig, err := newSigner(key, onCheckpoint)
+	if err != nil {
+		return nil, err
+	}
+	return smtLedger{tree: newSMT(hasher, nil, retention), signer: sig}, nil
+}
+
 // Put adds a key value pair to the ledger, overwriting previous values and marking them for
 // removal after the retention specified in Make()
 func (s smtLedger) Put(key, value string) (result string, err error) {
-	b, err := s.tree.Update([][]byte{coerceKeyToHashLen(key)}, [][]byte{coerceToHashLen(value)})
+	b, err := s.update([][]byte{coerceKeyToHashLen(key)}, [][]byte{coerceToHashLen(value)})
 	result = string(b)
 	return
 }
 
 // Delete removes a key value pair from the ledger, marking it for removal after the retention specified in Make()
 func (s smtLedger) Delete(key string) (err error) {
-	_, err = s.tree.Update([][]byte{[]byte(key)}, [][]byte{defaultLeaf})
+	_, err = s.update([][]byte{[]byte(key)}, [][]byte{defaultLeaf})
 	return
 }
 
+// update applies keys and values to the tree, signing the resulting root if the ledger is signed.
+func (s smtLedger) update(keys, values [][]byte) ([]byte, error) {
+	if s.signer == nil {
+		return s.tree.Update(keys, values)
+	}
+	s.signer.mu.Lock()
+	defer s.signer.mu.Unlock()
+	b, err := s.tree.Update(keys, values)
+	if err != nil {
+		return nil, err
+	}
+	s.signer.sign(base64.StdEncoding.EncodeToString(b))
+	return b, nil
+}
+
+// LatestCheckpoint returns the checkpoint of the current root hash, or the zero Checkpoint if the
+// ledger is not signed or has not changed since it was created.
+func (s smtLedger) LatestCheckpoint() Checkpoint {
+	if s.signer == nil {
+		return Checkpoint{}
+	}
+	return s.signer.latest()
+}
+
 // GetPreviousValue returns the value of key when the ledger's RootHash was previousHash, if it is still retained.
 func (s smtLedger) GetPreviousValue(previousRootHash, key string) (result string, err error) {
 	prevBytes, err := base64.StdEncoding.DecodeString(previousRootHash)
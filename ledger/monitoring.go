@@ -0,0 +1,88 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ledger
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"istio.io/pkg/monitoring"
+)
+
+// nodeCount is the number of nodes held by a ledger.
+type nodeCount struct {
+	n atomic.Int64
+}
+
+// nodeCounts holds the nodeCount of each ledger using the default cache, as keys. Ledgers remove their count
+// when they are collected, so that the ledger_nodes gauge only sums the nodes of live ledgers.
+var nodeCounts sync.Map
+
+// liveNodes returns the number of nodes currently held by all ledgers in the process.
+func liveNodes() int64 {
+	var total int64
+	nodeCounts.Range(func(key, _ any) bool {
+		total += key.(*nodeCount).n.Load()
+		return true
+	})
+	return total
+}
+
+var (
+	nodesCreated = monitoring.NewSum(
+		"ledger_nodes_created_total",
+		"Total number of tree nodes stored by ledgers.",
+	)
+
+	nodesExpired = monitoring.NewSum(
+		"ledger_nodes_expired_total",
+		"Total number of tree nodes deleted by ledgers after their retention period.",
+	)
+
+	updateDuration = monitoring.NewDistribution(
+		"ledger_update_duration_seconds",
+		"Duration of ledger tree updates.",
+		[]float64{.0001, .0005, .001, .005, .01, .05, .1, .5, 1},
+		monitoring.WithUnit(monitoring.Seconds),
+	)
+
+	updateBatchSize = monitoring.NewDistribution(
+		"ledger_update_batch_size",
+		"Number of keys written by each ledger tree update.",
+		[]float64{1, 2, 5, 10, 50, 100, 500, 1000},
+	)
+
+	previousValueMisses = monitoring.NewSum(
+		"ledger_previous_value_misses_total",
+		"Total number of ledger reads that failed because the requested root is no longer retained.",
+	)
+)
+
+func init() {
+	monitoring.NewDerivedGauge(
+		"ledger_nodes",
+		"Number of tree nodes currently held by ledgers using the default cache, including nodes retained for previous roots.",
+		monitoring.WithValueFrom(func() float64 {
+			return float64(liveNodes())
+		}),
+	)
+	monitoring.MustRegister(
+		nodesCreated,
+		nodesExpired,
+		updateDuration,
+		updateBatchSize,
+		previousValueMisses,
+	)
+}
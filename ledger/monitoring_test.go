@@ -0,0 +1,97 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ledger
+
+import (
+	"runtime"
+	"testing"
+	"time"
+
+	"go.opencensus.io/stats/view"
+	"gotest.tools/v3/assert"
+)
+
+func TestLiveNodes(t *testing.T) {
+	smt := newSMT(hasher, nil, time.Millisecond)
+	smt.atomicUpdate = false
+	keys := getFreshData(10)
+	ch := make(chan result, 1)
+	smt.update(smt.root, keys, getFreshData(10), nil, 0, smt.trieHeight, false, true, ch)
+	root := (<-ch).update
+	created := smt.nodes.n.Load()
+	assert.Assert(t, created > 0)
+	assert.Assert(t, liveNodes() >= created)
+
+	// replacing every value marks the previous nodes for expiration after the retention period
+	smt.update(root, keys, getFreshData(10), nil, 0, smt.trieHeight, false, true, ch)
+	<-ch
+	assert.Assert(t, smt.nodes.n.Load() > created)
+	time.Sleep(10 * time.Millisecond)
+	smt.db.updatedNodes.cache.EvictExpired()
+	assert.Equal(t, smt.nodes.n.Load(), created)
+
+	_, err := smt.GetPreviousValue(root, keys[0])
+	assert.ErrorContains(t, err, "is unavailable")
+}
+
+func TestLiveNodesExpiredSetAgain(t *testing.T) {
+	smt := newSMT(hasher, nil, time.Millisecond)
+	var node hash
+	copy(node[:], hasher([]byte("node")))
+	smt.setNode(node, [][]byte{[]byte("value")})
+	smt.deleteOldNode(node[:])
+
+	// setting the node again after it expired, but before its eviction, keeps it once
+	time.Sleep(10 * time.Millisecond)
+	smt.setNode(node, [][]byte{[]byte("value")})
+	smt.db.updatedNodes.cache.EvictExpired()
+	assert.Equal(t, smt.nodes.n.Load(), int64(1))
+}
+
+func TestLiveNodesDiscardedLedger(t *testing.T) {
+	nodes := func() *nodeCount {
+		l := Make(time.Minute)
+		_, err := l.Put("foo", "bar")
+		assert.NilError(t, err)
+		return l.(smtLedger).tree.nodes
+	}()
+	assert.Assert(t, nodes.n.Load() > 0)
+
+	// the nodes of a discarded ledger are no longer counted once it is collected
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		runtime.GC()
+		if _, ok := nodeCounts.Load(nodes); !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the discarded ledger to be collected")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestUpdateMetrics(t *testing.T) {
+	l := Make(time.Minute)
+	_, err := l.Put("foo", "bar")
+	assert.NilError(t, err)
+
+	for _, name := range []string{"ledger_update_duration_seconds", "ledger_update_batch_size"} {
+		rows, err := view.RetrieveData(name)
+		assert.NilError(t, err)
+		assert.Equal(t, len(rows), 1)
+		assert.Assert(t, rows[0].Data.(*view.DistributionData).Count > 0)
+	}
+}
@@ -17,6 +17,7 @@ package ledger
 import (
 	"bytes"
 	"fmt"
+	"runtime"
 	"sync"
 	"time"
 
@@ -72,6 +73,8 @@ type smt struct {
 	lock sync.RWMutex
 	// atomicUpdate, commit all the changes made by intermediate update calls
 	atomicUpdate bool
+	// nodes counts the nodes in the default cache, and is nil for other caches, which don't report evictions.
+	nodes *nodeCount
 }
 
 // this is the closest time.Duration comes to Forever, with a duration of ~145 years
@@ -81,19 +84,33 @@ const forever time.Duration = 1<<(63-1) - 1
 
 // newSMT creates a new smt given a keySize, hash function, cache (nil will be defaulted to TTLCache), and retention
 // duration for old nodes.
+// Only the nodes of the default cache are reported in the ledger metrics.
 func newSMT(hash func(data ...[]byte) []byte, updateCache cache.ExpiringCache, retentionDuration time.Duration) *smt {
+	var nodes *nodeCount
 	if updateCache == nil {
-		updateCache = cache.NewTTL(forever, time.Second)
+		nodes = &nodeCount{}
+		updateCache = cache.NewTTLWithCallback(forever, time.Second, func(key, value any) {
+			nodes.n.Add(-1)
+			nodesExpired.Increment()
+		})
 	}
 	s := &smt{
 		hash:              hash,
 		trieHeight:        len(hash([]byte("height"))) * 8, // hash any string to get output length
 		retentionDuration: retentionDuration,
+		nodes:             nodes,
 	}
 	s.db = &cacheDB{
 		updatedNodes: byteCache{cache: updateCache},
 	}
 	s.loadDefaultHashes()
+	if nodes != nil {
+		// the cache and its callback only hold the count, so the finalizer runs once the ledger is discarded
+		nodeCounts.Store(nodes, struct{}{})
+		runtime.SetFinalizer(s, func(*smt) {
+			nodeCounts.Delete(nodes)
+		})
+	}
 	return s
 }
 
@@ -123,6 +140,10 @@ func (s *smt) loadDefaultHashes() {
 func (s *smt) Update(keys, values [][]byte) ([]byte, error) {
 	s.lock.Lock()
 	defer s.lock.Unlock()
+	defer func(start time.Time) {
+		updateDuration.Record(time.Since(start).Seconds())
+	}(time.Now())
+	updateBatchSize.RecordInt(int64(len(keys)))
 	s.atomicUpdate = true
 	ch := make(chan result, 1)
 	s.update(s.Root(), keys, values, nil, 0, s.trieHeight, false, true, ch)
@@ -415,13 +436,25 @@ func (s *smt) storeNode(batch [][]byte, h, oldRoot []byte) {
 		var node hash
 		copy(node[:], h)
 		// record new node
-		s.db.updatedMux.Lock()
-		s.db.updatedNodes.Set(node, batch)
-		s.db.updatedMux.Unlock()
+		s.setNode(node, batch)
 		s.deleteOldNode(oldRoot)
 	}
 }
 
+// setNode stores a batch in the cache without expiration, counting it if it is a new node. The default cache
+// returns expired nodes until they are evicted, so a node set again before its eviction is not counted twice.
+func (s *smt) setNode(node hash, batch [][]byte) {
+	s.db.updatedMux.Lock()
+	defer s.db.updatedMux.Unlock()
+	if _, exists := s.db.updatedNodes.Get(node); !exists {
+		if s.nodes != nil {
+			s.nodes.n.Add(1)
+		}
+		nodesCreated.Increment()
+	}
+	s.db.updatedNodes.Set(node, batch)
+}
+
 // deleteOldNode deletes an old node that has been updated
 func (s *smt) deleteOldNode(root []byte) {
 	var node hash
@@ -28,7 +28,12 @@ func (s *smt) GetPreviousValue(prevRoot []byte, key []byte) ([]byte, error) {
 	s.lock.RLock()
 	defer s.lock.RUnlock()
 	s.atomicUpdate = false
-	return s.get(prevRoot, key, nil, 0, s.trieHeight)
+	value, err := s.get(prevRoot, key, nil, 0, s.trieHeight)
+	if err != nil {
+		// the only failure is a missing node, meaning prevRoot has expired
+		previousValueMisses.Increment()
+	}
+	return value, err
 }
 
 // get fetches the value of a key given a trie root
@@ -58,6 +63,49 @@ func (s *smt) get(root []byte, key []byte, batch [][]byte, iBatch, height int) (
 	return s.get(lnode, key, batch, 2*iBatch+1, height-1)
 }
 
+// walk calls fn for every batch node reachable from root, visiting each node once.
+func (s *smt) walk(root []byte, fn func(key hash, batch [][]byte) error) error {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	s.atomicUpdate = false
+	return s.walkNode(root, nil, 0, s.trieHeight, map[hash]struct{}{}, fn)
+}
+
+// walkNode visits the subtree below root, mirroring the traversal of get.
+func (s *smt) walkNode(root []byte, batch [][]byte, iBatch, height int, seen map[hash]struct{},
+	fn func(key hash, batch [][]byte) error,
+) error {
+	if len(root) == 0 || height == 0 {
+		return nil
+	}
+	if height%4 == 0 {
+		var node hash
+		copy(node[:], root)
+		if _, ok := seen[node]; ok {
+			return nil
+		}
+		seen[node] = struct{}{}
+	}
+	batch, iBatch, lnode, rnode, isShortcut, err := s.loadChildren(root, height, iBatch, batch)
+	if err != nil {
+		return err
+	}
+	if height%4 == 0 {
+		var node hash
+		copy(node[:], root)
+		if err := fn(node, batch); err != nil {
+			return err
+		}
+	}
+	if isShortcut {
+		return nil
+	}
+	if err := s.walkNode(lnode, batch, 2*iBatch+1, height-1, seen, fn); err != nil {
+		return err
+	}
+	return s.walkNode(rnode, batch, 2*iBatch+2, height-1, seen, fn)
+}
+
 // DefaultHash is a getter for the defaultHashes array
 func (s *smt) DefaultHash(height int) []byte {
 	return s.defaultHashes[height]
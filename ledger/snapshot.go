@@ -0,0 +1,160 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ledger
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// snapshotMagic identifies a ledger snapshot stream and its format version.
+const snapshotMagic = "ISTLDG01"
+
+const (
+	recordEnd  byte = 0
+	recordNode byte = 1
+)
+
+// maxSnapshotEntry bounds the size of a single node entry read from a snapshot, so a corrupt
+// stream cannot force a large allocation. Entries are at most a hash plus a flag byte.
+const maxSnapshotEntry = 2 * hashLength
+
+// A snapshot stream is laid out as:
+//
+//	magic | uvarint(len(root)) | root | node records... | recordEnd
+//
+// where each node record is:
+//
+//	recordNode | key (hashLength bytes) | uvarint(batchLen) | (uvarint(len(entry)) | entry)...
+
+// Export writes every node reachable from rootHash to w, in a form that Import can load into a new
+// Ledger. rootHash may be the current RootHash or any previous root hash that is still retained.
+func (s smtLedger) Export(w io.Writer, rootHash string) error {
+	root, err := base64.StdEncoding.DecodeString(rootHash)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	_, _ = bw.WriteString(snapshotMagic)
+	writeBytes(bw, root)
+	err = s.tree.walk(root, func(key hash, batch [][]byte) error {
+		_ = bw.WriteByte(recordNode)
+		_, _ = bw.Write(key[:])
+		writeUvarint(bw, uint64(len(batch)))
+		for _, entry := range batch {
+			writeBytes(bw, entry)
+		}
+		// bufio.Writer errors are sticky and reported by the final Flush
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	_ = bw.WriteByte(recordEnd)
+	return bw.Flush()
+}
+
+// Import reads a snapshot written by Export and returns a new Ledger whose RootHash is the root
+// hash that was exported. Nodes of the snapshot are retained as described in Make().
+func Import(r io.Reader, retention time.Duration) (Ledger, error) {
+	br := bufio.NewReader(r)
+	magic := make([]byte, len(snapshotMagic))
+	if _, err := io.ReadFull(br, magic); err != nil {
+		return nil, fmt.Errorf("failed to read snapshot header: %v", err)
+	}
+	if string(magic) != snapshotMagic {
+		return nil, errors.New("not a ledger snapshot")
+	}
+	root, err := readBytes(br)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot root: %v", err)
+	}
+	tree := newSMT(hasher, nil, retention)
+	for {
+		kind, err := br.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read snapshot record: %v", err)
+		}
+		if kind == recordEnd {
+			break
+		}
+		if kind != recordNode {
+			return nil, fmt.Errorf("unknown snapshot record type %d", kind)
+		}
+		var key hash
+		if _, err := io.ReadFull(br, key[:]); err != nil {
+			return nil, fmt.Errorf("failed to read snapshot node: %v", err)
+		}
+		n, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read snapshot node %x: %v", key, err)
+		}
+		if n != uint64(batchLen) {
+			return nil, fmt.Errorf("snapshot node %x has %d entries, expected %d", key, n, batchLen)
+		}
+		batch := make([][]byte, batchLen)
+		for i := range batch {
+			if batch[i], err = readBytes(br); err != nil {
+				return nil, fmt.Errorf("failed to read snapshot node %x: %v", key, err)
+			}
+		}
+		tree.setNode(key, batch)
+	}
+	if len(root) != 0 {
+		if len(root) < hashLength {
+			return nil, fmt.Errorf("invalid snapshot root %x", root)
+		}
+		tree.root = root[:hashLength]
+	}
+	// make sure the snapshot is complete before handing out the ledger
+	if err := tree.walk(tree.root, func(hash, [][]byte) error { return nil }); err != nil {
+		return nil, fmt.Errorf("incomplete snapshot: %v", err)
+	}
+	return smtLedger{tree: tree}, nil
+}
+
+func writeUvarint(w *bufio.Writer, v uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], v)
+	_, _ = w.Write(buf[:n])
+}
+
+func writeBytes(w *bufio.Writer, b []byte) {
+	writeUvarint(w, uint64(len(b)))
+	_, _ = w.Write(b)
+}
+
+func readBytes(r *bufio.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, nil
+	}
+	if n > maxSnapshotEntry {
+		return nil, fmt.Errorf("entry length %d exceeds maximum of %d", n, maxSnapshotEntry)
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
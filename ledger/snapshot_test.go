@@ -0,0 +1,102 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ledger
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestExportImport(t *testing.T) {
+	l := Make(time.Minute)
+	for i := 0; i < 200; i++ {
+		_, err := l.Put(fmt.Sprintf("key-%d", i), fmt.Sprintf("v%d", i))
+		assert.NilError(t, err)
+	}
+	var buf bytes.Buffer
+	assert.NilError(t, l.Export(&buf, l.RootHash()))
+
+	imported, err := Import(&buf, time.Minute)
+	assert.NilError(t, err)
+	assert.Equal(t, imported.RootHash(), l.RootHash())
+	for i := 0; i < 200; i++ {
+		v, err := imported.Get(fmt.Sprintf("key-%d", i))
+		assert.NilError(t, err)
+		assert.Equal(t, v, fmt.Sprintf("v%d", i))
+	}
+
+	// the imported ledger continues to evolve identically to the original
+	_, err = l.Put("key-7", "changed")
+	assert.NilError(t, err)
+	_, err = imported.Put("key-7", "changed")
+	assert.NilError(t, err)
+	assert.Equal(t, imported.RootHash(), l.RootHash())
+}
+
+func TestExportPreviousRoot(t *testing.T) {
+	l := Make(time.Minute)
+	_, err := l.Put("foo", "bar")
+	assert.NilError(t, err)
+	_, err = l.Put("second", "value")
+	assert.NilError(t, err)
+	first := l.RootHash()
+	_, err = l.Put("foo", "baz")
+	assert.NilError(t, err)
+
+	var buf bytes.Buffer
+	assert.NilError(t, l.Export(&buf, first))
+	imported, err := Import(&buf, time.Minute)
+	assert.NilError(t, err)
+	assert.Equal(t, imported.RootHash(), first)
+	v, err := imported.Get("foo")
+	assert.NilError(t, err)
+	assert.Equal(t, v, "bar")
+}
+
+func TestExportImportEmpty(t *testing.T) {
+	l := Make(time.Minute)
+	var buf bytes.Buffer
+	assert.NilError(t, l.Export(&buf, l.RootHash()))
+	imported, err := Import(&buf, time.Minute)
+	assert.NilError(t, err)
+	assert.Equal(t, imported.RootHash(), l.RootHash())
+}
+
+func TestImportInvalid(t *testing.T) {
+	l := Make(time.Minute)
+	for i := 0; i < 50; i++ {
+		_, err := l.Put(fmt.Sprintf("key-%d", i), "v")
+		assert.NilError(t, err)
+	}
+	var buf bytes.Buffer
+	assert.NilError(t, l.Export(&buf, l.RootHash()))
+	snapshot := buf.Bytes()
+
+	_, err := Import(bytes.NewReader([]byte("not a snapshot")), time.Minute)
+	assert.ErrorContains(t, err, "not a ledger snapshot")
+	_, err = Import(bytes.NewReader(snapshot[:len(snapshot)/2]), time.Minute)
+	assert.Assert(t, err != nil)
+
+	// a snapshot without any of the nodes below its root is rejected
+	header := len(snapshotMagic) + 1 + hashLength
+	truncated := append([]byte{}, snapshot[:header]...)
+	truncated = append(truncated, recordEnd)
+	_, err = Import(bytes.NewReader(truncated), time.Minute)
+	assert.ErrorContains(t, err, "incomplete snapshot")
+}
@@ -0,0 +1,262 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// AsyncFullPolicy selects what happens to log messages when the queue of the asynchronous writer is full.
+type AsyncFullPolicy int
+
+const (
+	// AsyncBlock makes log calls wait for room in the queue, so that no message is lost. Messages logged by
+	// the outputs while they write, which would wait for themselves, are written right away instead.
+	AsyncBlock AsyncFullPolicy = iota
+	// AsyncDropLowestLevel discards the oldest queued message of the lowest level to make room for a
+	// message of a higher level. A message whose level isn't higher than any queued one is discarded.
+	AsyncDropLowestLevel
+	// AsyncDropNewest discards the messages that do not fit in the queue.
+	AsyncDropNewest
+)
+
+const defaultAsyncQueueSize = 4096
+
+// AsyncOptions configures the asynchronous writing of log messages. Zero values select the defaults.
+type AsyncOptions struct {
+	// QueueSize is the number of messages held while waiting to be written. It defaults to 4096.
+	QueueSize int
+
+	// FullPolicy selects what happens when the queue is full. It defaults to AsyncBlock.
+	FullPolicy AsyncFullPolicy
+}
+
+// asyncEntry is a queued log message, along with the core that writes it.
+type asyncEntry struct {
+	core   zapcore.Core
+	entry  zapcore.Entry
+	fields []zapcore.Field
+}
+
+// asyncWriter writes log messages from a background goroutine, so that log calls don't wait for slow
+// outputs. It is shared by all cores of a configuration.
+type asyncWriter struct {
+	opts    AsyncOptions
+	errSink zapcore.WriteSyncer
+
+	mu    sync.Mutex
+	cond  *sync.Cond
+	queue []asyncEntry
+	// busy is set while the background goroutine writes a message taken from the queue.
+	busy bool
+	// drainer is the id of the background goroutine, whose log calls must not wait for it.
+	drainer uint64
+	closed  bool
+	done    chan struct{}
+}
+
+func newAsyncWriter(opts AsyncOptions, errSink zapcore.WriteSyncer) *asyncWriter {
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = defaultAsyncQueueSize
+	}
+	w := &asyncWriter{
+		opts:    opts,
+		errSink: errSink,
+		done:    make(chan struct{}),
+	}
+	w.cond = sync.NewCond(&w.mu)
+	go w.run()
+	return w
+}
+
+func (w *asyncWriter) run() {
+	defer close(w.done)
+	w.mu.Lock()
+	w.drainer = goroutineID()
+	w.mu.Unlock()
+	for {
+		w.mu.Lock()
+		for len(w.queue) == 0 && !w.closed {
+			w.cond.Wait()
+		}
+		if len(w.queue) == 0 {
+			w.mu.Unlock()
+			return
+		}
+		e := w.queue[0]
+		w.queue[0] = asyncEntry{}
+		w.queue = w.queue[1:]
+		w.busy = true
+		// wake up writers waiting for room
+		w.cond.Broadcast()
+		w.mu.Unlock()
+
+		w.write(e)
+
+		w.mu.Lock()
+		w.busy = false
+		// wake up flushes waiting for the queue to drain
+		w.cond.Broadcast()
+		w.mu.Unlock()
+	}
+}
+
+func (w *asyncWriter) write(e asyncEntry) {
+	if err := e.core.Write(e.entry, e.fields); err != nil {
+		_, _ = fmt.Fprintf(w.errSink, "%v log write error: %v\n", time.Now(), err)
+		_ = w.errSink.Sync()
+	}
+}
+
+// enqueue adds a message to the queue, applying the full policy if there is no room. Messages are written
+// synchronously once the writer is closed.
+func (w *asyncWriter) enqueue(e asyncEntry) {
+	w.mu.Lock()
+	for !w.closed && len(w.queue) >= w.opts.QueueSize {
+		switch w.opts.FullPolicy {
+		case AsyncDropNewest:
+			w.mu.Unlock()
+			asyncMessagesDropped.With(levelTag.Value(e.entry.Level.String())).Increment()
+			return
+		case AsyncDropLowestLevel:
+			if !w.dropLowerLevel(e.entry.Level) {
+				w.mu.Unlock()
+				asyncMessagesDropped.With(levelTag.Value(e.entry.Level.String())).Increment()
+				return
+			}
+		default:
+			if w.draining() {
+				// the sinks log from the background goroutine, which would wait for itself
+				w.mu.Unlock()
+				w.write(e)
+				return
+			}
+			w.cond.Wait()
+		}
+	}
+	if w.closed {
+		w.mu.Unlock()
+		w.write(e)
+		return
+	}
+	w.queue = append(w.queue, e)
+	w.cond.Broadcast()
+	w.mu.Unlock()
+}
+
+// dropLowerLevel discards the oldest queued message of the lowest level, if it is lower than l. It must be
+// called with the lock held.
+func (w *asyncWriter) dropLowerLevel(l zapcore.Level) bool {
+	lowest := -1
+	for i, e := range w.queue {
+		if e.entry.Level < l && (lowest < 0 || e.entry.Level < w.queue[lowest].entry.Level) {
+			lowest = i
+		}
+	}
+	if lowest < 0 {
+		return false
+	}
+	asyncMessagesDropped.With(levelTag.Value(w.queue[lowest].entry.Level.String())).Increment()
+	w.queue = append(w.queue[:lowest], w.queue[lowest+1:]...)
+	return true
+}
+
+// flush waits until all queued messages were written.
+func (w *asyncWriter) flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for len(w.queue) > 0 || w.busy {
+		if w.draining() {
+			// the queue can't drain while its background goroutine waits
+			return
+		}
+		w.cond.Wait()
+	}
+}
+
+// draining returns whether the caller is the background goroutine, writing a message. It must be called
+// with the lock held, and only when the caller would otherwise wait, as it is slow.
+func (w *asyncWriter) draining() bool {
+	return w.busy && goroutineID() == w.drainer
+}
+
+// goroutineID returns the id of the calling goroutine, read from the header of its stack trace.
+func goroutineID() uint64 {
+	var buf [64]byte
+	b := bytes.TrimPrefix(buf[:runtime.Stack(buf[:], false)], []byte("goroutine "))
+	if i := bytes.IndexByte(b, ' '); i >= 0 {
+		b = b[:i]
+	}
+	id, _ := strconv.ParseUint(string(b), 10, 64)
+	return id
+}
+
+// close writes the queued messages and stops the background goroutine.
+func (w *asyncWriter) close() error {
+	w.mu.Lock()
+	w.closed = true
+	w.cond.Broadcast()
+	w.mu.Unlock()
+	<-w.done
+	return nil
+}
+
+// asyncCore queues entries to be written to a core by an asyncWriter.
+type asyncCore struct {
+	zapcore.Core
+	writer *asyncWriter
+}
+
+func newAsyncCore(core zapcore.Core, writer *asyncWriter) zapcore.Core {
+	return &asyncCore{Core: core, writer: writer}
+}
+
+// With implements zapcore.Core.
+func (ac *asyncCore) With(fields []zapcore.Field) zapcore.Core {
+	return &asyncCore{Core: ac.Core.With(fields), writer: ac.writer}
+}
+
+// Check implements zapcore.Core.
+func (ac *asyncCore) Check(e zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if ac.Enabled(e.Level) {
+		return ce.AddCore(e, ac)
+	}
+	return ce
+}
+
+// Write implements zapcore.Core. Entries above the error level are written synchronously after the queued
+// ones, as the process may terminate right after logging them.
+func (ac *asyncCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	if entry.Level > zapcore.ErrorLevel {
+		ac.writer.flush()
+		return ac.Core.Write(entry, fields)
+	}
+	// the fields are retained after the call returns
+	ac.writer.enqueue(asyncEntry{core: ac.Core, entry: entry, fields: append([]zapcore.Field(nil), fields...)})
+	return nil
+}
+
+// Sync implements zapcore.Core. It waits for the queued entries to be written before syncing the core.
+func (ac *asyncCore) Sync() error {
+	ac.writer.flush()
+	return ac.Core.Sync()
+}
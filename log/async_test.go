@@ -0,0 +1,223 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// gatedSyncer records the messages written to it, blocking writes until it is opened.
+type gatedSyncer struct {
+	started chan struct{}
+	gate    chan struct{}
+	once    sync.Once
+
+	mu       sync.Mutex
+	messages []string
+}
+
+func newGatedSyncer() *gatedSyncer {
+	return &gatedSyncer{started: make(chan struct{}), gate: make(chan struct{})}
+}
+
+func (g *gatedSyncer) Write(p []byte) (int, error) {
+	g.once.Do(func() { close(g.started) })
+	<-g.gate
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.messages = append(g.messages, strings.TrimSpace(string(p)))
+	return len(p), nil
+}
+
+func (g *gatedSyncer) Sync() error {
+	return nil
+}
+
+func (g *gatedSyncer) written() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]string(nil), g.messages...)
+}
+
+func TestAsyncFullPolicies(t *testing.T) {
+	encoderConfig := zapcore.EncoderConfig{MessageKey: "msg"}
+	entry := func(l zapcore.Level, msg string) zapcore.Entry {
+		return zapcore.Entry{Level: l, Message: msg}
+	}
+
+	cases := []struct {
+		name   string
+		policy AsyncFullPolicy
+		extra  []zapcore.Entry
+		want   []string
+	}{
+		{
+			name:   "drop newest",
+			policy: AsyncDropNewest,
+			extra:  []zapcore.Entry{entry(zapcore.ErrorLevel, "e")},
+			want:   []string{"first", "d", "i"},
+		},
+		{
+			name:   "drop lowest level",
+			policy: AsyncDropLowestLevel,
+			extra:  []zapcore.Entry{entry(zapcore.WarnLevel, "w"), entry(zapcore.DebugLevel, "d2"), entry(zapcore.ErrorLevel, "e")},
+			want:   []string{"first", "w", "e"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			g := newGatedSyncer()
+			w := newAsyncWriter(AsyncOptions{QueueSize: 2, FullPolicy: c.policy}, zapcore.AddSync(os.Stderr))
+			core := newAsyncCore(zapcore.NewCore(zapcore.NewConsoleEncoder(encoderConfig), g, zapcore.DebugLevel), w)
+
+			// the background goroutine blocks on the first message, so that the next ones fill the queue
+			_ = core.Write(entry(zapcore.InfoLevel, "first"), nil)
+			<-g.started
+			_ = core.Write(entry(zapcore.DebugLevel, "d"), nil)
+			_ = core.Write(entry(zapcore.InfoLevel, "i"), nil)
+			for _, e := range c.extra {
+				_ = core.Write(e, nil)
+			}
+
+			close(g.gate)
+			_ = core.Sync()
+			if got := strings.Join(g.written(), ","); got != strings.Join(c.want, ",") {
+				t.Errorf("Got %s, expecting %s", got, strings.Join(c.want, ","))
+			}
+			_ = w.close()
+		})
+	}
+}
+
+func TestAsyncBlock(t *testing.T) {
+	g := newGatedSyncer()
+	w := newAsyncWriter(AsyncOptions{QueueSize: 1}, zapcore.AddSync(os.Stderr))
+	core := newAsyncCore(zapcore.NewCore(zapcore.NewConsoleEncoder(zapcore.EncoderConfig{MessageKey: "msg"}), g, zapcore.DebugLevel), w)
+
+	_ = core.Write(zapcore.Entry{Message: "1"}, nil)
+	<-g.started
+	_ = core.Write(zapcore.Entry{Message: "2"}, nil)
+
+	done := make(chan struct{})
+	go func() {
+		_ = core.Write(zapcore.Entry{Message: "3"}, nil)
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("Got write to a full queue returning, expecting it to block")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(g.gate)
+	<-done
+	_ = w.close()
+	if got := strings.Join(g.written(), ","); got != "1,2,3" {
+		t.Errorf("Got %s, expecting 1,2,3", got)
+	}
+}
+
+// reentrantCore logs a message through the asynchronous core while writing each entry, like sinks reporting
+// their own failures, then syncs it.
+type reentrantCore struct {
+	zapcore.Core
+	async zapcore.Core
+}
+
+func (rc *reentrantCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	if !strings.HasPrefix(entry.Message, "nested") {
+		for i := 0; i < 3; i++ {
+			_ = rc.async.Write(zapcore.Entry{Message: "nested " + entry.Message}, nil)
+		}
+		_ = rc.async.Sync()
+	}
+	return rc.Core.Write(entry, fields)
+}
+
+func TestAsyncBlockReentrant(t *testing.T) {
+	g := newGatedSyncer()
+	close(g.gate)
+	w := newAsyncWriter(AsyncOptions{QueueSize: 1}, zapcore.AddSync(os.Stderr))
+	rc := &reentrantCore{Core: zapcore.NewCore(zapcore.NewConsoleEncoder(zapcore.EncoderConfig{MessageKey: "msg"}), g, zapcore.DebugLevel)}
+	rc.async = newAsyncCore(rc, w)
+
+	done := make(chan struct{})
+	go func() {
+		_ = rc.async.Write(zapcore.Entry{Message: "1"}, nil)
+		_ = rc.async.Sync()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expecting messages logged while writing not to wait for the background goroutine")
+	}
+	_ = w.close()
+	if got := len(g.written()); got != 4 {
+		t.Errorf("Got %d messages, expecting 4", got)
+	}
+}
+
+func TestAsyncConfigure(t *testing.T) {
+	resetGlobals()
+	dir := t.TempDir()
+	file := dir + "/async.log"
+
+	o := DefaultOptions()
+	o.OutputPaths = []string{file}
+	o.WithAsync(AsyncOptions{})
+	if err := Configure(o); err != nil {
+		t.Fatalf("Unable to configure logging: %v", err)
+	}
+
+	// the queued messages are written before the process exits
+	var atExit string
+	pt := funcs.Load().(patchTable)
+	pt.exitProcess = func(_ int) {
+		content, _ := os.ReadFile(file)
+		atExit = string(content)
+	}
+	funcs.Store(pt)
+
+	for i := 0; i < 100; i++ {
+		Info("queued")
+	}
+	Fatal("fatal")
+
+	if n := strings.Count(atExit, "queued"); n != 100 {
+		t.Errorf("Got %d queued messages at exit, expecting 100", n)
+	}
+	if !strings.Contains(atExit, "fatal") {
+		t.Errorf("Expecting the fatal message to be written before exiting, got %s", atExit)
+	}
+
+	Info("after")
+	_ = Close()
+	content, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("Got failure '%v', expecting success", err)
+	}
+	if !strings.Contains(string(content), "after") {
+		t.Errorf("Expecting the queue to be flushed on close, got %s", content)
+	}
+	_ = Configure(DefaultOptions())
+}
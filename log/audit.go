@@ -0,0 +1,297 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// The audit log records actions, such as mutating admin requests, in a file of its own. Unlike the output
+// of scopes, entries are never sampled or dropped: they are written synchronously, and failures are
+// returned to the caller.
+//
+// Each line of the file holds an entry along with its HMAC-SHA256 under a key provided by the caller, and
+// each entry holds the MAC of the previous one. Without the key, editing, removing or reordering entries
+// breaks the chain, which VerifyAuditLog detects. The key must thus be kept from whoever can write to the
+// file. Removing entries from the end of the file can only be detected against an AuditHead recorded
+// elsewhere.
+
+// AuditEntry is an entry of the audit log.
+type AuditEntry struct {
+	// Seq numbers the entries of the file, starting at 1.
+	Seq      uint64         `json:"seq"`
+	Time     time.Time      `json:"time"`
+	Action   string         `json:"action"`
+	Labels   map[string]any `json:"labels,omitempty"`
+	PrevHash string         `json:"prev_hash"`
+}
+
+// auditLine is a line of the audit file. The hash is the HMAC of the encoded entry.
+type auditLine struct {
+	Hash  string          `json:"hash"`
+	Entry json.RawMessage `json:"entry"`
+}
+
+// AuditHead identifies the last entry of an audit log.
+type AuditHead struct {
+	Seq  uint64
+	Hash string
+}
+
+// AuditOptions configures an AuditLogger.
+type AuditOptions struct {
+	// Path is the path of the audit file. Entries are appended to an existing file.
+	Path string
+
+	// Key authenticates the entries. It is required, and the same key must be given to VerifyAuditLog.
+	Key []byte
+
+	// SyncEvery is the number of entries written between syncs of the file to stable storage. Entries are
+	// synced individually by default.
+	SyncEvery int
+}
+
+// auditFile is the file written by an AuditLogger.
+type auditFile interface {
+	io.WriteCloser
+	Truncate(size int64) error
+	Sync() error
+}
+
+// AuditLogger writes entries to a hash-chained audit file.
+type AuditLogger struct {
+	syncEvery int
+	key       []byte
+
+	mu       sync.Mutex
+	f        auditFile
+	head     AuditHead
+	unsynced int
+	// size is the size of the file up to the last entry written in full.
+	size int64
+	// broken is set once a failed write can't be undone, and fails all later entries.
+	broken error
+}
+
+// NewAuditLogger opens the audit file of the given options. The hash chain of an existing file is verified
+// first, as appending to a broken chain would hide the tampering.
+func NewAuditLogger(options AuditOptions) (*AuditLogger, error) {
+	if options.Path == "" {
+		return nil, errors.New("audit log path is required")
+	}
+	if len(options.Key) == 0 {
+		return nil, errors.New("audit log key is required")
+	}
+
+	head, err := VerifyAuditLog(options.Path, options.Key, AuditHead{})
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(options.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open audit log: %v", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("unable to open audit log: %v", err)
+	}
+
+	syncEvery := options.SyncEvery
+	if syncEvery < 1 {
+		syncEvery = 1
+	}
+	return &AuditLogger{syncEvery: syncEvery, key: options.Key, f: f, head: head, size: info.Size()}, nil
+}
+
+// Log appends an entry for action to the audit file, with labels given as key-value pairs like WithLabels.
+// It returns once the entry was written, and synced if due. If syncing fails the entry was still written,
+// so it must not be logged again: the logger is broken instead, failing all later entries, as the file
+// may have lost entries it reported as written.
+func (a *AuditLogger) Log(action string, kvlist ...any) error {
+	if len(kvlist)%2 != 0 {
+		return fmt.Errorf("even number of parameters required, got %d", len(kvlist))
+	}
+	var labels map[string]any
+	if len(kvlist) > 0 {
+		labels = make(map[string]any, len(kvlist)/2)
+		for i := 0; i < len(kvlist); i += 2 {
+			key, ok := kvlist[i].(string)
+			if !ok {
+				return fmt.Errorf("label name %v must be a string, got %T", kvlist[i], kvlist[i])
+			}
+			labels[key] = kvlist[i+1]
+		}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.f == nil {
+		return errors.New("audit log is closed")
+	}
+	if a.broken != nil {
+		return a.broken
+	}
+
+	entry, err := json.Marshal(AuditEntry{
+		Seq:      a.head.Seq + 1,
+		Time:     time.Now().UTC(),
+		Action:   action,
+		Labels:   labels,
+		PrevHash: a.head.Hash,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to encode audit entry: %v", err)
+	}
+	hash := auditHash(a.key, entry)
+	line, err := json.Marshal(auditLine{Hash: hash, Entry: entry})
+	if err != nil {
+		return fmt.Errorf("unable to encode audit entry: %v", err)
+	}
+
+	line = append(line, '\n')
+	if _, err := a.f.Write(line); err != nil {
+		// remove any partial line, which would break the file for later entries
+		if terr := a.f.Truncate(a.size); terr != nil {
+			a.broken = fmt.Errorf("audit log is broken by a partial entry: %v", terr)
+		}
+		return fmt.Errorf("unable to write audit entry: %v", err)
+	}
+	a.size += int64(len(line))
+	a.head = AuditHead{Seq: a.head.Seq + 1, Hash: hash}
+
+	a.unsynced++
+	if a.unsynced >= a.syncEvery {
+		return a.syncLocked()
+	}
+	return nil
+}
+
+// Head returns the sequence number and hash of the last entry. Recording it outside of the audit file
+// allows VerifyAuditLog to detect the removal of later entries.
+func (a *AuditLogger) Head() AuditHead {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.head
+}
+
+// Sync commits the entries written so far to stable storage.
+func (a *AuditLogger) Sync() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.f == nil {
+		return nil
+	}
+	return a.syncLocked()
+}
+
+func (a *AuditLogger) syncLocked() error {
+	if a.unsynced == 0 {
+		return nil
+	}
+	if err := a.f.Sync(); err != nil {
+		a.broken = fmt.Errorf("audit log is broken by a failed sync: %v", err)
+		return fmt.Errorf("unable to sync audit log up to entry %d: %v", a.head.Seq, err)
+	}
+	a.unsynced = 0
+	return nil
+}
+
+// Close syncs and closes the audit file.
+func (a *AuditLogger) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.f == nil {
+		return nil
+	}
+	err := a.syncLocked()
+	if cerr := a.f.Close(); err == nil && cerr != nil {
+		err = fmt.Errorf("unable to close audit log: %v", cerr)
+	}
+	a.f = nil
+	return err
+}
+
+func auditHash(key, entry []byte) string {
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write(entry)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyAuditLog checks the hash chain of an audit file with the key it was written with, and returns its
+// last entry. It fails if an entry was edited, removed or reordered, or if the file ends with a partial
+// entry. Entries removed from the end of the file leave a valid chain, so their removal is only detected
+// with an anchor: if set, typically from the Head of the logger stored elsewhere at an earlier time, the
+// file must also hold that entry.
+func VerifyAuditLog(path string, key []byte, anchor AuditHead) (AuditHead, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return AuditHead{}, err
+	}
+	defer f.Close()
+
+	var head AuditHead
+	anchored := anchor == AuditHead{}
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				return head, fmt.Errorf("audit log %s: partial entry after entry %d", path, head.Seq)
+			}
+			break
+		} else if err != nil {
+			return head, fmt.Errorf("unable to read audit log %s: %v", path, err)
+		}
+
+		var al auditLine
+		if err := json.Unmarshal(bytes.TrimSuffix(line, []byte("\n")), &al); err != nil {
+			return head, fmt.Errorf("audit log %s: malformed entry after entry %d: %v", path, head.Seq, err)
+		}
+		if !hmac.Equal([]byte(auditHash(key, al.Entry)), []byte(al.Hash)) {
+			return head, fmt.Errorf("audit log %s: entry after entry %d does not match its hash", path, head.Seq)
+		}
+		var entry AuditEntry
+		if err := json.Unmarshal(al.Entry, &entry); err != nil {
+			return head, fmt.Errorf("audit log %s: malformed entry after entry %d: %v", path, head.Seq, err)
+		}
+		if entry.Seq != head.Seq+1 || entry.PrevHash != head.Hash {
+			return head, fmt.Errorf("audit log %s: entry %d does not follow entry %d", path, entry.Seq, head.Seq)
+		}
+
+		head = AuditHead{Seq: entry.Seq, Hash: al.Hash}
+		if head == anchor {
+			anchored = true
+		}
+	}
+
+	if !anchored {
+		return head, fmt.Errorf("audit log %s: anchored entry %d is missing, the log ends at entry %d", path, anchor.Seq, head.Seq)
+	}
+	return head, nil
+}
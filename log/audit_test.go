@@ -0,0 +1,289 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var testAuditKey = []byte("audit-test-key")
+
+func writeAuditLog(t *testing.T, path string, actions ...string) AuditHead {
+	t.Helper()
+	a, err := NewAuditLogger(AuditOptions{Path: path, Key: testAuditKey, SyncEvery: 2})
+	if err != nil {
+		t.Fatalf("Got failure '%v', expecting success", err)
+	}
+	for _, action := range actions {
+		if err := a.Log(action, "user", "admin", "count", 3); err != nil {
+			t.Fatalf("Got failure '%v', expecting success", err)
+		}
+	}
+	head := a.Head()
+	if err := a.Close(); err != nil {
+		t.Fatalf("Got failure '%v', expecting success", err)
+	}
+	return head
+}
+
+func TestAuditLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	head := writeAuditLog(t, path, "create", "update")
+	if head.Seq != 2 {
+		t.Errorf("Got head %v, expecting entry 2", head)
+	}
+
+	// reopening continues the chain
+	head = writeAuditLog(t, path, "delete")
+	if _, err := VerifyAuditLog(path, []byte("other-key"), AuditHead{}); err == nil {
+		t.Error("Got success with another key, expecting error")
+	}
+	got, err := VerifyAuditLog(path, testAuditKey, head)
+	if err != nil {
+		t.Fatalf("Got failure '%v', expecting success", err)
+	}
+	if got != head || got.Seq != 3 {
+		t.Errorf("Got head %v, expecting %v", got, head)
+	}
+
+	content, _ := os.ReadFile(path)
+	if !strings.Contains(string(content), `"action":"delete","labels":{"count":3,"user":"admin"}`) {
+		t.Errorf("Got %s, expecting the labels to be recorded", content)
+	}
+}
+
+func TestAuditLogErrors(t *testing.T) {
+	a, err := NewAuditLogger(AuditOptions{Path: filepath.Join(t.TempDir(), "audit.log"), Key: testAuditKey})
+	if err != nil {
+		t.Fatalf("Got failure '%v', expecting success", err)
+	}
+	if err := a.Log("create", "user"); err == nil {
+		t.Error("Got success for an odd number of labels, expecting error")
+	}
+	if err := a.Log("create", 1, "admin"); err == nil {
+		t.Error("Got success for a label name that isn't a string, expecting error")
+	}
+	_ = a.Close()
+	if err := a.Log("create"); err == nil {
+		t.Error("Got success after close, expecting error")
+	}
+
+	if _, err := NewAuditLogger(AuditOptions{Key: testAuditKey}); err == nil {
+		t.Error("Got success without a path, expecting error")
+	}
+	if _, err := NewAuditLogger(AuditOptions{Path: filepath.Join(t.TempDir(), "audit.log")}); err == nil {
+		t.Error("Got success without a key, expecting error")
+	}
+}
+
+func TestAuditLogTampering(t *testing.T) {
+	cases := []struct {
+		name   string
+		tamper func(lines []string) []string
+		anchor bool
+	}{
+		{
+			name: "edited",
+			tamper: func(lines []string) []string {
+				lines[1] = strings.Replace(lines[1], "admin", "guest", 1)
+				return lines
+			},
+		},
+		{
+			// the last entry is rewritten along with a hash computed without the key
+			name: "forged",
+			tamper: func(lines []string) []string {
+				var al auditLine
+				if err := json.Unmarshal([]byte(lines[2]), &al); err != nil {
+					panic(err)
+				}
+				al.Entry = bytes.Replace(al.Entry, []byte("admin"), []byte("guest"), 1)
+				sum := sha256.Sum256(al.Entry)
+				al.Hash = hex.EncodeToString(sum[:])
+				line, _ := json.Marshal(al)
+				lines[2] = string(line)
+				return lines
+			},
+		},
+		{
+			name: "removed",
+			tamper: func(lines []string) []string {
+				return append(lines[:1], lines[2:]...)
+			},
+		},
+		{
+			name: "reordered",
+			tamper: func(lines []string) []string {
+				lines[0], lines[1] = lines[1], lines[0]
+				return lines
+			},
+		},
+		{
+			name: "partial",
+			tamper: func(lines []string) []string {
+				lines[len(lines)-2] = lines[len(lines)-2][:20]
+				return lines[:len(lines)-1]
+			},
+		},
+		{
+			name: "truncated",
+			tamper: func(lines []string) []string {
+				return append(lines[:1], "")
+			},
+			anchor: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "audit.log")
+			head := writeAuditLog(t, path, "create", "update", "delete")
+
+			content, _ := os.ReadFile(path)
+			lines := c.tamper(strings.Split(string(content), "\n"))
+			if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			var anchor AuditHead
+			if c.anchor {
+				anchor = head
+			}
+			if _, err := VerifyAuditLog(path, testAuditKey, anchor); err == nil {
+				t.Error("Got success, expecting the tampering to be detected")
+			}
+			if !c.anchor {
+				if _, err := NewAuditLogger(AuditOptions{Path: path, Key: testAuditKey}); err == nil {
+					t.Error("Got success, expecting a broken audit log not to be appended to")
+				}
+			}
+		})
+	}
+}
+
+// shortAuditFile writes only the start of the next entry, and fails.
+type shortAuditFile struct {
+	*os.File
+	truncateErr error
+}
+
+func (f shortAuditFile) Write(p []byte) (int, error) {
+	n, _ := f.File.Write(p[:len(p)/2])
+	return n, io.ErrShortWrite
+}
+
+func (f shortAuditFile) Truncate(size int64) error {
+	if f.truncateErr != nil {
+		return f.truncateErr
+	}
+	return f.File.Truncate(size)
+}
+
+func TestAuditLogWriteFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	writeAuditLog(t, path, "create")
+
+	a, err := NewAuditLogger(AuditOptions{Path: path, Key: testAuditKey})
+	if err != nil {
+		t.Fatalf("Got failure '%v', expecting success", err)
+	}
+	defer a.Close()
+	f := a.f.(*os.File)
+
+	// the partial entry is removed, so later entries continue the chain
+	a.f = shortAuditFile{File: f}
+	if err := a.Log("update"); err == nil {
+		t.Error("Got success for a short write, expecting error")
+	}
+	a.f = f
+	if err := a.Log("delete"); err != nil {
+		t.Fatalf("Got failure '%v', expecting success", err)
+	}
+	head, err := VerifyAuditLog(path, testAuditKey, a.Head())
+	if err != nil || head.Seq != 2 {
+		t.Errorf("Got %v, %v, expecting a valid log with 2 entries", head, err)
+	}
+
+	// a partial entry that can't be removed fails all later entries
+	a.f = shortAuditFile{File: f, truncateErr: errors.New("read-only")}
+	if err := a.Log("update"); err == nil {
+		t.Error("Got success for a short write, expecting error")
+	}
+	a.f = f
+	if err := a.Log("delete"); err == nil || !strings.Contains(err.Error(), "broken") {
+		t.Errorf("Got %v, expecting the logger to be broken", err)
+	}
+}
+
+// unsyncedAuditFile fails to sync.
+type unsyncedAuditFile struct {
+	*os.File
+}
+
+func (f unsyncedAuditFile) Sync() error {
+	return errors.New("i/o error")
+}
+
+func TestAuditLogSyncFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	a, err := NewAuditLogger(AuditOptions{Path: path, Key: testAuditKey})
+	if err != nil {
+		t.Fatalf("Got failure '%v', expecting success", err)
+	}
+	defer a.Close()
+	f := a.f.(*os.File)
+
+	// the entry is written, so retrying it would record it twice
+	a.f = unsyncedAuditFile{File: f}
+	if err := a.Log("create"); err == nil || !strings.Contains(err.Error(), "up to entry 1") {
+		t.Errorf("Got %v, expecting a sync error", err)
+	}
+	a.f = f
+	if err := a.Log("create"); err == nil || !strings.Contains(err.Error(), "broken") {
+		t.Errorf("Got %v, expecting the logger to be broken", err)
+	}
+	head, err := VerifyAuditLog(path, testAuditKey, AuditHead{})
+	if err != nil || head.Seq != 1 {
+		t.Errorf("Got %v, %v, expecting a valid log with 1 entry", head, err)
+	}
+}
+
+func TestAuditLogTruncation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	head := writeAuditLog(t, path, "create", "update", "delete")
+
+	content, _ := os.ReadFile(path)
+	lines := strings.SplitAfter(string(content), "\n")
+	if err := os.WriteFile(path, []byte(lines[0]), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// the remaining entries form a valid chain, so only the anchor reveals the removal
+	if got, err := VerifyAuditLog(path, testAuditKey, AuditHead{}); err != nil || got.Seq != 1 {
+		t.Errorf("Got %v, %v, expecting a valid log with 1 entry without an anchor", got, err)
+	}
+	if _, err := VerifyAuditLog(path, testAuditKey, head); err == nil || !strings.Contains(err.Error(), "anchored entry 3 is missing") {
+		t.Errorf("Got %v, expecting the truncation to be detected with an anchor", err)
+	}
+}
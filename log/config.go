@@ -52,16 +52,17 @@
 package log
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
-	"go.uber.org/zap/zapgrpc"
 	"google.golang.org/grpc/grpclog"
-	"gopkg.in/natefinch/lumberjack.v2"
 	"k8s.io/klog/v2"
 )
 
@@ -69,6 +70,7 @@ const (
 	// none is used to disable logging output as well as to disable stack tracing.
 	none          zapcore.Level = 100
 	GrpcScopeName string        = "grpc"
+	KlogScopeName string        = "klog"
 )
 
 var levelToZap = map[Level]zapcore.Level{
@@ -109,7 +111,10 @@ var (
 	// controls whether all output is JSON or CLI style. This makes it easier to query how the zap encoder is configured
 	// vs. reading it's internal state.
 	useJSON atomic.Value
-	logGrpc bool
+	// controls whether trace context is output using the Stackdriver special fields, and the project they refer to.
+	useStackdriver     atomic.Value
+	stackdriverProject atomic.Value
+	logGrpc            bool
 )
 
 func init() {
@@ -118,7 +123,7 @@ func init() {
 }
 
 // prepZap is a utility function used by the Configure function.
-func prepZap(options *Options) (zapcore.Core, zapcore.Core, zapcore.WriteSyncer, error) {
+func prepZap(options *Options) (zapcore.Core, zapcore.Core, zapcore.WriteSyncer, *openedSinks, error) {
 	var enc zapcore.Encoder
 	if options.useStackdriverFormat {
 		// See also: https://cloud.google.com/logging/docs/reference/v2/rest/v2/LogEntry
@@ -137,49 +142,80 @@ func prepZap(options *Options) (zapcore.Core, zapcore.Core, zapcore.WriteSyncer,
 		}
 		enc = zapcore.NewJSONEncoder(encCfg)
 		useJSON.Store(true)
+		useStackdriver.Store(true)
+		stackdriverProject.Store(options.stackdriverTargetProject)
 	} else {
+		useStackdriver.Store(false)
+		stackdriverProject.Store("")
 		encCfg := defaultEncoderConfig
 
-		if options.JSONEncoding {
+		structuredEnc, err := newEncoder(options.Encoding)
+		if err != nil {
+			return nil, nil, nil, nil, err
+		}
+
+		switch {
+		case structuredEnc != nil:
+			// the encoders read labels and error details from fields, as in JSON output
+			enc = structuredEnc
+			useJSON.Store(true)
+		case options.Encoding == EncodingJSON || (options.Encoding == "" && options.JSONEncoding):
 			enc = zapcore.NewJSONEncoder(encCfg)
 			useJSON.Store(true)
-		} else {
+		default:
 			enc = zapcore.NewConsoleEncoder(encCfg)
 			useJSON.Store(false)
 		}
 	}
 
-	var rotaterSink zapcore.WriteSyncer
-	if options.RotateOutputPath != "" {
-		rotaterSink = zapcore.AddSync(&lumberjack.Logger{
-			Filename:   options.RotateOutputPath,
-			MaxSize:    options.RotationMaxSize,
-			MaxBackups: options.RotationMaxBackups,
-			MaxAge:     options.RotationMaxAge,
-		})
+	scopePaths, err := parseScopedPaths(options.scopeOutputPaths)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	scopeRotatePaths, err := parseScopedPaths(options.scopeRotateOutputPaths)
+	if err != nil {
+		return nil, nil, nil, nil, err
 	}
 
 	errSink, closeErrorSink, err := zap.Open(options.ErrorOutputPaths...)
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, nil, nil, nil, err
 	}
 
-	var outputSink zapcore.WriteSyncer
-	if len(options.OutputPaths) > 0 {
-		outputSink, _, err = zap.Open(options.OutputPaths...)
-		if err != nil {
-			closeErrorSink()
-			return nil, nil, nil, err
-		}
+	// sinks configured for the default scope replace the sinks shared by all other scopes
+	outputPaths, rotatePath := options.OutputPaths, options.RotateOutputPath
+	if scopePaths[DefaultScopeName] != nil || scopeRotatePaths[DefaultScopeName] != nil {
+		outputPaths, rotatePath = scopePaths[DefaultScopeName], lastPath(scopeRotatePaths[DefaultScopeName])
+	}
+	sink, rf, closeSink, err := openSink(outputPaths, rotatePath, options)
+	if err != nil {
+		closeErrorSink()
+		return nil, nil, nil, nil, err
 	}
 
-	var sink zapcore.WriteSyncer
-	if rotaterSink != nil && outputSink != nil {
-		sink = zapcore.NewMultiWriteSyncer(outputSink, rotaterSink)
-	} else if rotaterSink != nil {
-		sink = rotaterSink
-	} else {
-		sink = outputSink
+	// the sinks opened so far are closed if a later one can't be opened
+	opened := &openedSinks{closeFns: []func(){closeErrorSink, closeSink}}
+	if rf != nil {
+		opened.files = append(opened.files, rf)
+	}
+
+	scopeSinks := make(map[string]zapcore.WriteSyncer)
+	for _, paths := range []map[string][]string{scopePaths, scopeRotatePaths} {
+		for scope := range paths {
+			if scope == DefaultScopeName || scopeSinks[scope] != nil {
+				continue
+			}
+			scopeSink, rf, closeScopeSink, err := openSink(scopePaths[scope], lastPath(scopeRotatePaths[scope]), options)
+			if err != nil {
+				opened.close()
+				return nil, nil, nil, nil, err
+			}
+			opened.closeFns = append(opened.closeFns, closeScopeSink)
+			if rf != nil {
+				opened.files = append(opened.files, rf)
+			}
+			scopeSinks[scope] = scopeSink
+		}
 	}
 
 	var enabler zap.LevelEnablerFunc = func(lvl zapcore.Level) bool {
@@ -194,9 +230,75 @@ func prepZap(options *Options) (zapcore.Core, zapcore.Core, zapcore.WriteSyncer,
 		return defaultScope.DebugEnabled()
 	}
 
-	return zapcore.NewCore(enc, sink, zap.NewAtomicLevelAt(zapcore.DebugLevel)),
-		zapcore.NewCore(enc, sink, enabler),
-		errSink, nil
+	routes := make(map[string]zapcore.Core, len(scopeSinks))
+	captureRoutes := make(map[string]zapcore.Core, len(scopeSinks))
+	for scope, scopeSink := range scopeSinks {
+		routes[scope] = zapcore.NewCore(enc, scopeSink, zap.NewAtomicLevelAt(zapcore.DebugLevel))
+		captureRoutes[scope] = zapcore.NewCore(enc, scopeSink, enabler)
+	}
+
+	return newScopeRoutingCore(zapcore.NewCore(enc, sink, zap.NewAtomicLevelAt(zapcore.DebugLevel)), routes),
+		newScopeRoutingCore(zapcore.NewCore(enc, sink, enabler), captureRoutes),
+		errSink, opened, nil
+}
+
+// openedSinks are the sinks opened by prepZap. Their rotating log files are only used by Reopen and Rotate
+// once Configure succeeds, while all of them are closed if it fails.
+type openedSinks struct {
+	files    []*rotatingFile
+	closeFns []func()
+}
+
+func (o *openedSinks) close() {
+	for _, f := range o.closeFns {
+		f()
+	}
+}
+
+// lastPath returns the last of the given paths, as only one rotating log file is supported per sink.
+func lastPath(paths []string) string {
+	if len(paths) == 0 {
+		return ""
+	}
+	return paths[len(paths)-1]
+}
+
+// openSink opens the given output paths and optional rotating log file as a single sink. The rotating
+// log file is returned as well, if any, along with a function closing the sink.
+func openSink(outputPaths []string, rotatePath string, options *Options) (zapcore.WriteSyncer, *rotatingFile, func(), error) {
+	var rotater *rotatingFile
+	if rotatePath != "" {
+		var err error
+		if rotater, err = newRotatingFile(rotatePath, options); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	var outputSink zapcore.WriteSyncer
+	closeOutput := func() {}
+	if len(outputPaths) > 0 {
+		var err error
+		outputSink, closeOutput, err = zap.Open(outputPaths...)
+		if err != nil {
+			if rotater != nil {
+				_ = rotater.Close()
+			}
+			return nil, nil, nil, err
+		}
+	}
+
+	closeSink := func() {
+		closeOutput()
+		if rotater != nil {
+			_ = rotater.Close()
+		}
+	}
+	if rotater != nil && outputSink != nil {
+		return zapcore.NewMultiWriteSyncer(outputSink, rotater), rotater, closeSink, nil
+	} else if rotater != nil {
+		return rotater, rotater, closeSink, nil
+	}
+	return outputSink, nil, closeSink, nil
 }
 
 func formatDate(t time.Time, enc zapcore.PrimitiveArrayEncoder) {
@@ -241,38 +343,47 @@ func formatDate(t time.Time, enc zapcore.PrimitiveArrayEncoder) {
 func updateScopes(options *Options) error {
 	// snapshot what's there
 	allScopes := Scopes()
+	if _, ok := allScopes[GrpcScopeName]; !ok && options.LogGrpc {
+		// the scope of captured gRPC logs is configured like the others
+		allScopes[GrpcScopeName] = registerScope(GrpcScopeName, "", grpcCallerSkip)
+	}
 
 	// update the output levels of all listed scopes
-	if err := processLevels(allScopes, options.outputLevels, func(s *Scope, l Level) { s.SetOutputLevel(l) }); err != nil {
+	outputLevels, err := processLevels(allScopes, options.outputLevels, func(s *Scope, l Level) { s.SetOutputLevel(l) })
+	if err != nil {
 		return err
 	}
 
 	// update the stack tracing levels of all listed scopes
-	if err := processLevels(allScopes, options.stackTraceLevels, func(s *Scope, l Level) { s.SetStackTraceLevel(l) }); err != nil {
+	stackTraceLevels, err := processLevels(allScopes, options.stackTraceLevels, func(s *Scope, l Level) { s.SetStackTraceLevel(l) })
+	if err != nil {
 		return err
 	}
 
-	// update the caller location setting of all listed scopes
-	sc := strings.Split(options.logCallers, ",")
-	for _, s := range sc {
-		if s == "" {
-			continue
-		}
+	// update the sampling of all listed scopes
+	if err := processSampling(allScopes, options.sampling, func(s *Scope, cfg Sampling) { s.SetSampling(cfg) }); err != nil {
+		return err
+	}
 
-		if s == OverrideScopeName {
-			// ignore everything else and just apply the override value
-			for _, scope := range allScopes {
-				scope.SetLogCallers(true)
-			}
+	// update the deduplication of all listed scopes
+	if err := processDedup(allScopes, options.dedup, func(s *Scope, w time.Duration) { s.SetDedupWindow(w) }); err != nil {
+		return err
+	}
 
-			return nil
-		}
+	// update the caller location setting of all listed scopes
+	logCallers := processScopeList(allScopes, options.logCallers, func(s *Scope) { s.SetLogCallers(true) })
 
-		if scope, ok := allScopes[s]; ok {
-			scope.SetLogCallers(true)
-		}
+	// update the level rules of all listed scopes
+	if err := processLevelRules(allScopes, options.levelRules, func(s *Scope, r []LevelRule) { s.SetLevelRules(r) }); err != nil {
+		return err
 	}
 
+	// disable redaction of all listed scopes
+	processScopeList(allScopes, options.unredacted, func(s *Scope) { s.SetRedaction(false) })
+
+	// apply the levels and caller settings to the scopes registered later, such as those selected by patterns
+	setLaterSettings(outputLevels, stackTraceLevels, logCallers)
+
 	// update LogGrpc if necessary
 	if logGrpc {
 		options.LogGrpc = true
@@ -282,50 +393,127 @@ func updateScopes(options *Options) error {
 }
 
 // processLevels breaks down an argument string into a set of scope & levels and then
-// tries to apply the result to the scopes. It supports the use of a global override.
-func processLevels(allScopes map[string]*Scope, arg string, setter func(*Scope, Level)) error {
-	levels := strings.Split(arg, ",")
-	for _, sl := range levels {
+// tries to apply the result to the scopes. It supports the use of a global override, and
+// settings for a scope also apply to its descendants unless they are more closely selected.
+// It returns a scopeApplier applying the levels to scopes registered later.
+func processLevels(allScopes map[string]*Scope, arg string, setter func(*Scope, Level)) (scopeApplier, error) {
+	var names []string
+	var levels []Level
+	for _, sl := range strings.Split(arg, ",") {
 		s, l, err := convertScopedLevel(sl)
 		if err != nil {
-			return err
+			return nil, err
 		}
+		names = append(names, s)
+		levels = append(levels, l)
+	}
 
-		if scope, ok := allScopes[s]; ok {
-			setter(scope, l)
-		} else if s == OverrideScopeName {
+	for i, s := range names {
+		if s == OverrideScopeName {
 			// override replaces everything
 			for _, scope := range allScopes {
-				setter(scope, l)
+				setter(scope, levels[i])
 			}
-			return nil
-		} else if s == GrpcScopeName {
-			grpcScope := registerScope(GrpcScopeName, "", 3)
+			return func(s *Scope, _ int) { setter(s, levels[i]) }, nil
+		}
+	}
+
+	for _, s := range names {
+		if _, ok := allScopes[s]; !ok && s == GrpcScopeName {
+			allScopes[s] = registerScope(GrpcScopeName, "", grpcCallerSkip)
 			logGrpc = true
-			setter(grpcScope, l)
+		}
+	}
+
+	return applyScoped(allScopes, names, levels, setter), nil
+}
+
+// processSampling breaks down an argument string into a set of scope & sampling configurations and
+// tries to apply the result to the scopes. It supports the use of a global override.
+func processSampling(allScopes map[string]*Scope, arg string, setter func(*Scope, Sampling)) error {
+	var names []string
+	var configs []Sampling
+	for _, ss := range strings.Split(arg, ",") {
+		if ss == "" {
+			continue
+		}
+		s, cfg, err := convertScopedSampling(ss)
+		if err != nil {
+			return err
+		}
+		names = append(names, s)
+		configs = append(configs, cfg)
+	}
+
+	for i, s := range names {
+		if s == OverrideScopeName {
+			// override replaces everything
+			for _, scope := range allScopes {
+				setter(scope, configs[i])
+			}
 			return nil
 		}
 	}
 
+	applyScoped(allScopes, names, configs, setter)
 	return nil
 }
 
+// processScopeList breaks down an argument string into a set of scopes, such as those for which to
+// include caller information, and applies a setting to them and their descendants. It supports the
+// use of a global override. It returns a scopeApplier applying the setting to scopes registered later.
+func processScopeList(allScopes map[string]*Scope, arg string, enable func(*Scope)) scopeApplier {
+	var names []string
+	for _, s := range strings.Split(arg, ",") {
+		if s == "" {
+			continue
+		}
+
+		if s == OverrideScopeName {
+			// ignore everything else and just apply the override value
+			for _, scope := range allScopes {
+				enable(scope)
+			}
+			return func(s *Scope, _ int) { enable(s) }
+		}
+		names = append(names, s)
+	}
+
+	return applyScoped(allScopes, names, make([]struct{}, len(names)), func(s *Scope, _ struct{}) { enable(s) })
+}
+
 // Configure initializes Istio's logging subsystem.
 //
 // You typically call this once at process startup.
 // Once this call returns, the logging system is ready to accept data.
 // nolint: staticcheck
-func Configure(options *Options) error {
-	core, captureCore, errSink, err := prepZap(options)
+func Configure(options *Options) (err error) {
+	core, captureCore, errSink, opened, err := prepZap(options)
 	if err != nil {
 		return err
 	}
 
+	// when configuring fails, whatever was built so far is closed and the previous configuration stays in use
+	var closeFns []func() error
+	defer func() {
+		if err != nil {
+			for _, f := range closeFns {
+				_ = f()
+			}
+			opened.close()
+		}
+	}()
+
 	if err = updateScopes(options); err != nil {
 		return err
 	}
 
-	closeFns := make([]func() error, 0)
+	countErrorTypes.Store(options.ErrorTypeMetrics)
+	if options.ShutdownTimeout > 0 {
+		shutdownTimeout.Store(int64(options.ShutdownTimeout))
+	} else {
+		shutdownTimeout.Store(int64(defaultShutdownTimeout))
+	}
 
 	if options.teeToStackdriver {
 		var closeFn, captureCloseFn func() error
@@ -339,6 +527,7 @@ func Configure(options *Options) error {
 		if err != nil {
 			return err
 		}
+		closeFns = append(closeFns, closeFn)
 		captureCore, captureCloseFn, err = teeToStackdriver(
 			captureCore,
 			options.stackdriverTargetProject,
@@ -348,20 +537,80 @@ func Configure(options *Options) error {
 		if err != nil {
 			return err
 		}
-		closeFns = append(closeFns, closeFn, captureCloseFn)
+		closeFns = append(closeFns, captureCloseFn)
 	}
 
 	if options.teeToUDSServer {
-		// build uds core.
-		core = teeToUDSServer(core, options.udsSocketAddress, options.udsServerPath)
-		captureCore = teeToUDSServer(captureCore, options.udsSocketAddress, options.udsServerPath)
+		// build uds core, with both pipelines sharing one queue.
+		sender := newUDSSender(options.udsSocketAddress, options.udsServerPath, options.udsOptions)
+		core = teeToUDSServer(core, sender)
+		captureCore = teeToUDSServer(captureCore, sender)
+		closeFns = append(closeFns, sender.close)
+	}
+
+	if options.teeToOTLP {
+		// build OTLP core, with both pipelines sharing one export queue.
+		var batcher *otlpBatcher
+		if batcher, err = newOTLPBatcher(options.otlpOptions); err != nil {
+			return err
+		}
+		core = teeToOTLP(core, batcher)
+		captureCore = teeToOTLP(captureCore, batcher)
+		closeFns = append(closeFns, batcher.close)
+	}
+
+	if options.teeToSyslog {
+		// build syslog core, with both pipelines sharing one connection.
+		var writer *syslogWriter
+		if writer, err = newSyslogWriter(options.syslogOptions); err != nil {
+			return err
+		}
+		core = teeToSyslog(core, writer)
+		captureCore = teeToSyslog(captureCore, writer)
+		closeFns = append(closeFns, writer.close)
+	}
+
+	if options.teeToJournald {
+		// build journald core, with both pipelines sharing one connection.
+		var writer *journaldWriter
+		if writer, err = newJournaldWriter(options.journaldSocket); err != nil {
+			return err
+		}
+		core = teeToJournald(core, writer)
+		captureCore = teeToJournald(captureCore, writer)
+		closeFns = append(closeFns, writer.close)
 	}
 
+	// redact entries that bypass the scopes, before any sink sees them
+	core = newRedactingCore(core)
+	captureCore = newRedactingCore(captureCore)
+
+	if options.async {
+		// both pipelines share one queue, which is drained before the sinks are closed
+		writer := newAsyncWriter(options.asyncOptions, errSink)
+		core = newAsyncCore(core, writer)
+		captureCore = newAsyncCore(captureCore, writer)
+		closeFns = append([]func() error{writer.close}, closeFns...)
+	}
+
+	// the configuration file is only watched once all sinks are built, as applying it can't be undone.
+	// The options are copied, as they are reapplied whenever the file changes.
+	fileOptions := *options
+	var stopWatch func() error
+	if stopWatch, err = watchConfigFile(&fileOptions); err != nil {
+		return err
+	}
+	closeFns = append(closeFns, stopWatch)
+	setRotatingFiles(opened.files)
+
+	// the sinks may be closed by Close, and again when a later call to Configure replaces them
+	var closeOnce sync.Once
+	var closeErr error
 	pt := patchTable{
 		write: func(ent zapcore.Entry, fields []zapcore.Field) error {
 			err := core.Write(ent, fields)
 			if ent.Level == zapcore.FatalLevel {
-				funcs.Load().(patchTable).exitProcess(1)
+				exitAfterShutdown()
 			}
 
 			return err
@@ -370,21 +619,28 @@ func Configure(options *Options) error {
 		exitProcess: os.Exit,
 		errorSink:   errSink,
 		close: func() error {
-			// best-effort to sync
-			core.Sync() // nolint: errcheck
-			for _, f := range closeFns {
-				if err := f(); err != nil {
-					return err
+			closeOnce.Do(func() {
+				// best-effort to sync
+				core.Sync() // nolint: errcheck
+				var errs []error
+				for _, f := range closeFns {
+					if err := f(); err != nil {
+						errs = append(errs, err)
+					}
 				}
-			}
-			return nil
+				closeErr = errors.Join(errs...)
+			})
+			return closeErr
 		},
 	}
+	// the sinks of the previous configuration are closed once the new ones are in use
+	prev, _ := funcs.Load().(patchTable)
 	funcs.Store(pt)
 
 	opts := []zap.Option{
 		zap.ErrorOutput(errSink),
 		zap.AddCallerSkip(1),
+		zap.WithFatalHook(fatalHook{}),
 	}
 
 	if defaultScope.GetLogCallers() {
@@ -404,9 +660,9 @@ func Configure(options *Options) error {
 	// capture standard golang "log" package output and force it through our logger
 	_ = zap.RedirectStdLog(captureLogger)
 
-	// capture gRPC logging
+	// capture gRPC logging into the grpc scope
 	if options.LogGrpc {
-		grpclog.SetLogger(zapgrpc.NewLogger(captureLogger.WithOptions(zap.AddCallerSkip(3))))
+		grpclog.SetLoggerV2(newGrpcLogger(registerScope(GrpcScopeName, "", grpcCallerSkip)))
 	}
 
 	// capture klog (Kubernetes logging) through our logging
@@ -419,6 +675,13 @@ func Configure(options *Options) error {
 		KlogScope.SetOutputLevel(DebugLevel)
 	}
 
+	if prev.close != nil {
+		if err := prev.close(); err != nil {
+			_, _ = fmt.Fprintf(errSink, "%v log close error: %v\n", time.Now(), err)
+			_ = errSink.Sync()
+		}
+	}
+
 	return nil
 }
 
@@ -428,7 +691,8 @@ func Sync() error {
 	return funcs.Load().(patchTable).sync()
 }
 
-// Close implements io.Closer.
+// Close implements io.Closer. It runs the hooks registered with RegisterShutdownHook before closing the
+// log sinks.
 func Close() error {
-	return funcs.Load().(patchTable).close()
+	return shutdown(funcs.Load().(patchTable).close)
 }
@@ -15,11 +15,15 @@
 package log
 
 import (
+	"io"
 	"log"
+	"net/url"
 	"os"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -289,17 +293,127 @@ func TestRotateMaxBackups(t *testing.T) {
 	}
 	Sync()
 
-	rd, err := os.ReadDir(dir)
-	if err != nil {
-		t.Fatalf("Unable to read dir: %v", err)
+	// old backups are removed in the background
+	if n := waitForFiles(t, dir, o.RotationMaxBackups+1); n != o.RotationMaxBackups+1 {
+		t.Errorf("Got %d backup logs, expecting at most %d", n-1, o.RotationMaxBackups)
 	}
+}
 
-	if len(rd) == o.RotationMaxBackups+1 {
-		// perfect, we're done
-		return
+// waitForFiles waits until dir holds n files, and returns the number of files it holds.
+func waitForFiles(t *testing.T, dir string, n int) int {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		rd, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatalf("Unable to read dir: %v", err)
+		}
+		if len(rd) == n || time.Now().After(deadline) {
+			return len(rd)
+		}
+		time.Sleep(10 * time.Millisecond)
 	}
+}
 
-	t.Errorf("Expecting at most %d backup logs", o.RotationMaxBackups)
+func TestScopeOutputRouting(t *testing.T) {
+	resetGlobals()
+	dir := t.TempDir()
+	ads := RegisterScope("ads", "")
+	other := RegisterScope("other", "")
+
+	o := DefaultOptions()
+	o.OutputPaths = []string{dir + "/shared.log"}
+	o.SetScopeOutputPaths("ads", dir+"/ads.log")
+	o.SetScopeRotateOutputPath("ads", dir+"/ads-rotated.log")
+	if err := Configure(o); err != nil {
+		t.Fatalf("Unable to configure logging: %v", err)
+	}
+
+	ads.Info("from-ads")
+	other.Info("from-other")
+	defaultScope.Info("from-default")
+	_ = Sync()
+
+	read := func(name string) string {
+		content, err := os.ReadFile(dir + "/" + name)
+		if err != nil {
+			t.Fatalf("Got failure '%v', expecting success", err)
+		}
+		return string(content)
+	}
+	for _, name := range []string{"ads.log", "ads-rotated.log"} {
+		content := read(name)
+		if !strings.Contains(content, "from-ads") || strings.Contains(content, "from-other") ||
+			strings.Contains(content, "from-default") {
+			t.Errorf("Expecting %s to only contain output of the ads scope, got %s", name, content)
+		}
+	}
+	if content := read("shared.log"); strings.Contains(content, "from-ads") ||
+		!strings.Contains(content, "from-other") || !strings.Contains(content, "from-default") {
+		t.Errorf("Expecting shared.log to contain output of all other scopes, got %s", content)
+	}
+
+	// routing the default scope replaces the shared sinks
+	o.SetScopeOutputPaths(DefaultScopeName, dir+"/default.log")
+	if err := Configure(o); err != nil {
+		t.Fatalf("Unable to configure logging: %v", err)
+	}
+	other.Info("from-other-2")
+	_ = Sync()
+	if content := read("default.log"); !strings.Contains(content, "from-other-2") {
+		t.Errorf("Expecting default.log to contain output of other scopes, got %s", content)
+	}
+	if content := read("shared.log"); strings.Contains(content, "from-other-2") {
+		t.Errorf("Expecting shared.log to no longer be used, got %s", content)
+	}
+
+	o = DefaultOptions()
+	o.scopeOutputPaths = "ads"
+	if err := Configure(o); err == nil {
+		t.Error("Got success, expecting error")
+	}
+	_ = Configure(DefaultOptions())
+}
+
+// countingSink counts the sinks opened and closed through the "counting" URL scheme.
+type countingSink struct {
+	zapcore.WriteSyncer
+	closed *atomic.Int32
+}
+
+func (s countingSink) Close() error {
+	s.closed.Add(1)
+	return nil
+}
+
+var (
+	registerCountingSink sync.Once
+	openedCountingSinks  atomic.Int32
+	closedCountingSinks  atomic.Int32
+)
+
+func TestScopeOutputFailureClosesSinks(t *testing.T) {
+	resetGlobals()
+	registerCountingSink.Do(func() {
+		_ = zap.RegisterSink("counting", func(*url.URL) (zap.Sink, error) {
+			openedCountingSinks.Add(1)
+			return countingSink{WriteSyncer: zapcore.AddSync(io.Discard), closed: &closedCountingSinks}, nil
+		})
+	})
+	openedCountingSinks.Store(0)
+	closedCountingSinks.Store(0)
+
+	o := DefaultOptions()
+	o.OutputPaths = []string{"counting://shared"}
+	o.SetScopeOutputPaths("ads", "counting://ads")
+	o.SetScopeOutputPaths("other", t.TempDir()+"/missing/other.log")
+	if err := Configure(o); err == nil {
+		t.Error("Got success, expecting error")
+	}
+	if opened, closed := openedCountingSinks.Load(), closedCountingSinks.Load(); opened == 0 || closed != opened {
+		t.Errorf("Got %d of %d sinks closed, expecting all of them", closed, opened)
+	}
+	_ = Configure(DefaultOptions())
 }
 
 func TestCapture(t *testing.T) {
@@ -307,6 +421,7 @@ func TestCapture(t *testing.T) {
 		o := DefaultOptions()
 		o.SetLogCallers(DefaultScopeName, true)
 		o.SetOutputLevel(DefaultScopeName, DebugLevel)
+		o.SetLogCallers(GrpcScopeName, true)
 		o.LogGrpc = true
 		_ = Configure(o)
 
@@ -334,6 +449,7 @@ func TestCapture(t *testing.T) {
 		_ = zap.L().Core().Write(entry, nil)
 
 		defaultScope.SetOutputLevel(NoneLevel)
+		FindScope(GrpcScopeName).SetOutputLevel(NoneLevel)
 
 		// all these get thrown out since the level is set to none
 		log.Println("golang-2")
@@ -348,9 +464,9 @@ func TestCapture(t *testing.T) {
 
 	patterns := []string{
 		timePattern + "\tinfo\tlog/config_test.go:.*\tgolang",
-		timePattern + "\tinfo\tlog/config_test.go:.*\tgrpc-error", // gRPC errors and warnings come out as info
-		timePattern + "\tinfo\tlog/config_test.go:.*\tgrpc-warn",
-		timePattern + "\tinfo\tlog/config_test.go:.*\tgrpc-info",
+		timePattern + "\terror\tgrpc\tlog/config_test.go:.*\tgrpc-error",
+		timePattern + "\twarn\tgrpc\tlog/config_test.go:.*\tgrpc-warn",
+		timePattern + "\tinfo\tgrpc\tlog/config_test.go:.*\tgrpc-info",
 		timePattern + "\terror\tlog/config_test.go:.*\tzap-error",
 		timePattern + "\twarn\tlog/config_test.go:.*\tzap-warn",
 		timePattern + "\tinfo\tlog/config_test.go:.*\tzap-info",
@@ -423,6 +539,11 @@ func captureStdout(f func()) ([]string, error) {
 }
 
 func resetGlobals() {
+	// the summaries of deduplicated messages may still look up scopes
+	lock.Lock()
 	scopes = make(map[string]*Scope, 1)
+	lock.Unlock()
+	setLaterSettings()
 	defaultScope = registerDefaultScope()
+	logGrpc = false
 }
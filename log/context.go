@@ -0,0 +1,161 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// traceparentHeader is the W3C Trace Context header carrying the trace and parent span IDs.
+	traceparentHeader = "traceparent"
+
+	traceIDKey      = "trace_id"
+	spanIDKey       = "span_id"
+	traceSampledKey = "trace_sampled"
+
+	// See: https://cloud.google.com/logging/docs/structured-logging#special-payload-fields
+	stackdriverTraceKey        = "logging.googleapis.com/trace"
+	stackdriverSpanIDKey       = "logging.googleapis.com/spanId"
+	stackdriverTraceSampledKey = "logging.googleapis.com/trace_sampled"
+)
+
+// traceKeys are the fields that carry trace context in JSON output, replaced by native fields in
+// sinks that support them.
+var traceKeys = []string{
+	traceIDKey, spanIDKey, traceSampledKey,
+	stackdriverTraceKey, stackdriverSpanIDKey, stackdriverTraceSampledKey,
+}
+
+// TraceContext identifies the span a log message was emitted in.
+type TraceContext struct {
+	// TraceID is the 32 hex digit trace ID.
+	TraceID string
+	// SpanID is the 16 hex digit span ID.
+	SpanID string
+	// Sampled is whether the trace is being recorded.
+	Sampled bool
+}
+
+type traceparentKey struct{}
+
+// ContextWithTraceparent returns a copy of ctx carrying a W3C traceparent header value, for use by servers
+// that receive trace context without an OpenTelemetry propagator.
+func ContextWithTraceparent(ctx context.Context, traceparent string) context.Context {
+	return context.WithValue(ctx, traceparentKey{}, traceparent)
+}
+
+// TraceFromContext extracts the trace context from ctx. An OpenTelemetry span context takes precedence,
+// followed by a traceparent set with ContextWithTraceparent, and finally a traceparent in incoming gRPC metadata.
+func TraceFromContext(ctx context.Context) (TraceContext, bool) {
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		return TraceContext{
+			TraceID: sc.TraceID().String(),
+			SpanID:  sc.SpanID().String(),
+			Sampled: sc.IsSampled(),
+		}, true
+	}
+
+	if tp, ok := ctx.Value(traceparentKey{}).(string); ok {
+		if tc, err := ParseTraceparent(tp); err == nil {
+			return tc, true
+		}
+	}
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for _, tp := range md.Get(traceparentHeader) {
+			if tc, err := ParseTraceparent(tp); err == nil {
+				return tc, true
+			}
+		}
+	}
+
+	return TraceContext{}, false
+}
+
+// ParseTraceparent parses a W3C traceparent header value, e.g. "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01".
+func ParseTraceparent(traceparent string) (TraceContext, error) {
+	pieces := strings.Split(strings.TrimSpace(traceparent), "-")
+	// future versions may append fields, version 00 has exactly four
+	if len(pieces) < 4 || len(pieces[0]) != 2 || pieces[0] == "ff" || (pieces[0] == "00" && len(pieces) != 4) {
+		return TraceContext{}, fmt.Errorf("invalid traceparent '%s'", traceparent)
+	}
+
+	version, traceID, spanID, flags := pieces[0], pieces[1], pieces[2], pieces[3]
+	if !isHex(version) || len(traceID) != 32 || !isHex(traceID) || strings.Trim(traceID, "0") == "" {
+		return TraceContext{}, fmt.Errorf("invalid traceparent trace ID '%s'", traceparent)
+	}
+	if len(spanID) != 16 || !isHex(spanID) || strings.Trim(spanID, "0") == "" {
+		return TraceContext{}, fmt.Errorf("invalid traceparent span ID '%s'", traceparent)
+	}
+	f, err := hex.DecodeString(flags)
+	if err != nil || len(f) != 1 {
+		return TraceContext{}, fmt.Errorf("invalid traceparent flags '%s'", traceparent)
+	}
+
+	return TraceContext{TraceID: traceID, SpanID: spanID, Sampled: f[0]&0x01 != 0}, nil
+}
+
+// isHex returns whether s consists of lowercase hex digits only.
+func isHex(s string) bool {
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// WithContext returns a copy of s that attaches the trace and span IDs found in ctx to every message.
+// If ctx carries no trace context, s is returned unchanged.
+func (s *Scope) WithContext(ctx context.Context) *Scope {
+	tc, ok := TraceFromContext(ctx)
+	if !ok {
+		return s
+	}
+	out := s.copy()
+	out.trace = &tc
+	return out
+}
+
+// stackdriverTrace returns the trace ID in the form expected by Cloud Logging.
+func stackdriverTrace(project, traceID string) string {
+	if project == "" {
+		return traceID
+	}
+	return "projects/" + project + "/traces/" + traceID
+}
+
+// traceFields appends the fields carrying the trace context of a message in JSON output.
+func traceFields(fields []zapcore.Field, tc *TraceContext) []zapcore.Field {
+	if useStackdriver.Load().(bool) {
+		return append(fields,
+			zap.String(stackdriverTraceKey, stackdriverTrace(stackdriverProject.Load().(string), tc.TraceID)),
+			zap.String(stackdriverSpanIDKey, tc.SpanID),
+			zap.Bool(stackdriverTraceSampledKey, tc.Sampled))
+	}
+	return append(fields,
+		zap.String(traceIDKey, tc.TraceID),
+		zap.String(spanIDKey, tc.SpanID),
+		zap.Bool(traceSampledKey, tc.Sampled))
+}
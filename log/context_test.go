@@ -0,0 +1,132 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	testTraceID     = "4bf92f3577b34da6a3ce929d0e0e4736"
+	testSpanID      = "00f067aa0ba902b7"
+	testTraceparent = "00-" + testTraceID + "-" + testSpanID + "-01"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	cases := []struct {
+		in   string
+		want TraceContext
+		ok   bool
+	}{
+		{testTraceparent, TraceContext{TraceID: testTraceID, SpanID: testSpanID, Sampled: true}, true},
+		{"00-" + testTraceID + "-" + testSpanID + "-00", TraceContext{TraceID: testTraceID, SpanID: testSpanID}, true},
+		{"01-" + testTraceID + "-" + testSpanID + "-01-extra", TraceContext{TraceID: testTraceID, SpanID: testSpanID, Sampled: true}, true},
+		{"00-" + testTraceID + "-" + testSpanID + "-01-extra", TraceContext{}, false},
+		{"ff-" + testTraceID + "-" + testSpanID + "-01", TraceContext{}, false},
+		{"00-00000000000000000000000000000000-" + testSpanID + "-01", TraceContext{}, false},
+		{"00-" + testTraceID + "-0000000000000000-01", TraceContext{}, false},
+		{"00-" + testTraceID + "-" + testSpanID + "-x", TraceContext{}, false},
+		{"00-4BF92F3577B34DA6A3CE929D0E0E4736-" + testSpanID + "-01", TraceContext{}, false},
+		{"garbage", TraceContext{}, false},
+	}
+
+	for _, c := range cases {
+		got, err := ParseTraceparent(c.in)
+		if c.ok && (err != nil || got != c.want) {
+			t.Errorf("Got %v, %v for %q, expecting %v", got, err, c.in, c.want)
+		} else if !c.ok && err == nil {
+			t.Errorf("Got success for %q, expecting error", c.in)
+		}
+	}
+}
+
+func TestTraceFromContext(t *testing.T) {
+	want := TraceContext{TraceID: testTraceID, SpanID: testSpanID, Sampled: true}
+
+	tid, _ := trace.TraceIDFromHex(testTraceID)
+	sid, _ := trace.SpanIDFromHex(testSpanID)
+	otelCtx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    tid,
+		SpanID:     sid,
+		TraceFlags: trace.FlagsSampled,
+	}))
+
+	cases := map[string]context.Context{
+		"otel":        otelCtx,
+		"traceparent": ContextWithTraceparent(context.Background(), testTraceparent),
+		"grpc":        metadata.NewIncomingContext(context.Background(), metadata.Pairs(traceparentHeader, testTraceparent)),
+	}
+	for name, ctx := range cases {
+		if got, ok := TraceFromContext(ctx); !ok || got != want {
+			t.Errorf("%s: got %v, %v, expecting %v", name, got, ok, want)
+		}
+	}
+
+	if _, ok := TraceFromContext(context.Background()); ok {
+		t.Error("Expecting no trace context in an empty context")
+	}
+	if _, ok := TraceFromContext(ContextWithTraceparent(context.Background(), "bad")); ok {
+		t.Error("Expecting an invalid traceparent to be ignored")
+	}
+}
+
+func TestWithContext(t *testing.T) {
+	s := RegisterScope("testWithContext", "")
+	ctx := ContextWithTraceparent(context.Background(), testTraceparent)
+
+	if got := s.WithContext(context.Background()); got != s {
+		t.Error("Expecting the scope to be returned unchanged without trace context")
+	}
+
+	lines := runTest(t, func() {
+		s.WithContext(ctx).Info("traced")
+		s.WithLabels("k", "v").WithContext(ctx).Info("labeled")
+		s.Info("untraced")
+	})
+	mustRegexMatchString(t, lines[0], "testWithContext\ttraced\ttrace_id="+testTraceID+" span_id="+testSpanID+"$")
+	mustRegexMatchString(t, lines[1], "testWithContext\tlabeled\tk=v trace_id="+testTraceID+" span_id="+testSpanID+"$")
+	mustRegexMatchString(t, lines[2], "testWithContext\tuntraced$")
+
+	lines, err := captureStdout(func() {
+		o := DefaultOptions()
+		o.JSONEncoding = true
+		_ = Configure(o)
+		WithContext(ctx).Info("traced")
+		_ = Sync()
+	})
+	if err != nil {
+		t.Errorf("Got error '%v', expected success", err)
+	}
+	mustRegexMatchString(t, lines[0], `{.*"msg":"traced","trace_id":"`+testTraceID+`","span_id":"`+testSpanID+`","trace_sampled":true}`)
+
+	lines, err = captureStdout(func() {
+		o := DefaultOptions().WithStackdriverLoggingFormat()
+		o.stackdriverTargetProject = "proj"
+		_ = Configure(o)
+		WithContext(ctx).Info("traced")
+		_ = Sync()
+	})
+	if err != nil {
+		t.Errorf("Got error '%v', expected success", err)
+	}
+	mustRegexMatchString(t, lines[0], `{.*"message":"traced","logging.googleapis.com/trace":"projects/proj/traces/`+testTraceID+
+		`","logging.googleapis.com/spanId":"`+testSpanID+`","logging.googleapis.com/trace_sampled":true}`)
+
+	_ = Configure(DefaultOptions())
+}
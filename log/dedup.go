@@ -0,0 +1,181 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"istio.io/pkg/structured"
+)
+
+// dedupMaxEntries bounds the number of distinct messages tracked per scope. Once reached, further
+// messages are output as usual until tracked ones expire.
+const dedupMaxEntries = 4096
+
+// deduper collapses the repeats of a message of a scope within a window following its first occurrence.
+// Messages are identical if they have the same level, text, labels and structured error. Fatal messages
+// are never collapsed.
+type deduper struct {
+	window time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*dedupEntry
+}
+
+type dedupEntry struct {
+	repeated int
+}
+
+func newDeduper(window time.Duration) *deduper {
+	if window <= 0 {
+		return nil
+	}
+	return &deduper{window: window, entries: make(map[string]*dedupEntry)}
+}
+
+// dedupKey returns the identity of a message.
+func dedupKey(level Level, scope *Scope, ie *structured.Error, msg string) string {
+	sb := &strings.Builder{}
+	sb.WriteString(strconv.Itoa(int(level)))
+	sb.WriteByte(0)
+	sb.WriteString(msg)
+	for _, k := range scope.labelKeys {
+		sb.WriteByte(0)
+		sb.WriteString(k)
+		sb.WriteByte('=')
+		sb.WriteString(fmt.Sprint(scope.labels[k]))
+	}
+	if ie != nil {
+		for _, v := range []string{ie.MoreInfo, ie.Impact, ie.Action, ie.LikelyCause, toErrString(ie.Err)} {
+			sb.WriteByte(0)
+			sb.WriteString(v)
+		}
+	}
+	return sb.String()
+}
+
+// allow returns whether a message should be output. Repeats of a message within the window of its first
+// occurrence are counted instead, and once the window ends, a summary holding their number is output.
+// Fatal messages are always output, so that they exit.
+func (d *deduper) allow(level Level, scope *Scope, ie *structured.Error, msg string) bool {
+	if level == FatalLevel {
+		return true
+	}
+	key := dedupKey(level, scope, ie, msg)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if e, ok := d.entries[key]; ok {
+		e.repeated++
+		dedupSuppressed.With(scopeTag.Value(scope.name)).Increment()
+		return false
+	}
+	if len(d.entries) >= dedupMaxEntries {
+		return true
+	}
+
+	e := &dedupEntry{}
+	d.entries[key] = e
+	time.AfterFunc(d.window, func() {
+		d.mu.Lock()
+		delete(d.entries, key)
+		n := e.repeated
+		d.mu.Unlock()
+
+		if n > 0 && summaryEnabled(level, scope) {
+			writeRecord(level, scope, ie, fmt.Sprintf("%s (repeated %d times)", msg, n))
+		}
+	})
+	return true
+}
+
+// summaryEnabled returns whether the summary of repeats at level is still output once the window ends, as
+// the scope may have been turned down meanwhile. Copies of a scope made by WithLabels hold the output level
+// it had when they were made, so the level of the registered scope is checked instead.
+func summaryEnabled(level Level, scope *Scope) bool {
+	if s := FindScope(scope.name); s != nil {
+		return s.GetOutputLevel() >= level || scope.ruleMatched(level)
+	}
+	return scope.enabled(level)
+}
+
+// SetDedupWindow adjusts the deduplication of the output of the scope. Repeats of a message within window
+// of its first occurrence are not output, and are summarized by a "repeated N times" message once the window
+// ends. A window of 0 disables deduplication.
+func (s *Scope) SetDedupWindow(window time.Duration) {
+	s.dedup.Store(newDeduper(window))
+}
+
+// GetDedupWindow returns the deduplication window of the scope, or 0 if deduplication is disabled.
+func (s *Scope) GetDedupWindow() time.Duration {
+	if d := s.getDeduper(); d != nil {
+		return d.window
+	}
+	return 0
+}
+
+func (s *Scope) getDeduper() *deduper {
+	d, _ := s.dedup.Load().(*deduper)
+	return d
+}
+
+// parseDedupWindow parses a deduplication window, where 0 disables deduplication.
+func parseDedupWindow(arg string) (time.Duration, error) {
+	window, err := time.ParseDuration(arg)
+	if err != nil || window < 0 {
+		return 0, fmt.Errorf("invalid deduplication window '%s'", arg)
+	}
+	return window, nil
+}
+
+// processDedup breaks down an argument string into a set of scope & deduplication windows and tries to
+// apply the result to the scopes. It supports the use of a global override.
+func processDedup(allScopes map[string]*Scope, arg string, setter func(*Scope, time.Duration)) error {
+	var names []string
+	var windows []time.Duration
+	for _, sd := range strings.Split(arg, ",") {
+		if sd == "" {
+			continue
+		}
+		s, w, ok := strings.Cut(sd, ":")
+		if !ok {
+			return fmt.Errorf("invalid deduplication format '%s'", sd)
+		}
+		window, err := parseDedupWindow(w)
+		if err != nil {
+			return err
+		}
+		names = append(names, s)
+		windows = append(windows, window)
+	}
+
+	for i, s := range names {
+		if s == OverrideScopeName {
+			// override replaces everything
+			for _, scope := range allScopes {
+				setter(scope, windows[i])
+			}
+			return nil
+		}
+	}
+
+	applyScoped(allScopes, names, windows, setter)
+	return nil
+}
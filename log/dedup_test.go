@@ -0,0 +1,147 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDedup(t *testing.T) {
+	s := RegisterScope("testDedup", "")
+	defer s.SetDedupWindow(0)
+
+	lines := runTest(t, func() {
+		s.SetDedupWindow(time.Hour)
+		for i := 0; i < 5; i++ {
+			s.Info("storm")
+		}
+		// messages with other text, level or labels are tracked separately
+		s.Info("calm")
+		s.Warn("storm")
+		s.WithLabels("k", "v").Info("storm")
+		s.WithLabels("k", "v").Info("storm")
+		s.WithLabels("k", "w").Info("storm")
+	})
+
+	mustMatchLength(t, 5, lines)
+	mustRegexMatchString(t, lines[0], "info\ttestDedup\tstorm$")
+	mustRegexMatchString(t, lines[1], "info\ttestDedup\tcalm$")
+	mustRegexMatchString(t, lines[2], "warn\ttestDedup\tstorm$")
+	mustRegexMatchString(t, lines[3], "info\ttestDedup\tstorm\tk=v$")
+	mustRegexMatchString(t, lines[4], "info\ttestDedup\tstorm\tk=w$")
+}
+
+func TestDedupSummary(t *testing.T) {
+	s := RegisterScope("testDedupSummary", "")
+	defer s.SetDedupWindow(0)
+
+	lines := runTest(t, func() {
+		s.SetDedupWindow(10 * time.Millisecond)
+		for i := 0; i < 4; i++ {
+			s.WithLabels("k", "v").Warn("storm")
+		}
+		s.Info("once")
+		time.Sleep(100 * time.Millisecond)
+		// the window has ended, so the message is output again
+		s.WithLabels("k", "v").Warn("storm")
+	})
+
+	mustMatchLength(t, 4, lines)
+	mustRegexMatchString(t, lines[0], "warn\ttestDedupSummary\tstorm\tk=v$")
+	mustRegexMatchString(t, lines[1], "info\ttestDedupSummary\tonce$")
+	mustRegexMatchString(t, lines[2], "warn\ttestDedupSummary\tstorm \\(repeated 3 times\\)\tk=v$")
+	mustRegexMatchString(t, lines[3], "warn\ttestDedupSummary\tstorm\tk=v$")
+}
+
+func TestDedupSummaryDisabled(t *testing.T) {
+	s := RegisterScope("testDedupSummaryDisabled", "")
+	defer s.SetDedupWindow(0)
+	defer s.SetOutputLevel(InfoLevel)
+
+	lines := runTest(t, func() {
+		s.SetDedupWindow(10 * time.Millisecond)
+		for i := 0; i < 3; i++ {
+			s.WithLabels("k", "v").Info("storm")
+		}
+		// the summary isn't output once the scope no longer outputs its level
+		s.SetOutputLevel(WarnLevel)
+		time.Sleep(100 * time.Millisecond)
+	})
+
+	mustMatchLength(t, 1, lines)
+	mustRegexMatchString(t, lines[0], "info\ttestDedupSummaryDisabled\tstorm\tk=v$")
+}
+
+func TestDedupOptions(t *testing.T) {
+	resetGlobals()
+	s := RegisterScope("testDedupOptions", "")
+
+	o := DefaultOptions()
+	o.SetDedupWindow("testDedupOptions", 10*time.Second)
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got %v, expecting success", err)
+	}
+	if got := s.GetDedupWindow(); got != 10*time.Second {
+		t.Errorf("Got %v, expecting 10s", got)
+	}
+	if got, err := o.GetDedupWindow("testDedupOptions"); err != nil || got != 10*time.Second {
+		t.Errorf("Got %v, %v, expecting 10s", got, err)
+	}
+	if got := defaultScope.GetDedupWindow(); got != 0 {
+		t.Errorf("Got %v, expecting default scope to not be deduplicated", got)
+	}
+
+	o.SetDedupWindow("testDedupOptions", 0)
+	if o.dedup != "" {
+		t.Errorf("Got %q, expecting the window to be removed", o.dedup)
+	}
+
+	o = DefaultOptions()
+	o.dedup = "all:1m"
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got %v, expecting success", err)
+	}
+	if got := defaultScope.GetDedupWindow(); got != time.Minute {
+		t.Errorf("Got %v, expecting override to apply to the default scope", got)
+	}
+
+	for _, bad := range []string{"default", "default:x", "default:-1s"} {
+		o = DefaultOptions()
+		o.dedup = bad
+		if err := Configure(o); err == nil || !strings.Contains(err.Error(), "deduplication") {
+			t.Errorf("Got %v for %q, expecting deduplication error", err, bad)
+		}
+	}
+
+	resetGlobals()
+	_ = Configure(DefaultOptions())
+}
+
+func TestDedupKeepsFatal(t *testing.T) {
+	s := RegisterScope("testDedupFatal", "")
+	defer s.SetDedupWindow(0)
+
+	var calls []string
+	configureWithExit(t, DefaultOptions(), &calls)
+
+	s.SetDedupWindow(time.Hour)
+	s.Fatal("fatal")
+	s.Fatal("fatal")
+	if got := strings.Join(calls, ","); got != "exit,exit" {
+		t.Errorf("Got calls %s, expecting every fatal message to exit", got)
+	}
+}
@@ -14,6 +14,10 @@
 
 package log
 
+import (
+	"context"
+)
+
 // These functions enable logging using a global Scope. See scope.go for usage information.
 
 func registerDefaultScope() *Scope {
@@ -102,3 +106,8 @@ func DebugEnabled() bool {
 func WithLabels(kvlist ...any) *Scope {
 	return defaultScope.WithLabels(kvlist...)
 }
+
+// WithContext returns a copy of the default scope that attaches the trace and span IDs found in ctx to every message.
+func WithContext(ctx context.Context) *Scope {
+	return defaultScope.WithContext(ctx)
+}
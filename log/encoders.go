@@ -0,0 +1,392 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+
+	"istio.io/pkg/structured"
+)
+
+// Encodings selectable with Options.Encoding.
+const (
+	// EncodingConsole is the plain console-friendly format.
+	EncodingConsole = "console"
+	// EncodingJSON is a JSON object per message.
+	EncodingJSON = "json"
+	// EncodingLogfmt is a line of space-separated key=value pairs per message.
+	EncodingLogfmt = "logfmt"
+	// EncodingECS is a JSON object per message following the Elastic Common Schema.
+	EncodingECS = "ecs"
+	// EncodingGELF is a JSON object per message in the Graylog Extended Log Format.
+	EncodingGELF = "gelf"
+)
+
+// ecsVersion is the version of the Elastic Common Schema used by the ECS encoding.
+const ecsVersion = "1.6.0"
+
+// structuredErrorKeys are the keys of the fields holding the parts of a structured.Error in JSON output.
+var structuredErrorKeys = []string{"moreInfo", "impact", "action", "likelyCause", "err"}
+
+var encoderBufferPool = buffer.NewPool()
+
+// encodedEntry holds the parts of an entry written by a structuredEncoder.
+type encodedEntry struct {
+	scope string
+	msg   string
+	// labels and fields, excluding the structured error and trace context
+	attrs map[string]any
+	ie    *structured.Error
+	trace *TraceContext
+}
+
+// sortedKeys returns the keys of the attributes of e, sorted.
+func (e *encodedEntry) sortedKeys() []string {
+	keys := make([]string, 0, len(e.attrs))
+	for k := range e.attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// structuredEncoder encodes entries from their scope, message, labels, structured error and trace context,
+// rather than from the flattened forms used by the console encoder. Fields added with With are held in the
+// embedded map encoder.
+type structuredEncoder struct {
+	*zapcore.MapObjectEncoder
+	format func(buf *buffer.Buffer, entry zapcore.Entry, e *encodedEntry)
+}
+
+func newStructuredEncoder(format func(buf *buffer.Buffer, entry zapcore.Entry, e *encodedEntry)) zapcore.Encoder {
+	return &structuredEncoder{MapObjectEncoder: zapcore.NewMapObjectEncoder(), format: format}
+}
+
+// newEncoder returns the encoder of a structured encoding, or nil for the console and JSON encodings.
+func newEncoder(encoding string) (zapcore.Encoder, error) {
+	switch encoding {
+	case EncodingLogfmt:
+		return newStructuredEncoder(formatLogfmt), nil
+	case EncodingECS:
+		return newStructuredEncoder(formatECS), nil
+	case EncodingGELF:
+		host, _ := os.Hostname()
+		return newStructuredEncoder(func(buf *buffer.Buffer, entry zapcore.Entry, e *encodedEntry) {
+			formatGELF(buf, host, entry, e)
+		}), nil
+	case "", EncodingConsole, EncodingJSON:
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unknown log encoding '%s'", encoding)
+}
+
+// Clone implements zapcore.Encoder.
+func (se *structuredEncoder) Clone() zapcore.Encoder {
+	enc := zapcore.NewMapObjectEncoder()
+	for k, v := range se.Fields {
+		enc.Fields[k] = v
+	}
+	return &structuredEncoder{MapObjectEncoder: enc, format: se.format}
+}
+
+// EncodeEntry implements zapcore.Encoder.
+func (se *structuredEncoder) EncodeEntry(entry zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	scope, msg, attrs, tc := structuredEntry(entry, nil, fields)
+	for k, v := range se.Fields {
+		if _, ok := attrs[k]; !ok {
+			attrs[k] = v
+		}
+	}
+
+	e := &encodedEntry{scope: scope, msg: msg, attrs: attrs, trace: tc}
+	if r := findRecord(fields); r != nil {
+		if r.ie != nil {
+			e.ie = r.ie
+			for _, k := range structuredErrorKeys {
+				delete(attrs, k)
+			}
+		}
+		// labels named like the parts of the structured error or trace context are kept, for the formats
+		// to rename
+		for _, keys := range [][]string{structuredErrorKeys, traceKeys} {
+			for _, k := range keys {
+				if v, ok := r.scope.labels[k]; ok {
+					attrs[k] = v
+				}
+			}
+		}
+	}
+
+	buf := encoderBufferPool.Get()
+	se.format(buf, entry, e)
+	return buf, nil
+}
+
+// structuredErrorFields returns the non-empty parts of a structured error, in the order of structuredErrorKeys.
+func structuredErrorFields(ie *structured.Error) [][2]string {
+	var out [][2]string
+	for i, v := range []string{ie.MoreInfo, ie.Impact, ie.Action, ie.LikelyCause, toErrString(ie.Err)} {
+		if v != "" {
+			out = append(out, [2]string{structuredErrorKeys[i], v})
+		}
+	}
+	return out
+}
+
+// logfmtReservedKeys are the keys written by formatLogfmt besides labels.
+var logfmtReservedKeys = reservedKeys(logfmtKey, "time", "level", "scope", "caller", "msg", "stack", traceIDKey, spanIDKey)
+
+// reservedKeys returns the set of the given keys and the structured error keys, converted by name.
+func reservedKeys(name func(string) string, keys ...string) map[string]bool {
+	out := make(map[string]bool, len(keys)+len(structuredErrorKeys))
+	for _, k := range append(keys, structuredErrorKeys...) {
+		out[name(k)] = true
+	}
+	return out
+}
+
+// formatLogfmt writes an entry as space-separated key=value pairs, with values quoted when needed. Labels
+// named like the other keys of the entry are suffixed with an underscore, so that they don't duplicate them.
+func formatLogfmt(buf *buffer.Buffer, entry zapcore.Entry, e *encodedEntry) {
+	writeLogfmtPair(buf, "time", entry.Time.UTC().Format(time.RFC3339Nano))
+	writeLogfmtPair(buf, "level", entry.Level.String())
+	writeLogfmtPair(buf, "scope", e.scope)
+	if entry.Caller.Defined {
+		writeLogfmtPair(buf, "caller", entry.Caller.TrimmedPath())
+	}
+	writeLogfmtPair(buf, "msg", e.msg)
+	for _, k := range e.sortedKeys() {
+		name := logfmtKey(k)
+		if logfmtReservedKeys[name] {
+			name += "_"
+		}
+		writeLogfmtPair(buf, name, fmt.Sprint(e.attrs[k]))
+	}
+	if e.ie != nil {
+		for _, kv := range structuredErrorFields(e.ie) {
+			writeLogfmtPair(buf, kv[0], kv[1])
+		}
+	}
+	if e.trace != nil {
+		writeLogfmtPair(buf, traceIDKey, e.trace.TraceID)
+		writeLogfmtPair(buf, spanIDKey, e.trace.SpanID)
+	}
+	if entry.Stack != "" {
+		writeLogfmtPair(buf, "stack", entry.Stack)
+	}
+	buf.AppendString(zapcore.DefaultLineEnding)
+}
+
+// logfmtKey replaces the characters of a key that would break the format.
+func logfmtKey(key string) string {
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r == '=' || r == '"' {
+			return '_'
+		}
+		return r
+	}, key)
+}
+
+// writeLogfmtPair writes a key=value pair, with the key converted by logfmtKey.
+func writeLogfmtPair(buf *buffer.Buffer, key, value string) {
+	if buf.Len() > 0 {
+		buf.AppendByte(' ')
+	}
+	buf.AppendString(logfmtKey(key))
+	buf.AppendByte('=')
+	if logfmtNeedsQuoting(value) {
+		buf.AppendString(strconv.Quote(value))
+	} else {
+		buf.AppendString(value)
+	}
+}
+
+func logfmtNeedsQuoting(s string) bool {
+	if s == "" {
+		return true
+	}
+	for _, r := range s {
+		if r <= ' ' || r == '=' || r == '"' || r == utf8.RuneError {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonObject writes the members of a JSON object in the order they are added.
+type jsonObject struct {
+	buf *buffer.Buffer
+	n   int
+}
+
+func newJSONObject(buf *buffer.Buffer) *jsonObject {
+	buf.AppendByte('{')
+	return &jsonObject{buf: buf}
+}
+
+func (o *jsonObject) add(key string, value any) {
+	if o.n > 0 {
+		o.buf.AppendByte(',')
+	}
+	o.n++
+	writeJSONValue(o.buf, key)
+	o.buf.AppendByte(':')
+	writeJSONValue(o.buf, value)
+}
+
+func (o *jsonObject) close() {
+	o.buf.AppendByte('}')
+}
+
+// writeJSONValue writes v as JSON, falling back to its string form if it can't be marshaled.
+func writeJSONValue(buf *buffer.Buffer, v any) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		b, _ = json.Marshal(fmt.Sprint(v))
+	}
+	_, _ = buf.Write(b)
+}
+
+// formatECS writes an entry as a JSON object following the Elastic Common Schema, with labels and the
+// guidance of structured errors recorded under labels.
+//
+// See: https://www.elastic.co/guide/en/ecs-logging/overview/current/intro.html
+func formatECS(buf *buffer.Buffer, entry zapcore.Entry, e *encodedEntry) {
+	o := newJSONObject(buf)
+	o.add("@timestamp", entry.Time.UTC().Format(time.RFC3339Nano))
+	o.add("log.level", entry.Level.String())
+	o.add("message", e.msg)
+	o.add("ecs.version", ecsVersion)
+	o.add("log.logger", e.scope)
+	if entry.Caller.Defined {
+		o.add("log.origin", map[string]any{
+			"file.name": entry.Caller.TrimmedPath(),
+			"file.line": entry.Caller.Line,
+			"function":  entry.Caller.Function,
+		})
+	}
+	if e.trace != nil {
+		o.add("trace.id", e.trace.TraceID)
+		o.add("span.id", e.trace.SpanID)
+	}
+
+	errorFields := map[string]any{}
+	labels := e.attrs
+	if e.ie != nil {
+		for _, kv := range structuredErrorFields(e.ie) {
+			if kv[0] != "err" {
+				labels[kv[0]] = kv[1]
+			}
+		}
+		if e.ie.Err != nil {
+			errorFields["message"] = e.ie.Err.Error()
+			errorFields["type"] = fmt.Sprintf("%T", e.ie.Err)
+		}
+	}
+	if entry.Stack != "" {
+		errorFields["stack_trace"] = entry.Stack
+	}
+	if len(errorFields) > 0 {
+		o.add("error", errorFields)
+	}
+	if len(labels) > 0 {
+		o.add("labels", labels)
+	}
+	o.close()
+	buf.AppendString(zapcore.DefaultLineEnding)
+}
+
+// gelfReservedFields are the additional fields written by formatGELF besides labels.
+var gelfReservedFields = reservedKeys(gelfFieldName, "scope", "caller", traceIDKey, spanIDKey)
+
+// formatGELF writes an entry as a GELF 1.1 JSON object. The scope, caller, labels, structured error and
+// trace context are recorded as additional fields, prefixed with an underscore. Labels named like the other
+// fields are suffixed with an underscore, so that they don't duplicate them. Stack traces are recorded in
+// the full message.
+//
+// See: https://go2docs.graylog.org/current/getting_in_log_data/gelf.html
+func formatGELF(buf *buffer.Buffer, host string, entry zapcore.Entry, e *encodedEntry) {
+	o := newJSONObject(buf)
+	o.add("version", "1.1")
+	o.add("host", host)
+	short := e.msg
+	if short == "" {
+		// the short message is mandatory
+		short = "-"
+	}
+	o.add("short_message", short)
+	if entry.Stack != "" {
+		o.add("full_message", e.msg+"\n"+entry.Stack)
+	}
+	o.add("timestamp", float64(entry.Time.UnixMicro())/1e6)
+	o.add("level", syslogSeverityMapping[entry.Level])
+	o.add("_scope", e.scope)
+	if entry.Caller.Defined {
+		o.add("_caller", entry.Caller.TrimmedPath())
+	}
+	for _, k := range e.sortedKeys() {
+		name := gelfFieldName(k)
+		if gelfReservedFields[name] {
+			name += "_"
+		}
+		o.add(name, gelfValue(e.attrs[k]))
+	}
+	if e.ie != nil {
+		for _, kv := range structuredErrorFields(e.ie) {
+			o.add(gelfFieldName(kv[0]), kv[1])
+		}
+	}
+	if e.trace != nil {
+		o.add(gelfFieldName(traceIDKey), e.trace.TraceID)
+		o.add(gelfFieldName(spanIDKey), e.trace.SpanID)
+	}
+	o.close()
+	buf.AppendString(zapcore.DefaultLineEnding)
+}
+
+// gelfFieldName returns the name of the additional field for key. Characters other than letters, digits,
+// underscores, periods and dashes are replaced by underscores, and the reserved _id field is renamed.
+func gelfFieldName(key string) string {
+	name := "_" + strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '.', r == '-':
+			return r
+		}
+		return '_'
+	}, key)
+	if name == "_id" {
+		return "_id_"
+	}
+	return name
+}
+
+// gelfValue returns v if it is a number or string, as GELF only allows those, and its string form otherwise.
+func gelfValue(v any) any {
+	switch v.(type) {
+	case string, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return v
+	}
+	return fmt.Sprint(v)
+}
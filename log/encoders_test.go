@@ -0,0 +1,192 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"istio.io/pkg/structured"
+)
+
+// encodedLines configures logging with the given encoding, calls f and returns the lines written.
+func encodedLines(t *testing.T, encoding string, f func()) []string {
+	t.Helper()
+	file := t.TempDir() + "/enc.log"
+	o := DefaultOptions()
+	o.OutputPaths = []string{file}
+	o.Encoding = encoding
+	if err := Configure(o); err != nil {
+		t.Fatalf("Unable to configure logging: %v", err)
+	}
+	f()
+	_ = Sync()
+	_ = Configure(DefaultOptions())
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("Got failure '%v', expecting success", err)
+	}
+	return strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+}
+
+func logEncoded(s *Scope) {
+	ctx := ContextWithTraceparent(context.Background(), testTraceparent)
+	s.WithLabels("k", "a b", "n", 3).WithContext(ctx).Info("hello world")
+	s.WithLabels("id", 1).Errorf(&structured.Error{MoreInfo: "more", Err: errors.New("boom")}, "failed")
+	zap.L().Info("plain")
+}
+
+func TestLogfmtEncoding(t *testing.T) {
+	s := RegisterScope("testLogfmt", "")
+	s.SetLogCallers(true)
+	defer s.SetLogCallers(false)
+
+	lines := encodedLines(t, EncodingLogfmt, func() { logEncoded(s) })
+	if len(lines) != 3 {
+		t.Fatalf("Got %d lines, expecting 3: %v", len(lines), lines)
+	}
+	mustRegexMatchString(t, lines[0], `^time=\S+Z level=info scope=testLogfmt caller=log/encoders_test.go:\d+ msg="hello world" `+
+		`k="a b" n=3 trace_id=`+testTraceID+` span_id=`+testSpanID+`$`)
+	mustRegexMatchString(t, lines[1], `level=error scope=testLogfmt .*msg=failed id=1 moreInfo=more err=boom$`)
+	mustRegexMatchString(t, lines[2], `level=info scope=default .*msg=plain$`)
+}
+
+func TestECSEncoding(t *testing.T) {
+	s := RegisterScope("testECS", "")
+	s.SetStackTraceLevel(ErrorLevel)
+	defer s.SetStackTraceLevel(NoneLevel)
+
+	lines := encodedLines(t, EncodingECS, func() { logEncoded(s) })
+	if len(lines) != 3 {
+		t.Fatalf("Got %d lines, expecting 3: %v", len(lines), lines)
+	}
+
+	var entries []map[string]any
+	for _, l := range lines {
+		var m map[string]any
+		if err := json.Unmarshal([]byte(l), &m); err != nil {
+			t.Fatalf("Got invalid JSON %s: %v", l, err)
+		}
+		entries = append(entries, m)
+	}
+
+	info := entries[0]
+	if info["log.level"] != "info" || info["message"] != "hello world" || info["log.logger"] != "testECS" ||
+		info["ecs.version"] != ecsVersion || info["trace.id"] != testTraceID || info["span.id"] != testSpanID {
+		t.Errorf("Got %v, expecting the ECS fields to be set", info)
+	}
+	if _, ok := info["@timestamp"]; !ok {
+		t.Errorf("Got %v, expecting @timestamp", info)
+	}
+	if labels, _ := info["labels"].(map[string]any); labels["k"] != "a b" || labels["n"] != float64(3) {
+		t.Errorf("Got labels %v, expecting k and n", info["labels"])
+	}
+
+	failed := entries[1]
+	e, _ := failed["error"].(map[string]any)
+	if e["message"] != "boom" || e["type"] != "*errors.errorString" || !strings.Contains(e["stack_trace"].(string), "TestECSEncoding") {
+		t.Errorf("Got error %v, expecting the message, type and stack trace", failed["error"])
+	}
+	if labels, _ := failed["labels"].(map[string]any); labels["moreInfo"] != "more" || labels["id"] != float64(1) {
+		t.Errorf("Got labels %v, expecting moreInfo and id", failed["labels"])
+	}
+	if failed["message"] != "failed" {
+		t.Errorf("Got message %v, expecting failed", failed["message"])
+	}
+
+	if entries[2]["message"] != "plain" || entries[2]["log.logger"] != DefaultScopeName {
+		t.Errorf("Got %v, expecting the plain message of the default scope", entries[2])
+	}
+}
+
+func TestGELFEncoding(t *testing.T) {
+	s := RegisterScope("testGELF", "")
+	s.SetStackTraceLevel(ErrorLevel)
+	defer s.SetStackTraceLevel(NoneLevel)
+
+	lines := encodedLines(t, EncodingGELF, func() { logEncoded(s) })
+	if len(lines) != 3 {
+		t.Fatalf("Got %d lines, expecting 3: %v", len(lines), lines)
+	}
+
+	var info, failed map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &info); err != nil {
+		t.Fatalf("Got invalid JSON %s: %v", lines[0], err)
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &failed); err != nil {
+		t.Fatalf("Got invalid JSON %s: %v", lines[1], err)
+	}
+
+	if info["version"] != "1.1" || info["short_message"] != "hello world" || info["level"] != float64(6) ||
+		info["_scope"] != "testGELF" || info["_k"] != "a b" || info["_n"] != float64(3) || info["_trace_id"] != testTraceID {
+		t.Errorf("Got %v, expecting the GELF fields to be set", info)
+	}
+	if ts, _ := info["timestamp"].(float64); ts <= 0 {
+		t.Errorf("Got timestamp %v, expecting seconds since the epoch", info["timestamp"])
+	}
+
+	if failed["level"] != float64(3) || failed["_moreInfo"] != "more" || failed["_err"] != "boom" || failed["_id_"] != float64(1) {
+		t.Errorf("Got %v, expecting the structured error and renamed id fields", failed)
+	}
+	if full, _ := failed["full_message"].(string); !strings.HasPrefix(full, "failed\n") || !strings.Contains(full, "TestGELFEncoding") {
+		t.Errorf("Got full message %v, expecting the stack trace", failed["full_message"])
+	}
+}
+
+func TestEncodingLabelCollisions(t *testing.T) {
+	s := RegisterScope("testCollisions", "")
+	logColliding := func() {
+		ctx := ContextWithTraceparent(context.Background(), testTraceparent)
+		s.WithLabels("scope", "x", "msg", "m", "err", "e", "trace_id", "t").WithContext(ctx).
+			Errorf(&structured.Error{Err: errors.New("boom")}, "failed")
+	}
+
+	lines := encodedLines(t, EncodingLogfmt, logColliding)
+	mustRegexMatchString(t, lines[0], `scope=testCollisions msg=failed err_=e msg_=m scope_=x trace_id_=t err=boom `+
+		`trace_id=`+testTraceID+` span_id=`+testSpanID+`$`)
+
+	lines = encodedLines(t, EncodingGELF, logColliding)
+	var m map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &m); err != nil {
+		t.Fatalf("Got invalid JSON %s: %v", lines[0], err)
+	}
+	for k, want := range map[string]any{
+		"_scope": "testCollisions", "_scope_": "x", "_err": "boom", "_err_": "e",
+		"_trace_id": testTraceID, "_trace_id_": "t", "_msg": "m",
+	} {
+		if m[k] != want {
+			t.Errorf("Got %s=%v, expecting %v", k, m[k], want)
+		}
+	}
+	if n := strings.Count(lines[0], `"_scope":`); n != 1 {
+		t.Errorf("Got %s, expecting a single _scope field", lines[0])
+	}
+}
+
+func TestUnknownEncoding(t *testing.T) {
+	o := DefaultOptions()
+	o.Encoding = "xml"
+	if err := Configure(o); err == nil {
+		t.Error("Got success, expecting error")
+	}
+	_ = Configure(DefaultOptions())
+}
@@ -0,0 +1,158 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"fmt"
+	"strings"
+
+	"google.golang.org/grpc/grpclog"
+)
+
+// grpcCallerSkip is the number of frames between the caller of grpclog and the scope output functions.
+const grpcCallerSkip = 3
+
+// grpcLogger is a grpclog.LoggerV2 that outputs gRPC logs through a scope, with gRPC errors and warnings
+// output at the matching level. gRPC prefixes the messages of its components with their name, such as
+// [transport], and the messages of the components in grpcComponents go to child scopes such as grpc.transport,
+// so that they can be controlled separately. Other messages, including those of unknown components, go to the
+// scope itself. The verbose output of gRPC, gated by V, is enabled while the scope is at debug level.
+type grpcLogger struct {
+	s *Scope
+}
+
+var _ grpclog.LoggerV2 = grpcLogger{}
+
+// grpcComponents are the gRPC components with a scope of their own. The prefix of a message is only known to
+// name a component when the message comes from gRPC, so scopes are not registered for other prefixes.
+var grpcComponents = map[string]bool{
+	"authz":          true,
+	"balancer":       true,
+	"binarylog":      true,
+	"channelz":       true,
+	"core":           true,
+	"credentials":    true,
+	"dns":            true,
+	"grpclb":         true,
+	"health_service": true,
+	"rbac":           true,
+	"rls":            true,
+	"roundrobin":     true,
+	"transport":      true,
+	"xds":            true,
+}
+
+// newGrpcLogger returns a grpclog.LoggerV2 outputting to s and its child scopes.
+func newGrpcLogger(s *Scope) grpclog.LoggerV2 {
+	return grpcLogger{s: s}
+}
+
+// route returns the scope of a message, along with the message without its component prefix.
+func (g grpcLogger) route(msg string) (*Scope, string) {
+	if !strings.HasPrefix(msg, "[") {
+		return g.s, msg
+	}
+	end := strings.Index(msg, "] ")
+	if end < 0 || strings.ContainsRune(msg[1:end], ' ') {
+		return g.s, msg
+	}
+	component := msg[1:end]
+	if !grpcComponents[component] {
+		return g.s, msg
+	}
+
+	name := g.s.name + "." + component
+	s := FindScope(name)
+	if s == nil {
+		s = registerScope(name, "", g.s.callerSkip)
+	}
+	return s, msg[end+2:]
+}
+
+func (g grpcLogger) log(level Level, msg string) {
+	s, msg := g.route(msg)
+	switch level {
+	case FatalLevel:
+		if !s.FatalEnabled() {
+			// gRPC expects Fatal to exit even if the output of the scope is disabled
+			exitAfterShutdown()
+			return
+		}
+		s.Fatal(msg)
+	case ErrorLevel:
+		s.Error(msg)
+	case WarnLevel:
+		s.Warn(msg)
+	default:
+		s.Info(msg)
+	}
+}
+
+func (g grpcLogger) Info(args ...any) {
+	g.log(InfoLevel, fmt.Sprint(args...))
+}
+
+func (g grpcLogger) Infoln(args ...any) {
+	g.log(InfoLevel, trimNewline(fmt.Sprintln(args...)))
+}
+
+func (g grpcLogger) Infof(format string, args ...any) {
+	g.log(InfoLevel, fmt.Sprintf(format, args...))
+}
+
+func (g grpcLogger) Warning(args ...any) {
+	g.log(WarnLevel, fmt.Sprint(args...))
+}
+
+func (g grpcLogger) Warningln(args ...any) {
+	g.log(WarnLevel, trimNewline(fmt.Sprintln(args...)))
+}
+
+func (g grpcLogger) Warningf(format string, args ...any) {
+	g.log(WarnLevel, fmt.Sprintf(format, args...))
+}
+
+func (g grpcLogger) Error(args ...any) {
+	g.log(ErrorLevel, fmt.Sprint(args...))
+}
+
+func (g grpcLogger) Errorln(args ...any) {
+	g.log(ErrorLevel, trimNewline(fmt.Sprintln(args...)))
+}
+
+func (g grpcLogger) Errorf(format string, args ...any) {
+	g.log(ErrorLevel, fmt.Sprintf(format, args...))
+}
+
+func (g grpcLogger) Fatal(args ...any) {
+	g.log(FatalLevel, fmt.Sprint(args...))
+}
+
+func (g grpcLogger) Fatalln(args ...any) {
+	g.log(FatalLevel, trimNewline(fmt.Sprintln(args...)))
+}
+
+func (g grpcLogger) Fatalf(format string, args ...any) {
+	g.log(FatalLevel, fmt.Sprintf(format, args...))
+}
+
+// V reports whether verbosity level l is enabled. gRPC logs at verbosity 0 unconditionally, and higher
+// verbosity levels are enabled while the scope is at debug level.
+func (g grpcLogger) V(l int) bool {
+	if l <= 0 {
+		return g.s.InfoEnabled()
+	}
+	return g.s.DebugEnabled()
+}
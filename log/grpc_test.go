@@ -0,0 +1,73 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/grpclog"
+)
+
+func TestGrpcScopes(t *testing.T) {
+	resetGlobals()
+	defer resetGlobals()
+
+	var calls []string
+	o := DefaultOptions()
+	o.LogGrpc = true
+	file := configureWithExit(t, o, &calls)
+
+	grpclog.Info("plain")
+	c := grpclog.Component("transport")
+	c.Info("connecting")
+	c.Errorf("failed %d", 1)
+	// prefixes that don't name a known component stay in the gRPC scope
+	grpclog.Info("[user-supplied] text")
+
+	// components are controlled separately
+	FindScope(GrpcScopeName + ".transport").SetOutputLevel(WarnLevel)
+	c.Info("hidden")
+	c.Warning("warned")
+
+	if grpclog.V(2) {
+		t.Error("Got verbose output enabled, expecting it to require debug level")
+	}
+	FindScope(GrpcScopeName).SetOutputLevel(DebugLevel)
+	if !grpclog.V(2) {
+		t.Error("Got verbose output disabled, expecting debug level to enable it")
+	}
+
+	// fatal messages exit even when the output is disabled. grpclog.Fatal exits by itself, so use the logger.
+	FindScope(GrpcScopeName).SetOutputLevel(NoneLevel)
+	newGrpcLogger(FindScope(GrpcScopeName)).Fatal("gone")
+	if got := strings.Join(calls, ","); got != "exit" {
+		t.Errorf("Got calls %s, expecting exit", got)
+	}
+
+	if FindScope(GrpcScopeName+".user-supplied") != nil {
+		t.Error("Got a scope for an unknown component, expecting none")
+	}
+
+	content, _ := os.ReadFile(file)
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	mustMatchLength(t, 5, lines)
+	mustRegexMatchString(t, lines[0], "\tinfo\tgrpc\tplain$")
+	mustRegexMatchString(t, lines[1], "\tinfo\tgrpc.transport\tconnecting$")
+	mustRegexMatchString(t, lines[2], "\terror\tgrpc.transport\tfailed 1$")
+	mustRegexMatchString(t, lines[3], "\tinfo\tgrpc\t\\[user-supplied\\] text$")
+	mustRegexMatchString(t, lines[4], "\twarn\tgrpc.transport\twarned$")
+}
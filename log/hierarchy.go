@@ -0,0 +1,172 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Scope names form a hierarchy, with periods separating the names of parent and child scopes, e.g. xds.ads.
+// A setting made for a scope applies to its descendants, unless a more specific setting selects them.
+//
+// Settings can also be made for patterns, where '*' matches any sequence of characters, e.g. xds.*
+// selects all descendants of xds, but not xds itself.
+//
+// Scopes registered after Configure get the settings of their nearest registered ancestor, and then those of
+// the configured names and patterns that select them more closely, such as xds.* for xds.ads.
+
+// scopeWildcard matches any sequence of characters in a scope pattern.
+const scopeWildcard = "*"
+
+// isScopePattern returns whether name holds a wildcard.
+func isScopePattern(name string) bool {
+	return strings.Contains(name, scopeWildcard)
+}
+
+// parentScopeName returns the name of the parent of a scope, or "" if it has none.
+func parentScopeName(name string) string {
+	if i := strings.LastIndexByte(name, '.'); i >= 0 {
+		return name[:i]
+	}
+	return ""
+}
+
+// matchRank returns how closely pattern selects the scope name, or -1 if it doesn't. The name of the
+// scope itself ranks highest, followed by longer patterns, and then by ancestors from the nearest.
+func matchRank(pattern, name string) int {
+	switch {
+	case pattern == name:
+		return 2*len(name) + 1
+	case isScopePattern(pattern):
+		if globMatch(pattern, name) {
+			return 2 * len(pattern)
+		}
+	case strings.HasPrefix(name, pattern+"."):
+		return 2 * len(pattern)
+	}
+	return -1
+}
+
+// globMatch returns whether name matches pattern, where '*' matches any sequence of characters.
+func globMatch(pattern, name string) bool {
+	// positions to backtrack to after the last wildcard
+	star, next := -1, 0
+	p, n := 0, 0
+	for n < len(name) {
+		switch {
+		case p < len(pattern) && pattern[p] == '*':
+			star, next = p, n
+			p++
+		case p < len(pattern) && pattern[p] == name[n]:
+			p++
+			n++
+		case star >= 0:
+			next++
+			p, n = star+1, next
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// MatchScopes returns the registered scopes selected by a scope name or pattern, sorted by name. A name
+// selects the scope and its descendants, while '*' in a pattern matches any sequence of characters.
+func MatchScopes(pattern string) []*Scope {
+	var out []*Scope
+	for name, s := range Scopes() {
+		if matchRank(pattern, name) >= 0 {
+			out = append(out, s)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].name < out[j].name })
+	return out
+}
+
+// scopeApplier applies a configured setting to a scope registered later, if the setting selects it with a
+// rank above minRank.
+type scopeApplier func(s *Scope, minRank int)
+
+var (
+	// laterSettings are the output level, stack trace level and caller settings of the last configuration,
+	// applied to the scopes registered since.
+	laterSettings   []scopeApplier
+	laterSettingsMu sync.Mutex
+)
+
+// setLaterSettings replaces the settings applied to the scopes registered later.
+func setLaterSettings(appliers ...scopeApplier) {
+	laterSettingsMu.Lock()
+	defer laterSettingsMu.Unlock()
+	laterSettings = appliers
+}
+
+// applyLaterSettings applies the settings of the last configuration that select s more closely than minRank.
+func applyLaterSettings(s *Scope, minRank int) {
+	laterSettingsMu.Lock()
+	defer laterSettingsMu.Unlock()
+	for _, apply := range laterSettings {
+		apply(s, minRank)
+	}
+}
+
+// bestMatch returns the index of the pattern that selects the scope name most closely, with later patterns
+// taking precedence over earlier ones of the same rank, along with its rank. It returns -1 if none does.
+func bestMatch(patterns []string, name string) (int, int) {
+	best, rank := -1, -1
+	for i, p := range patterns {
+		if r := matchRank(p, name); r >= 0 && r >= rank {
+			best, rank = i, r
+		}
+	}
+	return best, rank
+}
+
+// applyScoped applies per-scope values, given in the same order as the scope names or patterns they are
+// set for. Each scope gets the value of the entry that selects it most closely, with later entries taking
+// precedence over earlier ones of the same rank. It returns a scopeApplier applying the values to scopes
+// registered later.
+func applyScoped[T any](allScopes map[string]*Scope, patterns []string, values []T, setter func(*Scope, T)) scopeApplier {
+	for name, scope := range allScopes {
+		if best, _ := bestMatch(patterns, name); best >= 0 {
+			setter(scope, values[best])
+		}
+	}
+	return func(s *Scope, minRank int) {
+		if best, rank := bestMatch(patterns, s.name); best >= 0 && rank > minRank {
+			setter(s, values[best])
+		}
+	}
+}
+
+// inheritSettings copies the output level, stack trace level and caller setting of the nearest
+// registered ancestor of s, if any, and returns the rank with which the ancestor selects s, or -1.
+// It must be called with the scopes lock held.
+func inheritSettings(s *Scope) int {
+	for name := parentScopeName(s.name); name != ""; name = parentScopeName(name) {
+		if parent, ok := scopes[name]; ok {
+			s.SetOutputLevel(parent.GetOutputLevel())
+			s.SetStackTraceLevel(parent.GetStackTraceLevel())
+			s.SetLogCallers(parent.GetLogCallers())
+			return matchRank(name, s.name)
+		}
+	}
+	return -1
+}
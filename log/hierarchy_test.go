@@ -0,0 +1,156 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"testing"
+)
+
+func TestGlobMatch(t *testing.T) {
+	cases := []struct {
+		pattern string
+		name    string
+		match   bool
+	}{
+		{"xds.*", "xds.ads", true},
+		{"xds.*", "xds.ads.push", true},
+		{"xds.*", "xds", false},
+		{"*.delta", "xds.delta", true},
+		{"*.delta", "xds.deltas", false},
+		{"x*s.a*", "xds.ads", true},
+		{"*", "default", true},
+		{"**", "", true},
+		{"a*b", "ab", true},
+		{"a*b", "a.c", false},
+	}
+	for _, c := range cases {
+		if got := globMatch(c.pattern, c.name); got != c.match {
+			t.Errorf("Got %v for %s matching %s, expecting %v", got, c.pattern, c.name, c.match)
+		}
+	}
+}
+
+func TestHierarchicalLevels(t *testing.T) {
+	resetGlobals()
+	defer func() {
+		resetGlobals()
+		_ = Configure(DefaultOptions())
+	}()
+
+	xds := RegisterScope("xds", "")
+	ads := RegisterScope("xds.ads", "")
+	push := RegisterScope("xds.ads.push", "")
+	delta := RegisterScope("xds.delta", "")
+	other := RegisterScope("xdsother", "")
+
+	o := DefaultOptions()
+	o.SetOutputLevel("xds", WarnLevel)
+	o.SetOutputLevel("xds.*", DebugLevel)
+	o.SetOutputLevel("xds.delta", ErrorLevel)
+	o.SetStackTraceLevel("xds.ads", ErrorLevel)
+	o.SetLogCallers("xds.ads", true)
+	o.SetSampling("*.delta", Sampling{Interval: 1, First: 1})
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got %v, expecting success", err)
+	}
+
+	for s, want := range map[*Scope]Level{xds: WarnLevel, ads: DebugLevel, push: DebugLevel, delta: ErrorLevel, other: InfoLevel} {
+		if got := s.GetOutputLevel(); got != want {
+			t.Errorf("Got %v for %s, expecting %v", got, s.Name(), want)
+		}
+	}
+	if push.GetStackTraceLevel() != ErrorLevel || !push.GetLogCallers() || xds.GetLogCallers() || delta.GetLogCallers() {
+		t.Errorf("Got %v %v %v %v, expecting descendants to inherit settings",
+			push.GetStackTraceLevel(), push.GetLogCallers(), xds.GetLogCallers(), delta.GetLogCallers())
+	}
+	if !delta.GetSampling().Enabled() || ads.GetSampling().Enabled() {
+		t.Errorf("Got %v %v, expecting sampling only for xds.delta", delta.GetSampling(), ads.GetSampling())
+	}
+
+	// scopes registered later start with the settings of their nearest ancestor
+	late := RegisterScope("xds.ads.late", "")
+	if late.GetOutputLevel() != DebugLevel || late.GetStackTraceLevel() != ErrorLevel || !late.GetLogCallers() {
+		t.Errorf("Got %v %v %v, expecting settings of xds.ads",
+			late.GetOutputLevel(), late.GetStackTraceLevel(), late.GetLogCallers())
+	}
+
+	matched := MatchScopes("xds.ads")
+	if len(matched) != 3 || matched[0] != ads || matched[1] != late || matched[2] != push {
+		t.Errorf("Got %v, expecting xds.ads and its descendants", matched)
+	}
+	if matched := MatchScopes("*.delta"); len(matched) != 1 || matched[0] != delta {
+		t.Errorf("Got %v, expecting xds.delta", matched)
+	}
+}
+
+func TestHierarchicalOverride(t *testing.T) {
+	resetGlobals()
+	defer func() {
+		resetGlobals()
+		_ = Configure(DefaultOptions())
+	}()
+
+	a := RegisterScope("hier", "")
+	b := RegisterScope("hier.child", "")
+	o := DefaultOptions()
+	o.SetOutputLevel("hier.*", DebugLevel)
+	o.SetOutputLevel(OverrideScopeName, ErrorLevel)
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got %v, expecting success", err)
+	}
+	if a.GetOutputLevel() != ErrorLevel || b.GetOutputLevel() != ErrorLevel {
+		t.Errorf("Got %v %v, expecting the override to replace everything", a.GetOutputLevel(), b.GetOutputLevel())
+	}
+	if late := RegisterScope("hierlate", ""); late.GetOutputLevel() != ErrorLevel {
+		t.Errorf("Got %v, expecting the override to apply to scopes registered later", late.GetOutputLevel())
+	}
+}
+
+func TestHierarchicalLaterScopes(t *testing.T) {
+	resetGlobals()
+	defer func() {
+		resetGlobals()
+		_ = Configure(DefaultOptions())
+	}()
+
+	parent := RegisterScope("later", "")
+	o := DefaultOptions()
+	o.SetOutputLevel("later.*", DebugLevel)
+	o.SetOutputLevel("unregistered", WarnLevel)
+	o.SetStackTraceLevel("*.stack", ErrorLevel)
+	o.SetLogCallers("later.callers", true)
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got %v, expecting success", err)
+	}
+
+	// patterns and names that select scopes more closely than their ancestors apply to scopes registered later
+	a := RegisterScope("later.a", "")
+	stack := RegisterScope("later.stack", "")
+	callers := RegisterScope("later.callers", "")
+	child := RegisterScope("unregistered.child", "")
+	if parent.GetOutputLevel() != InfoLevel || a.GetOutputLevel() != DebugLevel || child.GetOutputLevel() != WarnLevel {
+		t.Errorf("Got %v %v %v, expecting the configured levels", parent.GetOutputLevel(), a.GetOutputLevel(), child.GetOutputLevel())
+	}
+	if stack.GetStackTraceLevel() != ErrorLevel || a.GetStackTraceLevel() != NoneLevel || !callers.GetLogCallers() || a.GetLogCallers() {
+		t.Errorf("Got %v %v %v %v, expecting the configured stack trace and caller settings",
+			stack.GetStackTraceLevel(), a.GetStackTraceLevel(), callers.GetLogCallers(), a.GetLogCallers())
+	}
+
+	// changes made to the nearest ancestor since are kept, as it selects the scope as closely
+	a.SetOutputLevel(ErrorLevel)
+	if b := RegisterScope("later.a.b", ""); b.GetOutputLevel() != ErrorLevel {
+		t.Errorf("Got %v, expecting the level of later.a", b.GetOutputLevel())
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+const defaultShutdownTimeout = 5 * time.Second
+
+// ShutdownHook flushes or cleans up a component before the process exits. It should return once ctx is done.
+type ShutdownHook func(ctx context.Context) error
+
+type shutdownHook struct {
+	name string
+	hook ShutdownHook
+}
+
+var (
+	shutdownHooks   []*shutdownHook
+	shutdownHooksMu sync.Mutex
+
+	// shutdownTimeout bounds the time spent running the hooks and closing the log sinks, see
+	// Options.ShutdownTimeout.
+	shutdownTimeout atomic.Int64
+)
+
+func init() {
+	shutdownTimeout.Store(int64(defaultShutdownTimeout))
+}
+
+// RegisterShutdownHook registers a hook run before the process exits because of a fatal message, and by Close.
+// Hooks run in the reverse order of their registration, before the log sinks are closed, so that they can
+// still log. They share a deadline, set with Options.ShutdownTimeout, after which the remaining hooks are
+// skipped. It returns a function that removes the hook.
+func RegisterShutdownHook(name string, hook ShutdownHook) (remove func()) {
+	shutdownHooksMu.Lock()
+	defer shutdownHooksMu.Unlock()
+	h := &shutdownHook{name: name, hook: hook}
+	shutdownHooks = append(shutdownHooks, h)
+
+	return func() {
+		shutdownHooksMu.Lock()
+		defer shutdownHooksMu.Unlock()
+		out := make([]*shutdownHook, 0, len(shutdownHooks))
+		for _, sh := range shutdownHooks {
+			if sh != h {
+				out = append(out, sh)
+			}
+		}
+		shutdownHooks = out
+	}
+}
+
+// shutdown runs the shutdown hooks, and then closes the log sinks with closeSinks. It gives up waiting once
+// the shutdown timeout passes.
+func shutdown(closeSinks func() error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(shutdownTimeout.Load()))
+	defer cancel()
+
+	shutdownHooksMu.Lock()
+	hooks := append([]*shutdownHook(nil), shutdownHooks...)
+	shutdownHooksMu.Unlock()
+
+	var errs []error
+	for i := len(hooks) - 1; i >= 0; i-- {
+		h := hooks[i]
+		if err := runWithDeadline(ctx, func() error { return h.hook(ctx) }); err != nil {
+			errs = append(errs, fmt.Errorf("shutdown hook %s: %v", h.name, err))
+		}
+	}
+	if err := runWithDeadline(ctx, closeSinks); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// runWithDeadline runs f, returning early if ctx is done first.
+func runWithDeadline(ctx context.Context, f func() error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- f()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// fatalHook runs the shutdown hooks and closes the log sinks before exiting, when the global zap logger
+// logs a fatal message.
+type fatalHook struct{}
+
+// OnWrite implements zapcore.CheckWriteHook.
+func (fatalHook) OnWrite(*zapcore.CheckedEntry, []zapcore.Field) {
+	exitAfterShutdown()
+}
+
+// exitAfterShutdown runs the shutdown hooks, closes the log sinks and exits the process.
+func exitAfterShutdown() {
+	pt := funcs.Load().(patchTable)
+	if err := shutdown(pt.close); err != nil {
+		_, _ = fmt.Fprintf(pt.errorSink, "%v log shutdown error: %v\n", time.Now(), err)
+		_ = pt.errorSink.Sync()
+	}
+	pt.exitProcess(1)
+}
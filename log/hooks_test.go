@@ -0,0 +1,130 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// configureWithExit configures logging to a file, recording exits in calls rather than exiting.
+func configureWithExit(t *testing.T, o *Options, calls *[]string) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "out.log")
+	o.OutputPaths = []string{file}
+	if err := Configure(o); err != nil {
+		t.Fatalf("Unable to configure logging: %v", err)
+	}
+	pt := funcs.Load().(patchTable)
+	pt.exitProcess = func(int) {
+		*calls = append(*calls, "exit")
+	}
+	funcs.Store(pt)
+	t.Cleanup(func() {
+		_ = Configure(DefaultOptions())
+	})
+	return file
+}
+
+func TestShutdownHooksOnFatal(t *testing.T) {
+	var calls []string
+	file := configureWithExit(t, DefaultOptions(), &calls)
+
+	defer RegisterShutdownHook("first", func(context.Context) error {
+		calls = append(calls, "first")
+		return nil
+	})()
+	defer RegisterShutdownHook("second", func(context.Context) error {
+		calls = append(calls, "second")
+		Info("flushing")
+		return nil
+	})()
+
+	Fatal("fatal")
+	if got := strings.Join(calls, ","); got != "second,first,exit" {
+		t.Errorf("Got calls %s, expecting second,first,exit", got)
+	}
+
+	content, _ := os.ReadFile(file)
+	if !strings.Contains(string(content), "fatal") || !strings.Contains(string(content), "flushing") {
+		t.Errorf("Got %s, expecting the fatal message and the output of the hooks", content)
+	}
+
+	// fatal messages of the global zap logger exit the same way
+	calls = nil
+	zap.L().Fatal("zap fatal")
+	if got := strings.Join(calls, ","); got != "second,first,exit" {
+		t.Errorf("Got calls %s, expecting second,first,exit", got)
+	}
+}
+
+func TestShutdownHooksOnClose(t *testing.T) {
+	var calls []string
+	o := DefaultOptions()
+	o.ShutdownTimeout = 50 * time.Millisecond
+	configureWithExit(t, o, &calls)
+
+	var mu sync.Mutex
+	record := func(name string) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls = append(calls, name)
+	}
+	defer RegisterShutdownHook("skipped", func(context.Context) error {
+		record("skipped")
+		return nil
+	})()
+	defer RegisterShutdownHook("stuck", func(ctx context.Context) error {
+		record("stuck")
+		<-ctx.Done()
+		return nil
+	})()
+	remove := RegisterShutdownHook("failing", func(context.Context) error {
+		record("failing")
+		return errors.New("boom")
+	})
+
+	start := time.Now()
+	err := Close()
+	if err == nil || !strings.Contains(err.Error(), "shutdown hook failing: boom") || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Got %v, expecting the failing hook and the deadline to be reported", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Got Close taking %v, expecting it to give up after the shutdown timeout", d)
+	}
+	mu.Lock()
+	if got := strings.Join(calls, ","); got != "failing,stuck" {
+		t.Errorf("Got calls %s, expecting failing,stuck", got)
+	}
+	calls = nil
+	mu.Unlock()
+
+	// removed hooks are no longer run
+	remove()
+	_ = Close()
+	mu.Lock()
+	defer mu.Unlock()
+	if got := strings.Join(calls, ","); strings.Contains(got, "failing") {
+		t.Errorf("Got calls %s, expecting the removed hook not to run", got)
+	}
+}
@@ -0,0 +1,215 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap/zapcore"
+)
+
+const defaultJournaldSocket = "/run/systemd/journal/socket"
+
+// journaldWriter sends entries to the journal using its native protocol, shared by all cores of a
+// configuration. Each entry is a single datagram holding a list of fields, or a memory file passed along
+// with an empty datagram if it is too large for one.
+//
+// See: https://systemd.io/JOURNAL_NATIVE_PROTOCOL/
+type journaldWriter struct {
+	conn       *net.UnixConn
+	socket     string
+	identifier string
+}
+
+func newJournaldWriter(socket string) (*journaldWriter, error) {
+	if socket == "" {
+		socket = defaultJournaldSocket
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to journald socket %s: %v", socket, err)
+	}
+	return &journaldWriter{
+		conn:       conn,
+		socket:     socket,
+		identifier: filepath.Base(os.Args[0]),
+	}, nil
+}
+
+func (w *journaldWriter) write(msg []byte) error {
+	_, err := w.conn.Write(msg)
+	if err != nil && tooLarge(err) {
+		err = w.writeLarge(msg)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write log to journald socket %s: %v", w.socket, err)
+	}
+	return nil
+}
+
+func (w *journaldWriter) close() error {
+	return w.conn.Close()
+}
+
+// format renders an entry as journal fields. Labels and error details become fields named after
+// their uppercased keys.
+func (w *journaldWriter) format(entry zapcore.Entry, with, fields []zapcore.Field) []byte {
+	scope, msg, attrs, tc := structuredEntry(entry, with, fields)
+
+	var b bytes.Buffer
+	if entry.Stack != "" {
+		msg += "\n" + entry.Stack
+	}
+	writeJournaldField(&b, "MESSAGE", msg)
+	writeJournaldField(&b, "PRIORITY", strconv.Itoa(syslogSeverityMapping[entry.Level]))
+	writeJournaldField(&b, "SYSLOG_IDENTIFIER", w.identifier)
+	writeJournaldField(&b, "ISTIO_SCOPE", scope)
+	if entry.Caller.Defined {
+		writeJournaldField(&b, "CODE_FILE", entry.Caller.File)
+		writeJournaldField(&b, "CODE_LINE", strconv.Itoa(entry.Caller.Line))
+		if entry.Caller.Function != "" {
+			writeJournaldField(&b, "CODE_FUNC", entry.Caller.Function)
+		}
+	}
+	if tc != nil {
+		writeJournaldField(&b, "TRACE_ID", tc.TraceID)
+		writeJournaldField(&b, "SPAN_ID", tc.SpanID)
+	}
+
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if name := journaldFieldName(k); name != "" {
+			writeJournaldField(&b, name, fmt.Sprint(attrs[k]))
+		}
+	}
+	return b.Bytes()
+}
+
+// writeJournaldField writes a field, using the binary form for values that span several lines.
+func writeJournaldField(b *bytes.Buffer, name, value string) {
+	b.WriteString(name)
+	if !strings.Contains(value, "\n") {
+		b.WriteByte('=')
+		b.WriteString(value)
+		b.WriteByte('\n')
+		return
+	}
+	b.WriteByte('\n')
+	_ = binary.Write(b, binary.LittleEndian, uint64(len(value)))
+	b.WriteString(value)
+	b.WriteByte('\n')
+}
+
+// journaldReservedFields are the fields written by journaldWriter or interpreted by the journal. Labels
+// converted to one of these names are prefixed with LABEL_ instead, so that they don't replace them.
+var journaldReservedFields = map[string]bool{
+	"MESSAGE":           true,
+	"MESSAGE_ID":        true,
+	"PRIORITY":          true,
+	"ERRNO":             true,
+	"SYSLOG_FACILITY":   true,
+	"SYSLOG_IDENTIFIER": true,
+	"SYSLOG_PID":        true,
+	"SYSLOG_TIMESTAMP":  true,
+	"SYSLOG_RAW":        true,
+	"ISTIO_SCOPE":       true,
+	"CODE_FILE":         true,
+	"CODE_LINE":         true,
+	"CODE_FUNC":         true,
+	"TRACE_ID":          true,
+	"SPAN_ID":           true,
+}
+
+// journaldFieldName converts a key into a valid field name, made of at most 64 uppercase letters,
+// digits and underscores, and starting with a letter. It returns "" if no such name can be derived.
+func journaldFieldName(key string) string {
+	b := []byte(strings.ToUpper(key))
+	for i, c := range b {
+		if !(c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			b[i] = '_'
+		}
+	}
+	name := strings.TrimLeft(string(b), "_0123456789")
+	if journaldReservedFields[name] {
+		name = "LABEL_" + name
+	}
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return name
+}
+
+// A journaldCore writes entries to the journal.
+type journaldCore struct {
+	writer       *journaldWriter
+	minimumLevel zapcore.Level
+	fields       []zapcore.Field
+}
+
+// teeToJournald returns a zapcore.Core that writes entries to both the provided core and to the journal.
+func teeToJournald(baseCore zapcore.Core, writer *journaldWriter) zapcore.Core {
+	jc := &journaldCore{writer: writer}
+	for l := zapcore.DebugLevel; l <= zapcore.FatalLevel; l++ {
+		if baseCore.Enabled(l) {
+			jc.minimumLevel = l
+			break
+		}
+	}
+	return zapcore.NewTee(baseCore, jc)
+}
+
+// Enabled implements zapcore.Core.
+func (jc *journaldCore) Enabled(l zapcore.Level) bool {
+	return l >= jc.minimumLevel
+}
+
+// With implements zapcore.Core.
+func (jc *journaldCore) With(fields []zapcore.Field) zapcore.Core {
+	return &journaldCore{
+		writer:       jc.writer,
+		minimumLevel: jc.minimumLevel,
+		fields:       append(jc.fields[:len(jc.fields):len(jc.fields)], fields...),
+	}
+}
+
+// Check implements zapcore.Core.
+func (jc *journaldCore) Check(e zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if jc.Enabled(e.Level) {
+		return ce.AddCore(e, jc)
+	}
+	return ce
+}
+
+// Sync implements zapcore.Core. Entries are written as they are logged, so there is nothing to flush.
+func (jc *journaldCore) Sync() error {
+	return nil
+}
+
+// Write implements zapcore.Core. It writes a log entry to the journal.
+func (jc *journaldCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	return jc.writer.write(jc.writer.format(entry, jc.fields, fields))
+}
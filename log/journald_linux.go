@@ -0,0 +1,62 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// tooLarge returns whether a write failed because the entry doesn't fit in a datagram.
+func tooLarge(err error) bool {
+	return errors.Is(err, unix.EMSGSIZE) || errors.Is(err, unix.ENOBUFS)
+}
+
+// writeLarge passes an entry that doesn't fit in a datagram to journald as a sealed memory file, sent
+// along with an empty datagram, as the native protocol allows.
+func (w *journaldWriter) writeLarge(msg []byte) error {
+	fd, err := unix.MemfdCreate("journald", unix.MFD_ALLOW_SEALING|unix.MFD_CLOEXEC)
+	if err != nil {
+		return fmt.Errorf("unable to create memory file: %v", err)
+	}
+	f := os.NewFile(uintptr(fd), "journald")
+	defer f.Close()
+
+	if _, err := f.Write(msg); err != nil {
+		return fmt.Errorf("unable to write memory file: %v", err)
+	}
+	// journald only accepts memory files that can no longer change
+	seals := unix.F_SEAL_SHRINK | unix.F_SEAL_GROW | unix.F_SEAL_WRITE | unix.F_SEAL_SEAL
+	if _, err := unix.FcntlInt(f.Fd(), unix.F_ADD_SEALS, seals); err != nil {
+		return fmt.Errorf("unable to seal memory file: %v", err)
+	}
+
+	// the connection is connected, which WriteMsgUnix doesn't allow for datagrams
+	rc, err := w.conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var sendErr error
+	if err := rc.Write(func(fd uintptr) bool {
+		sendErr = unix.Sendmsg(int(fd), nil, unix.UnixRights(int(f.Fd())), nil, 0)
+		return sendErr != unix.EAGAIN
+	}); err != nil {
+		return err
+	}
+	return sendErr
+}
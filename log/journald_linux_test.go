@@ -0,0 +1,79 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestJournaldLargeEntry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	w, err := newJournaldWriter(path)
+	if err != nil {
+		t.Fatalf("Got %v, expecting success", err)
+	}
+	defer w.close()
+
+	// the entry exceeds the largest datagram the socket accepts
+	msg := []byte("MESSAGE=" + strings.Repeat("x", 1<<20) + "\n")
+	if err := w.write(msg); err != nil {
+		t.Fatalf("Got %v, expecting success", err)
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 16)
+	oob := make([]byte, unix.CmsgSpace(4))
+	n, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Errorf("Got a datagram of %d bytes, expecting an empty one", n)
+	}
+	msgs, err := unix.ParseSocketControlMessage(oob[:oobn])
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("Got %v %v, expecting a control message", msgs, err)
+	}
+	fds, err := unix.ParseUnixRights(&msgs[0])
+	if err != nil || len(fds) != 1 {
+		t.Fatalf("Got %v %v, expecting a file descriptor", fds, err)
+	}
+	f := os.NewFile(uintptr(fds[0]), "journald")
+	defer f.Close()
+
+	seals, err := unix.FcntlInt(f.Fd(), unix.F_GET_SEALS, 0)
+	if err != nil || seals&unix.F_SEAL_WRITE == 0 {
+		t.Errorf("Got seals %x %v, expecting the memory file to be sealed", seals, err)
+	}
+	// the file offset is shared with the writer, so the file is read from its start
+	content, err := io.ReadAll(io.NewSectionReader(f, 0, int64(len(msg))+1))
+	if err != nil || string(content) != string(msg) {
+		t.Errorf("Got %d bytes %v, expecting the entry", len(content), err)
+	}
+}
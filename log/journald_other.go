@@ -0,0 +1,28 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux
+
+package log
+
+// tooLarge returns whether a write failed because the entry doesn't fit in a datagram. Entries are only
+// passed in memory files on Linux, where journald runs.
+func tooLarge(error) bool {
+	return false
+}
+
+// writeLarge is never called, as no entry is too large.
+func (w *journaldWriter) writeLarge([]byte) error {
+	return nil
+}
@@ -0,0 +1,110 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"istio.io/pkg/structured"
+)
+
+// parseJournald decodes the fields of a native protocol datagram.
+func parseJournald(t *testing.T, msg []byte) map[string]string {
+	t.Helper()
+	out := make(map[string]string)
+	for len(msg) > 0 {
+		nl := bytes.IndexByte(msg, '\n')
+		if nl < 0 {
+			t.Fatalf("Got %q, expecting a field terminated by a newline", msg)
+		}
+		line := string(msg[:nl])
+		msg = msg[nl+1:]
+		if k, v, ok := strings.Cut(line, "="); ok {
+			out[k] = v
+			continue
+		}
+		n := binary.LittleEndian.Uint64(msg[:8])
+		out[line] = string(msg[8 : 8+n])
+		msg = msg[8+n+1:]
+	}
+	return out
+}
+
+func TestJournald(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.sock")
+	conn, err := net.ListenPacket("unixgram", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	resetGlobals()
+	s := RegisterScope("testJournald", "")
+	o := DefaultOptions()
+	o.SetLogCallers("testJournald", true)
+	o.WithTeeToJournald(path)
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got %v, expecting success", err)
+	}
+	defer func() {
+		_ = Close()
+		resetGlobals()
+		_ = Configure(DefaultOptions())
+	}()
+
+	s.WithLabels("request-id", "abc", "9lives", "x", "message", "label", "Priority", "high", "trace-id", "t").Warn("two\nlines")
+	s.Errorf(&structured.Error{MoreInfo: "more", Err: errors.New("boom")}, "failed")
+
+	msgs := readPackets(t, conn, 2)
+	f := parseJournald(t, []byte(msgs[0]))
+	for k, want := range map[string]string{
+		"MESSAGE":     "two\nlines",
+		"PRIORITY":    "4",
+		"ISTIO_SCOPE": "testJournald",
+		"REQUEST_ID":  "abc",
+		"LIVES":       "x",
+		// labels named like the fields of the entry don't replace them
+		"LABEL_MESSAGE":  "label",
+		"LABEL_PRIORITY": "high",
+		"LABEL_TRACE_ID": "t",
+	} {
+		if f[k] != want {
+			t.Errorf("Got %s=%q, expecting %q", k, f[k], want)
+		}
+	}
+	if !strings.HasSuffix(f["CODE_FILE"], "journald_test.go") || f["CODE_LINE"] == "" || f["SYSLOG_IDENTIFIER"] == "" {
+		t.Errorf("Got %v, expecting caller and identifier fields", f)
+	}
+
+	f = parseJournald(t, []byte(msgs[1]))
+	if f["MESSAGE"] != "failed" || f["PRIORITY"] != "3" || f["ERR"] != "boom" || f["MOREINFO"] != "more" {
+		t.Errorf("Got %v, expecting error entry with details", f)
+	}
+}
+
+func TestJournaldMissingSocket(t *testing.T) {
+	defer func() { _ = Configure(DefaultOptions()) }()
+	o := DefaultOptions()
+	o.WithTeeToJournald(filepath.Join(t.TempDir(), "missing.sock"))
+	if err := Configure(o); err == nil || !strings.Contains(err.Error(), "unable to connect to journald socket") {
+		t.Errorf("Got %v, expecting a connection error", err)
+	}
+}
@@ -17,41 +17,71 @@ package log
 import (
 	goflag "flag"
 	"fmt"
+	"strconv"
 	"sync"
+	"sync/atomic"
 
 	"github.com/spf13/pflag"
 	"k8s.io/klog/v2"
 )
 
+// klog filters verbose messages with a global verbosity before they reach KlogScope. That verbosity follows
+// the output level of KlogScope instead of being set once: it is 0 unless the scope is at debug level, and
+// then the one requested with --vklog or EnableKlogWithVerbosity, or defaultKlogDebugVerbosity if none was.
+// Changing the level of the scope, for instance through ControlZ, thus changes the output of Kubernetes
+// libraries at runtime.
+
+// defaultKlogDebugVerbosity is the klog verbosity while KlogScope is at debug level, unless another one was
+// requested. Kubernetes conventions reserve verbosity 4 and above for debug output.
+const defaultKlogDebugVerbosity = 4
+
 var (
-	KlogScope     = RegisterScope("klog", "")
+	KlogScope     = RegisterScope(KlogScopeName, "")
 	configureKlog = sync.Once{}
+
+	// klogRequestedVerbosity is the verbosity set with --vklog or EnableKlogWithVerbosity.
+	klogRequestedVerbosity = &klogVerbosity{}
 )
 
+// klogVerbosity is the value of the --vklog flag.
+type klogVerbosity struct {
+	v atomic.Int32
+}
+
+func (k *klogVerbosity) String() string {
+	return strconv.Itoa(int(k.v.Load()))
+}
+
+func (k *klogVerbosity) Set(value string) error {
+	v, err := strconv.Atoi(value)
+	if err != nil || v < 0 {
+		return fmt.Errorf("invalid klog verbosity '%s'", value)
+	}
+	k.v.Store(int32(v))
+	return nil
+}
+
+func (k *klogVerbosity) Type() string {
+	return "int"
+}
+
 // EnableKlogWithCobra enables klog to work with cobra / pflags.
 // k8s libraries like client-go use klog.
 func EnableKlogWithCobra() {
 	gf := klogVerboseFlag()
-	pflag.CommandLine.AddFlag(pflag.PFlagFromGoFlag(
-		&goflag.Flag{
-			Name:     "vklog",
-			Value:    gf.Value,
-			DefValue: gf.DefValue,
-			Usage:    gf.Usage + ". Like -v flag. ex: --vklog=9",
-		}))
+	pflag.CommandLine.Var(klogRequestedVerbosity, "vklog", gf.Usage+". Like -v flag. ex: --vklog=9")
 }
 
 // EnableKlogWithCobra enables klog to work with go flags.
 // k8s libraries like client-go use klog.
 func EnableKlogWithGoFlag() {
 	gf := klogVerboseFlag()
-	goflag.CommandLine.Var(gf.Value, "vklog", gf.Usage+". Like -v flag. ex: --vklog=9")
+	goflag.CommandLine.Var(klogRequestedVerbosity, "vklog", gf.Usage+". Like -v flag. ex: --vklog=9")
 }
 
-// isKlogVerbose returns true if klog verbosity is non-zero.
+// isKlogVerbose returns true if the requested klog verbosity is non-zero.
 func klogVerbose() bool {
-	gf := klogVerboseFlag()
-	return gf.Value.String() != "0"
+	return klogRequestedVerbosity.v.Load() != 0
 }
 
 var (
@@ -69,8 +99,25 @@ func klogVerboseFlag() *goflag.Flag {
 	return klogFlagSet.Lookup("v")
 }
 
-// EnableKlogWithVerbosity sets the klog verbosity directly.
+// setKlogVerbosity sets the verbosity of klog for the given output level of KlogScope.
+func setKlogVerbosity(l Level) {
+	v := 0
+	if l >= DebugLevel {
+		v = int(klogRequestedVerbosity.v.Load())
+		if v == 0 {
+			v = defaultKlogDebugVerbosity
+		}
+	}
+	_ = klogVerboseFlag().Value.Set(strconv.Itoa(v))
+}
+
+// EnableKlogWithVerbosity sets the klog verbosity directly. It is in effect while KlogScope is at debug
+// level, which Configure sets if v is non-zero.
 // When using in an application, EnableKlogWithCobra is preferred to expose a --vklog flag.
 func EnableKlogWithVerbosity(v int) {
-	_ = klogFlagSet.Set("v", fmt.Sprint(v))
+	if v < 0 {
+		v = 0
+	}
+	klogRequestedVerbosity.v.Store(int32(v))
+	setKlogVerbosity(KlogScope.GetOutputLevel())
 }
@@ -0,0 +1,174 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// LevelRule enables output up to Level for the log calls of a scope whose labels, added with WithLabels,
+// hold all of the given values. This allows e.g. debug output for a single proxy without enabling it for
+// the whole scope.
+type LevelRule struct {
+	Level  Level
+	Labels map[string]string
+}
+
+// String returns the rule in the <level>:<key>=<value>&<key>=<value>... form accepted by ParseLevelRule.
+func (r LevelRule) String() string {
+	keys := make([]string, 0, len(r.Labels))
+	for k := range r.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	labels := make([]string, 0, len(keys))
+	for _, k := range keys {
+		labels = append(labels, k+"="+r.Labels[k])
+	}
+	return levelToString[r.Level] + ":" + strings.Join(labels, "&")
+}
+
+// ParseLevelRule parses a rule in the <level>:<key>=<value>&<key>=<value>... form, e.g. debug:proxy=foo.ns.
+func ParseLevelRule(arg string) (LevelRule, error) {
+	l, labels, ok := strings.Cut(arg, ":")
+	if !ok || labels == "" {
+		return LevelRule{}, fmt.Errorf("invalid level rule format '%s'", arg)
+	}
+	level, ok := stringToLevel[l]
+	if !ok {
+		return LevelRule{}, fmt.Errorf("invalid level rule level '%s'", arg)
+	}
+
+	r := LevelRule{Level: level, Labels: make(map[string]string)}
+	for _, kv := range strings.Split(labels, "&") {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok || k == "" {
+			return LevelRule{}, fmt.Errorf("invalid level rule label '%s'", arg)
+		}
+		r.Labels[k] = v
+	}
+	return r, nil
+}
+
+// convertScopedLevelRule parses a <scope>:<level>:<key>=<value>&... entry.
+func convertScopedLevelRule(sr string) (string, LevelRule, error) {
+	scope, arg, ok := strings.Cut(sr, ":")
+	if !ok {
+		return "", LevelRule{}, fmt.Errorf("invalid level rule format '%s'", sr)
+	}
+	r, err := ParseLevelRule(arg)
+	return scope, r, err
+}
+
+// matches returns whether the labels of s hold all values of the rule.
+func (r LevelRule) matches(s *Scope) bool {
+	for k, want := range r.Labels {
+		v, ok := s.labels[k]
+		if !ok {
+			return false
+		}
+		if str, isString := v.(string); isString {
+			if str != want {
+				return false
+			}
+		} else if fmt.Sprint(v) != want {
+			return false
+		}
+	}
+	return true
+}
+
+// levelRules holds the level rules of a scope. The copies of the scope made by WithLabels share it, so
+// that rules set later apply to them, as the labels they match are those of the copies.
+type levelRules struct {
+	rules atomic.Value
+}
+
+// SetLevelRules replaces the level rules of the scope, and of the copies made with WithLabels.
+func (s *Scope) SetLevelRules(rules []LevelRule) {
+	if s.levelRules == nil {
+		return
+	}
+	if len(rules) == 0 {
+		rules = nil
+	}
+	s.levelRules.rules.Store(rules)
+}
+
+// GetLevelRules returns the level rules of the scope.
+func (s *Scope) GetLevelRules() []LevelRule {
+	if s.levelRules == nil {
+		return nil
+	}
+	rules, _ := s.levelRules.rules.Load().([]LevelRule)
+	return rules
+}
+
+// enabled returns whether s outputs messages at level l, either because of its output level or because
+// a level rule matches its labels. Rules are only evaluated for scopes that have any.
+func (s *Scope) enabled(l Level) bool {
+	return s.GetOutputLevel() >= l || s.ruleMatched(l)
+}
+
+// ruleMatched returns whether a level rule of s enables messages at level l for its labels.
+func (s *Scope) ruleMatched(l Level) bool {
+	for _, r := range s.GetLevelRules() {
+		if r.Level >= l && r.matches(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// ruleEnabled returns whether any level rule of s could enable messages at level l.
+func (s *Scope) ruleEnabled(l Level) bool {
+	for _, r := range s.GetLevelRules() {
+		if r.Level >= l {
+			return true
+		}
+	}
+	return false
+}
+
+// processLevelRules breaks down an argument string into a set of scope & level rules and then sets
+// them on the scopes, including the descendants of the named scopes and the scopes matching patterns.
+// It supports the use of a global override. The rules of scopes not selected by any entry are removed, so
+// that rules dropped from the options no longer apply once they are reapplied.
+func processLevelRules(allScopes map[string]*Scope, arg string, setter func(*Scope, []LevelRule)) error {
+	rules := make(map[*Scope][]LevelRule, len(allScopes))
+	for _, sr := range strings.Split(arg, ",") {
+		if sr == "" {
+			continue
+		}
+		name, r, err := convertScopedLevelRule(sr)
+		if err != nil {
+			return err
+		}
+		for scopeName, scope := range allScopes {
+			if name == OverrideScopeName || matchRank(name, scopeName) >= 0 {
+				rules[scope] = append(rules[scope], r)
+			}
+		}
+	}
+
+	for _, scope := range allScopes {
+		setter(scope, rules[scope])
+	}
+	return nil
+}
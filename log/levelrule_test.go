@@ -0,0 +1,149 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseLevelRule(t *testing.T) {
+	r, err := ParseLevelRule("debug:proxy=foo.ns&port=80")
+	if err != nil {
+		t.Fatalf("Got %v, expecting success", err)
+	}
+	if r.Level != DebugLevel || r.Labels["proxy"] != "foo.ns" || r.Labels["port"] != "80" {
+		t.Errorf("Got %+v, expecting debug for proxy foo.ns and port 80", r)
+	}
+	if r.String() != "debug:port=80&proxy=foo.ns" {
+		t.Errorf("Got %s, expecting the parsed form", r.String())
+	}
+
+	for _, bad := range []string{"debug", "debug:", "loud:a=b", "debug:a", "debug:=b"} {
+		if _, err := ParseLevelRule(bad); err == nil {
+			t.Errorf("Expecting %q to be rejected", bad)
+		}
+	}
+}
+
+func TestLevelRules(t *testing.T) {
+	resetGlobals()
+	defer func() {
+		resetGlobals()
+		_ = Configure(DefaultOptions())
+	}()
+
+	s := RegisterScope("testLevelRules", "")
+	child := RegisterScope("testLevelRules.child", "")
+	other := RegisterScope("testLevelRulesOther", "")
+	// labeled copies made before the rules are set follow them
+	proxy := s.WithLabels("proxy", "foo.ns")
+
+	path := filepath.Join(t.TempDir(), "out.log")
+	o := DefaultOptions()
+	o.OutputPaths = []string{path}
+	o.AddLevelRule("testLevelRules", LevelRule{Level: DebugLevel, Labels: map[string]string{"proxy": "foo.ns"}})
+	o.AddLevelRule("testLevelRules", LevelRule{Level: InfoLevel, Labels: map[string]string{"port": "80"}})
+	if rules, err := o.GetLevelRules("testLevelRules"); err != nil || len(rules) != 2 {
+		t.Errorf("Got %v %v, expecting 2 rules", rules, err)
+	}
+	o.SetOutputLevel("testLevelRules", WarnLevel)
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got %v, expecting success", err)
+	}
+	if len(child.GetLevelRules()) != 2 || len(other.GetLevelRules()) != 0 {
+		t.Errorf("Got %v %v, expecting rules for the scope and its descendants", child.GetLevelRules(), other.GetLevelRules())
+	}
+
+	s.WithLabels("proxy", "foo.ns").Debug("matched")
+	s.WithLabels("proxy", "bar.ns").Debug("other proxy")
+	s.Debug("no labels")
+	s.WithLabels("port", 80).Info("matched port")
+	s.WithLabels("port", 80).Debug("port below rule level")
+	if !s.WithLabels("proxy", "foo.ns").DebugEnabled() || s.DebugEnabled() {
+		t.Error("Expecting DebugEnabled to account for level rules")
+	}
+	if !proxy.DebugEnabled() {
+		t.Error("Expecting level rules to apply to copies made before they were set")
+	}
+
+	slog.New(NewSlogHandler(s)).Debug("slog matched", "proxy", "foo.ns")
+	slog.New(NewSlogHandler(s)).Debug("slog other", "proxy", "bar.ns")
+	_ = Sync()
+
+	out, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"matched\tproxy=foo.ns", "matched port\tport=80", "slog matched"} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("Got %q, expecting it to contain %q", out, want)
+		}
+	}
+	for _, unwanted := range []string{"other proxy", "no labels", "port below", "slog other"} {
+		if strings.Contains(string(out), unwanted) {
+			t.Errorf("Got %q, expecting it not to contain %q", out, unwanted)
+		}
+	}
+
+	s.SetLevelRules(nil)
+	if proxy.DebugEnabled() || len(proxy.GetLevelRules()) != 0 {
+		t.Error("Expecting removed level rules to no longer apply to copies")
+	}
+	child.SetLevelRules(nil)
+}
+
+func TestLevelRulesReconfigure(t *testing.T) {
+	resetGlobals()
+	defer func() {
+		resetGlobals()
+		_ = Configure(DefaultOptions())
+	}()
+	s := RegisterScope("testLevelRulesReconfigure", "")
+	child := RegisterScope("testLevelRulesReconfigure.child", "")
+	other := RegisterScope("testLevelRulesReconfigureOther", "")
+
+	o := DefaultOptions()
+	o.AddLevelRule("testLevelRulesReconfigure", LevelRule{Level: DebugLevel, Labels: map[string]string{"proxy": "foo.ns"}})
+	o.AddLevelRule("testLevelRulesReconfigureOther", LevelRule{Level: DebugLevel, Labels: map[string]string{"port": "80"}})
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got %v, expecting success", err)
+	}
+
+	// rules changed or removed from the options no longer apply
+	o = DefaultOptions()
+	o.AddLevelRule("testLevelRulesReconfigure.child", LevelRule{Level: InfoLevel, Labels: map[string]string{"proxy": "bar.ns"}})
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got %v, expecting success", err)
+	}
+	if len(s.GetLevelRules()) != 0 || len(other.GetLevelRules()) != 0 {
+		t.Errorf("Got %v %v, expecting the removed rules to be reset", s.GetLevelRules(), other.GetLevelRules())
+	}
+	if rules := child.GetLevelRules(); len(rules) != 1 || rules[0].Labels["proxy"] != "bar.ns" {
+		t.Errorf("Got %v, expecting only the new rule", rules)
+	}
+}
+
+func TestLevelRulesBadOptions(t *testing.T) {
+	defer func() { _ = Configure(DefaultOptions()) }()
+	o := DefaultOptions()
+	o.levelRules = "default:debug"
+	if err := Configure(o); err == nil {
+		t.Error("Expecting an invalid level rule to be rejected")
+	}
+}
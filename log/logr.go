@@ -16,6 +16,7 @@ package log
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/go-logr/logr"
 )
@@ -24,24 +25,68 @@ import (
 // libraries, namely Kubernetes/klog, that use logr, to use our standard logging.
 // This enables standard formatting, scope filtering, and options. The logr
 // interface does not have a concept of Debug/Info/Warn/Error as we do. Instead,
-// logging is based on Verbosity levels, where 0 is the most important. We treat
-// levels 0-3 as info level and 4+ as debug; there are no warnings. This
+// logging is based on Verbosity levels, where 0 is the most important. By default
+// we treat levels 0-3 as info level and 4+ as debug; there are no warnings. This
 // threshold is fairly arbitrary based on inspection of Kubernetes usage and
-// https://kubernetes.io/docs/reference/kubectl/cheatsheet/#kubectl-output-verbosity-and-debugging.
+// https://kubernetes.io/docs/reference/kubectl/cheatsheet/#kubectl-output-verbosity-and-debugging,
+// and can be changed with LogrDebugThreshold.
 // Errors are passed through as errors.
 // Zap does come with its own logr implementation, but we have chosen to re-implement to allow usage of
 // our Scope - in particular, this allows changing the logging level of kubernetes logs by users.
+//
+// WithName selects a child scope, named after the scope of the logger and the given name, so that
+// named loggers can be controlled separately. WithValues adds labels to the messages of the logger.
 type zapLogger struct {
 	l *Scope
+	// values added with WithValues, applied to the scope on each call so that it reflects level changes
+	values []any
+	// labeled is l with values added, made once for matching level rules, which copies share with l. It
+	// is nil without values.
+	labeled        *Scope
+	debugThreshold int
 }
 
 const debugLevelThreshold = 3
 
+// LogrOption configures a logr.Logger created by NewLogrAdapter.
+type LogrOption func(*zapLogger)
+
+// LogrDebugThreshold sets the highest verbosity level logged at info level. Messages of higher
+// verbosity levels are logged at debug level. It defaults to 3.
+func LogrDebugThreshold(v int) LogrOption {
+	return func(zl *zapLogger) {
+		zl.debugThreshold = v
+	}
+}
+
+// level returns the istio level of a logr verbosity level.
+func (zl *zapLogger) level(v int) Level {
+	if v > zl.debugThreshold {
+		return DebugLevel
+	}
+	return InfoLevel
+}
+
+// scope returns the scope of the logger with its values and the given ones added as labels.
+func (zl *zapLogger) scope(keysAndVals ...any) *Scope {
+	if len(zl.values) == 0 && len(keysAndVals) == 0 {
+		return zl.l
+	}
+	kvs := make([]any, 0, len(zl.values)+len(keysAndVals))
+	kvs = append(kvs, zl.values...)
+	return zl.l.WithLabels(append(kvs, keysAndVals...)...)
+}
+
 func (zl *zapLogger) Enabled(level int) bool {
-	if level > debugLevelThreshold {
-		return zl.l.DebugEnabled()
+	l := zl.level(level)
+	if zl.l.GetOutputLevel() >= l {
+		return true
 	}
-	return zl.l.InfoEnabled()
+	// level rules may match the values of the logger
+	if zl.labeled != nil {
+		return zl.labeled.ruleMatched(l)
+	}
+	return zl.l.ruleMatched(l)
 }
 
 // Logs will come in with newlines, but our logger auto appends newline
@@ -60,43 +105,81 @@ func (zl *zapLogger) Init(logr.RuntimeInfo) {
 }
 
 func (zl *zapLogger) Info(level int, msg string, keysAndVals ...any) {
-	if level > debugLevelThreshold {
-		zl.l.WithLabels(keysAndVals...).Debug(trimNewline(msg))
+	if zl.level(level) == DebugLevel {
+		zl.scope(keysAndVals...).Debug(trimNewline(msg))
 	} else {
-		zl.l.WithLabels(keysAndVals...).Info(trimNewline(msg))
+		zl.scope(keysAndVals...).Info(trimNewline(msg))
 	}
 }
 
 func (zl *zapLogger) Error(err error, msg string, keysAndVals ...any) {
-	if zl.l.ErrorEnabled() {
+	s := zl.scope(keysAndVals...)
+	if s.ErrorEnabled() {
 		if err == nil {
-			zl.l.WithLabels(keysAndVals...).Error(trimNewline(msg))
+			s.Error(trimNewline(msg))
 		} else {
-			zl.l.WithLabels(keysAndVals...).Error(fmt.Sprintf("%v: %s", err.Error(), msg))
+			s.Error(fmt.Sprintf("%v: %s", err.Error(), msg))
 		}
 	}
 }
 
-func (zl *zapLogger) V(int) logr.Logger {
-	zlog := &zapLogger{
-		l: zl.l,
-	}
-
-	return logr.New(zlog)
+func (zl *zapLogger) WithValues(keysAndValues ...any) logr.LogSink {
+	out := *zl
+	out.values = make([]any, 0, len(zl.values)+len(keysAndValues))
+	out.values = append(out.values, zl.values...)
+	out.values = append(out.values, keysAndValues...)
+	out.labeled = out.l.WithLabels(out.values...)
+	return &out
 }
 
-func (zl *zapLogger) WithValues(keysAndValues ...any) logr.LogSink {
-	return NewLogrAdapter(zl.l.WithLabels(keysAndValues...)).GetSink()
+// WithName returns a sink logging to the child scope <scope>.<name>, registering it if needed. Characters
+// that aren't allowed in scope names are replaced by underscores.
+func (zl *zapLogger) WithName(name string) logr.LogSink {
+	name = logrScopeName(name)
+	if name == "" {
+		return zl
+	}
+	if zl.l.name != DefaultScopeName {
+		name = zl.l.name + "." + name
+	}
+
+	out := *zl
+	if out.l = FindScope(name); out.l == nil {
+		out.l = registerScope(name, "", zl.l.callerSkip)
+	}
+	if len(out.values) > 0 {
+		out.labeled = out.l.WithLabels(out.values...)
+	}
+	return &out
 }
 
-func (zl *zapLogger) WithName(string) logr.LogSink {
-	return zl
+// logrScopeName converts a logr logger name to a valid scope name.
+func logrScopeName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(":,"+scopeWildcard, r) {
+			return '_'
+		}
+		return r
+	}, name)
+
+	segments := strings.Split(name, ".")
+	out := segments[:0]
+	for _, segment := range segments {
+		if segment != "" {
+			out = append(out, segment)
+		}
+	}
+	return strings.Join(out, ".")
 }
 
 // NewLogrAdapter creates a new logr.Logger using the given Zap Logger to log.
-func NewLogrAdapter(l *Scope) logr.Logger {
+func NewLogrAdapter(l *Scope, opts ...LogrOption) logr.Logger {
 	zlog := &zapLogger{
-		l: l,
+		l:              l,
+		debugThreshold: debugLevelThreshold,
+	}
+	for _, opt := range opts {
+		opt(zlog)
 	}
 
 	return logr.New(zlog)
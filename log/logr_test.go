@@ -16,6 +16,7 @@ package log
 
 import (
 	"errors"
+	"sync"
 	"testing"
 
 	"github.com/go-logr/logr"
@@ -38,7 +39,7 @@ func runLogrTestWithScope(t *testing.T, s *Scope, f func(l logr.Logger)) []strin
 }
 
 func newScope() *Scope {
-	s := &Scope{name: "test"}
+	s := &Scope{name: "test", levelRules: &levelRules{}}
 	s.SetOutputLevel(InfoLevel)
 	s.SetStackTraceLevel(NoneLevel)
 	s.SetLogCallers(false)
@@ -145,9 +146,101 @@ func TestLogr(t *testing.T) {
 	})
 }
 
+func TestLogrThreshold(t *testing.T) {
+	s := newScope()
+	lines := runLogrTestWithScope(t, s, func(logr.Logger) {
+		l := NewLogrAdapter(s, LogrDebugThreshold(0))
+		l.V(0).Info("0")
+		l.V(1).Info("1")
+
+		matchBool(t, true, l.V(0).Enabled())
+		matchBool(t, false, l.V(1).Enabled())
+	})
+	mustMatchLength(t, 1, lines)
+	mustRegexMatchString(t, lines[0], "0")
+}
+
+func TestLogrWithName(t *testing.T) {
+	s := newScope()
+	var child *Scope
+	lines := runLogrTestWithScope(t, s, func(l logr.Logger) {
+		named := l.WithName("reconciler").WithName("pod:watch")
+		named.Info("visible")
+
+		child = FindScope("test.reconciler.pod_watch")
+		if child == nil {
+			t.Fatal("Expecting WithName to register a child scope")
+		}
+		child.SetOutputLevel(WarnLevel)
+		named.Info("hidden")
+		matchBool(t, false, named.Enabled())
+		l.Info("parent")
+	})
+	mustMatchLength(t, 2, lines)
+	mustRegexMatchString(t, lines[0], "test.reconciler.pod_watch\tvisible")
+	mustRegexMatchString(t, lines[1], "info\tparent")
+}
+
+func TestLogrWithValues(t *testing.T) {
+	s := newScope()
+	lines := runLogrTestWithScope(t, s, func(l logr.Logger) {
+		l = l.WithValues("controller", "pods")
+		l.Info("msg", "pod", "foo")
+		l.Error(errors.New("some error"), "failed")
+
+		// level rules match the values of the logger
+		s.SetLevelRules([]LevelRule{{Level: DebugLevel, Labels: map[string]string{"controller": "pods"}}})
+		matchBool(t, true, l.V(4).Enabled())
+		l.V(4).Info("debug")
+		s.SetLevelRules(nil)
+	})
+	mustMatchLength(t, 3, lines)
+	mustRegexMatchString(t, lines[0], "msg\tcontroller=pods pod=foo")
+	mustRegexMatchString(t, lines[1], "some error: failed\tcontroller=pods")
+	mustRegexMatchString(t, lines[2], "debug\tcontroller=pods")
+}
+
 func matchBool(t *testing.T, want bool, got bool) {
 	t.Helper()
 	if want != got {
 		t.Fatalf("wanted %v got %v", want, got)
 	}
 }
+
+func TestLogrEnabledAllocations(t *testing.T) {
+	s := newScope()
+	l := NewLogrAdapter(s).WithValues("controller", "pods")
+	if allocs := testing.AllocsPerRun(100, func() { l.V(4).Enabled() }); allocs != 0 {
+		t.Errorf("Got %v allocations without level rules, expecting none", allocs)
+	}
+
+	s.SetLevelRules([]LevelRule{{Level: DebugLevel, Labels: map[string]string{"controller": "pods"}}})
+	defer s.SetLevelRules(nil)
+	if allocs := testing.AllocsPerRun(100, func() { l.V(4).Enabled() }); allocs != 0 {
+		t.Errorf("Got %v allocations with level rules, expecting none", allocs)
+	}
+	matchBool(t, true, l.V(4).Enabled())
+	matchBool(t, false, NewLogrAdapter(s).WithValues("controller", "nodes").V(4).Enabled())
+}
+
+func TestLogrWithNameConcurrent(t *testing.T) {
+	s := RegisterScope("testLogrConcurrent", "")
+	l := NewLogrAdapter(s)
+	child := l.WithName("child")
+
+	// naming the logger or registering its scope again doesn't change the scope the other loggers use, which
+	// the race detector checks
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			l.WithName("child")
+			RegisterScope("testLogrConcurrent.child", "")
+		}
+	}()
+	for i := 0; i < 1000; i++ {
+		child.WithValues("k", "v")
+	}
+	wg.Wait()
+}
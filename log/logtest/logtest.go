@@ -0,0 +1,273 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package logtest captures the messages logged through the scopes of the log package, so that tests
+// can make assertions about them:
+//
+//	r := logtest.Capture(t, logtest.WithLevel(log.DebugLevel))
+//	doSomething()
+//	r.Expect(1, logtest.AtLevel(log.WarnLevel), logtest.InScope("ads"), logtest.Contains("push failed"))
+//
+// Messages are captured from every scope, so tests that capture messages should not run in parallel
+// with each other.
+package logtest
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"istio.io/pkg/log"
+	"istio.io/pkg/structured"
+)
+
+var levelToString = map[log.Level]string{
+	log.DebugLevel: "debug",
+	log.InfoLevel:  "info",
+	log.WarnLevel:  "warn",
+	log.ErrorLevel: "error",
+	log.FatalLevel: "fatal",
+	log.NoneLevel:  "none",
+}
+
+// Entry is a captured log message.
+type Entry struct {
+	Time    time.Time
+	Level   log.Level
+	Scope   string
+	Message string
+	Labels  map[string]any
+	Error   *structured.Error
+}
+
+// String returns the entry in a form similar to the console output.
+func (e Entry) String() string {
+	sb := &strings.Builder{}
+	fmt.Fprintf(sb, "%s\t%s\t%s", levelToString[e.Level], e.Scope, e.Message)
+
+	keys := make([]string, 0, len(e.Labels))
+	for k := range e.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(sb, " %s=%v", k, e.Labels[k])
+	}
+	if e.Error != nil && e.Error.Err != nil {
+		fmt.Fprintf(sb, " err=%v", e.Error.Err)
+	}
+	return sb.String()
+}
+
+// Option customizes a capture.
+type Option func(c *capture)
+
+type capture struct {
+	levels map[string]log.Level
+}
+
+// WithLevel sets the output level of the given scopes, or of all scopes if none are given, for the
+// duration of the test, so that messages below their usual level are captured.
+func WithLevel(level log.Level, scopes ...string) Option {
+	return func(c *capture) {
+		if len(scopes) == 0 {
+			scopes = []string{log.OverrideScopeName}
+		}
+		for _, s := range scopes {
+			c.levels[s] = level
+		}
+	}
+}
+
+// Recorder holds the messages captured during a test.
+type Recorder struct {
+	t testing.TB
+
+	mu      sync.Mutex
+	entries []Entry
+}
+
+// Capture records the messages logged through scopes until the end of the test. Scope settings changed
+// through the options are restored when the test completes.
+func Capture(t testing.TB, opts ...Option) *Recorder {
+	c := &capture{levels: make(map[string]log.Level)}
+	for _, o := range opts {
+		o(c)
+	}
+
+	// the scopes are only captured once the options were applied, and are restored in cleanup
+	saved := make(map[*log.Scope]log.Level)
+	for name, l := range c.levels {
+		var scopes []*log.Scope
+		if name == log.OverrideScopeName {
+			for _, s := range log.Scopes() {
+				scopes = append(scopes, s)
+			}
+		} else if s := log.FindScope(name); s != nil {
+			scopes = []*log.Scope{s}
+		} else {
+			t.Fatalf("logtest: unknown scope %s", name)
+		}
+		for _, s := range scopes {
+			if _, ok := saved[s]; !ok {
+				saved[s] = s.GetOutputLevel()
+			}
+			s.SetOutputLevel(l)
+		}
+	}
+
+	r := &Recorder{t: t}
+	remove := log.AddHandler(r.record)
+	t.Cleanup(func() {
+		remove()
+		for s, l := range saved {
+			s.SetOutputLevel(l)
+		}
+	})
+	return r
+}
+
+func (r *Recorder) record(level log.Level, scope *log.Scope, ie *structured.Error, msg string) {
+	e := Entry{
+		Time:    time.Now(),
+		Level:   level,
+		Scope:   scope.Name(),
+		Message: msg,
+		Labels:  scope.Labels(),
+	}
+	if ie != nil {
+		cp := *ie
+		e.Error = &cp
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = append(r.entries, e)
+}
+
+// Entries returns the messages captured so far.
+func (r *Recorder) Entries() []Entry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Entry(nil), r.entries...)
+}
+
+// Reset discards the messages captured so far.
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = nil
+}
+
+// Find returns the captured messages that satisfy all matchers.
+func (r *Recorder) Find(matchers ...Matcher) []Entry {
+	var out []Entry
+	for _, e := range r.Entries() {
+		if matchAll(e, matchers) {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// Expect fails the test unless exactly n captured messages satisfy all matchers.
+func (r *Recorder) Expect(n int, matchers ...Matcher) {
+	r.t.Helper()
+	if got := r.Find(matchers...); len(got) != n {
+		r.t.Errorf("Got %d log messages matching %s, expecting %d. Captured messages:\n%s",
+			len(got), describe(matchers), n, r.dump())
+	}
+}
+
+// ExpectNone fails the test if any captured message satisfies all matchers.
+func (r *Recorder) ExpectNone(matchers ...Matcher) {
+	r.t.Helper()
+	r.Expect(0, matchers...)
+}
+
+func (r *Recorder) dump() string {
+	entries := r.Entries()
+	if len(entries) == 0 {
+		return "\t<none>"
+	}
+	lines := make([]string, 0, len(entries))
+	for _, e := range entries {
+		lines = append(lines, "\t"+e.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Matcher selects captured messages.
+type Matcher struct {
+	desc  string
+	match func(Entry) bool
+}
+
+// Match returns a custom matcher, described by desc in failure messages.
+func Match(desc string, match func(Entry) bool) Matcher {
+	return Matcher{desc: desc, match: match}
+}
+
+func matchAll(e Entry, matchers []Matcher) bool {
+	for _, m := range matchers {
+		if !m.match(e) {
+			return false
+		}
+	}
+	return true
+}
+
+func describe(matchers []Matcher) string {
+	if len(matchers) == 0 {
+		return "anything"
+	}
+	desc := make([]string, 0, len(matchers))
+	for _, m := range matchers {
+		desc = append(desc, m.desc)
+	}
+	return strings.Join(desc, ", ")
+}
+
+// AtLevel matches messages logged at the given level.
+func AtLevel(level log.Level) Matcher {
+	return Match("level "+levelToString[level], func(e Entry) bool { return e.Level == level })
+}
+
+// InScope matches messages logged through the named scope.
+func InScope(name string) Matcher {
+	return Match("scope "+name, func(e Entry) bool { return e.Scope == name })
+}
+
+// Contains matches messages whose text contains substr.
+func Contains(substr string) Matcher {
+	return Match(fmt.Sprintf("message containing %q", substr), func(e Entry) bool { return strings.Contains(e.Message, substr) })
+}
+
+// HasLabel matches messages with a label of the given key, whose value prints the same as value.
+func HasLabel(key string, value any) Matcher {
+	return Match(fmt.Sprintf("label %s=%v", key, value), func(e Entry) bool {
+		v, ok := e.Labels[key]
+		return ok && fmt.Sprint(v) == fmt.Sprint(value)
+	})
+}
+
+// HasError matches messages with a structured error whose underlying error contains substr.
+func HasError(substr string) Matcher {
+	return Match(fmt.Sprintf("error containing %q", substr), func(e Entry) bool {
+		return e.Error != nil && e.Error.Err != nil && strings.Contains(e.Error.Err.Error(), substr)
+	})
+}
@@ -0,0 +1,91 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logtest
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"istio.io/pkg/log"
+	"istio.io/pkg/structured"
+)
+
+var testScope = log.RegisterScope("logtest", "")
+
+// failureRecorder records the failures reported through Errorf.
+type failureRecorder struct {
+	testing.TB
+	failures []string
+}
+
+func (f *failureRecorder) Errorf(format string, args ...any) {
+	f.failures = append(f.failures, fmt.Sprintf(format, args...))
+}
+
+func TestCapture(t *testing.T) {
+	t.Run("capture", func(t *testing.T) {
+		r := Capture(t, WithLevel(log.DebugLevel, "logtest"))
+
+		testScope.WithLabels("k", "v", "n", 3).Warnf("push failed for %s", "proxy")
+		testScope.Debug("details")
+		testScope.Errorf(&structured.Error{MoreInfo: "more", Err: errors.New("boom")}, "failed")
+		log.Info("unrelated")
+
+		r.Expect(1, AtLevel(log.WarnLevel), InScope("logtest"), Contains("push failed"), HasLabel("k", "v"), HasLabel("n", 3))
+		r.Expect(1, AtLevel(log.DebugLevel), Contains("details"))
+		r.Expect(1, HasError("boom"))
+		r.Expect(1, InScope(log.DefaultScopeName), Contains("unrelated"))
+		r.ExpectNone(AtLevel(log.FatalLevel))
+
+		e := r.Find(HasError("boom"))[0]
+		if e.Error.MoreInfo != "more" || e.Message != "failed" || e.Time.IsZero() {
+			t.Errorf("Got %+v, expecting the structured error to be recorded", e)
+		}
+
+		r.Reset()
+		if len(r.Entries()) != 0 {
+			t.Errorf("Got %v, expecting no entries after a reset", r.Entries())
+		}
+	})
+
+	// the level and handler are restored after the test
+	if testScope.GetOutputLevel() != log.InfoLevel {
+		t.Errorf("Got %v, expecting the output level to be restored", testScope.GetOutputLevel())
+	}
+	r := Capture(t)
+	testScope.Debug("hidden")
+	r.ExpectNone()
+}
+
+func TestExpectFailure(t *testing.T) {
+	f := &failureRecorder{TB: t}
+	r := Capture(f)
+	testScope.WithLabels("k", "v").Info("hello")
+
+	r.Expect(2, InScope("logtest"), Contains("hello"))
+	if len(f.failures) != 1 {
+		t.Fatalf("Got %v, expecting one failure", f.failures)
+	}
+	for _, want := range []string{
+		"Got 1 log messages matching scope logtest, message containing \"hello\", expecting 2",
+		"info\tlogtest\thello k=v",
+	} {
+		if !strings.Contains(f.failures[0], want) {
+			t.Errorf("Got %q, expecting it to contain %q", f.failures[0], want)
+		}
+	}
+}
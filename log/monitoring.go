@@ -0,0 +1,120 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"istio.io/pkg/monitoring"
+	"istio.io/pkg/structured"
+)
+
+var (
+	scopeTag     = monitoring.MustCreateLabel("scope")
+	levelTag     = monitoring.MustCreateLabel("level")
+	errorTypeTag = monitoring.MustCreateLabel("error_type")
+
+	entriesTotal = monitoring.NewSum(
+		"log_entries_total",
+		"Total number of log messages emitted, by scope and level.",
+		monitoring.WithLabels(scopeTag, levelTag),
+	)
+
+	structuredErrorsTotal = monitoring.NewSum(
+		"log_structured_errors_total",
+		"Total number of log messages emitted with a structured error, by scope, level and type of the underlying error.",
+		monitoring.WithLabels(scopeTag, levelTag, errorTypeTag),
+	)
+
+	samplingDropped = monitoring.NewSum(
+		"log_sampling_dropped_total",
+		"Total number of log messages dropped by sampling, by scope.",
+		monitoring.WithLabels(scopeTag),
+	)
+
+	dedupSuppressed = monitoring.NewSum(
+		"log_dedup_suppressed_total",
+		"Total number of repeated log messages suppressed by deduplication, by scope.",
+		monitoring.WithLabels(scopeTag),
+	)
+
+	udsBatchesSent = monitoring.NewSum(
+		"log_uds_batches_sent_total",
+		"Total number of batches of log messages sent to the UDS server.",
+	)
+
+	udsBatchesFailed = monitoring.NewSum(
+		"log_uds_batches_failed_total",
+		"Total number of batches of log messages discarded after failing to be sent to the UDS server.",
+	)
+
+	udsMessagesDropped = monitoring.NewSum(
+		"log_uds_messages_dropped_total",
+		"Total number of log messages dropped because the UDS queue was full.",
+	)
+
+	otlpRecordsDropped = monitoring.NewSum(
+		"log_otlp_records_dropped_total",
+		"Total number of log records dropped because the OTLP export queue was full.",
+	)
+
+	asyncMessagesDropped = monitoring.NewSum(
+		"log_async_messages_dropped_total",
+		"Total number of log messages dropped because the asynchronous writer queue was full, by level.",
+		monitoring.WithLabels(levelTag),
+	)
+)
+
+// countErrorTypes enables structuredErrorsTotal, see Options.ErrorTypeMetrics.
+var countErrorTypes atomic.Bool
+
+func init() {
+	monitoring.MustRegister(samplingDropped, dedupSuppressed, udsBatchesSent, udsBatchesFailed, udsMessagesDropped,
+		otlpRecordsDropped, entriesTotal, structuredErrorsTotal, asyncMessagesDropped)
+
+	// the failures of derived metrics are logged by the default scope rather than written to stderr
+	monitoring.SetLogFuncs(
+		func(format string, args ...any) { defaultScope.Warn(fmt.Sprintf(format, args...)) },
+		func(format string, args ...any) { defaultScope.Error(fmt.Sprintf(format, args...)) })
+}
+
+// entryCounters holds the counters of the messages emitted by a scope, bound to their labels up front
+// so that counting a message doesn't allocate.
+type entryCounters [DebugLevel + 1]monitoring.Metric
+
+func newEntryCounters(scope string) *entryCounters {
+	c := &entryCounters{}
+	for l := FatalLevel; l <= DebugLevel; l++ {
+		c[l] = entriesTotal.With(scopeTag.Value(scope), levelTag.Value(levelToString[l]))
+	}
+	return c
+}
+
+// countEntry records a message emitted by the scope.
+func (s *Scope) countEntry(level Level, ie *structured.Error) {
+	if s.entryCounters == nil {
+		return
+	}
+	s.entryCounters[level].Increment()
+
+	if ie != nil && countErrorTypes.Load() {
+		errorType := "none"
+		if ie.Err != nil {
+			errorType = fmt.Sprintf("%T", ie.Err)
+		}
+		structuredErrorsTotal.With(scopeTag.Value(s.name), levelTag.Value(levelToString[level]), errorTypeTag.Value(errorType)).Increment()
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"testing"
+
+	"go.opencensus.io/stats/view"
+
+	"istio.io/pkg/structured"
+)
+
+// taggedSumValue returns the value of a sum for the rows holding all of the given tags.
+func taggedSumValue(t *testing.T, name string, tags map[string]string) float64 {
+	t.Helper()
+	rows, err := view.RetrieveData(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sum float64
+	for _, row := range rows {
+		matched := 0
+		for _, tg := range row.Tags {
+			if v, ok := tags[tg.Key.Name()]; ok && v == tg.Value {
+				matched++
+			}
+		}
+		if matched == len(tags) {
+			sum += row.Data.(*view.SumData).Value
+		}
+	}
+	return sum
+}
+
+func TestEntryMetrics(t *testing.T) {
+	resetGlobals()
+	defer func() {
+		resetGlobals()
+		_ = Configure(DefaultOptions())
+	}()
+
+	s := RegisterScope("testEntryMetrics", "")
+	o := DefaultOptions()
+	o.OutputPaths = []string{filepath.Join(t.TempDir(), "out.log")}
+	o.ErrorTypeMetrics = true
+	o.SetSampling("testEntryMetrics", Sampling{Interval: 1 << 40, First: 2})
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got %v, expecting success", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		// sampled messages are not counted
+		s.Info("sampled")
+	}
+	s.WithLabels("k", "v").Warn("warning")
+	s.Debug("below level")
+	s.Errorf(&structured.Error{Err: &fs.PathError{Op: "open", Err: errors.New("boom")}}, "failed")
+
+	scope := map[string]string{"scope": "testEntryMetrics"}
+	for level, want := range map[string]float64{"info": 2, "warn": 1, "error": 1, "debug": 0} {
+		tags := map[string]string{"scope": "testEntryMetrics", "level": level}
+		if got := taggedSumValue(t, "log_entries_total", tags); got != want {
+			t.Errorf("Got %v %s entries, expecting %v", got, level, want)
+		}
+	}
+	tags := map[string]string{"scope": "testEntryMetrics", "error_type": "*fs.PathError"}
+	if got := taggedSumValue(t, "log_structured_errors_total", tags); got != 1 {
+		t.Errorf("Got %v structured errors, expecting 1", got)
+	}
+
+	// error types are only counted when enabled
+	o.ErrorTypeMetrics = false
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got %v, expecting success", err)
+	}
+	s.Errorf(&structured.Error{Err: errors.New("boom")}, "failed")
+	if got := taggedSumValue(t, "log_structured_errors_total", scope); got != 1 {
+		t.Errorf("Got %v structured errors, expecting 1", got)
+	}
+}
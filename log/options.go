@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"google.golang.org/genproto/googleapis/api/monitoredres"
@@ -85,7 +86,7 @@ type Options struct {
 
 	// RotateOutputPath is the path to a rotating log file. This file should
 	// be automatically rotated over time, based on the rotation parameters such
-	// as RotationMaxSize and RotationMaxAge. The default is to not rotate.
+	// as RotationMaxSize, RotationMaxAge and RotationInterval. The default is to not rotate.
 	//
 	// This path is used as a foundational path. This is where log output is normally
 	// saved. When a rotation needs to take place because the file got too big or too
@@ -109,10 +110,34 @@ type Options struct {
 	// is to retain at most 1000 logs.
 	RotationMaxBackups int
 
+	// RotationInterval additionally rotates the log file at the start of every interval, either hourly or
+	// daily. Intervals start at the full hour and at midnight UTC. The default is to only rotate on size.
+	RotationInterval string
+
+	// RotationCompress controls whether rotated log files are compressed with gzip.
+	RotationCompress bool
+
 	// JSONEncoding controls whether the log is formatted as JSON.
 	JSONEncoding bool
 
-	// LogGrpc indicates that Grpc logs should be captured. The default is true.
+	// Encoding selects the format of the log: console, json, logfmt, ecs or gelf. When set, it takes
+	// precedence over JSONEncoding.
+	Encoding string
+
+	// ConfigFile is the path to a YAML or JSON file of scope settings, applied on top of the other options
+	// and reapplied whenever it changes. See FileConfig for its format.
+	ConfigFile string
+
+	// ErrorTypeMetrics enables the log_structured_errors_total metric, counting the messages logged with a
+	// structured error by the type of the underlying error. Messages are always counted by scope and level.
+	ErrorTypeMetrics bool
+
+	// ShutdownTimeout bounds the time spent running the hooks registered with RegisterShutdownHook and
+	// closing the log sinks, before exiting after a fatal message or in Close. It defaults to 5 seconds.
+	ShutdownTimeout time.Duration
+
+	// LogGrpc indicates that Grpc logs should be captured. The default is true. They are output through the
+	// grpc scope, and the logs of gRPC components through child scopes such as grpc.transport.
 	// This is not exposed through the command-line flags, as this flag is mainly useful for testing: Grpc
 	// stack will hold on to the logger even though it gets closed. This causes data races.
 	LogGrpc bool
@@ -121,6 +146,22 @@ type Options struct {
 	logCallers       string
 	stackTraceLevels string
 
+	// per-scope level rules, in the form of <scope>:<level>:<key>=<value>&<key>=<value>,...
+	levelRules string
+
+	// scopes whose output is not redacted, in the form of <scope>,<scope>,...
+	unredacted string
+
+	// per-scope sampling, in the form of <scope>:<first>/<thereafter>/<interval>,...
+	sampling string
+
+	// per-scope deduplication windows, in the form of <scope>:<window>,...
+	dedup string
+
+	// per-scope sinks, in the form of <scope>:<path>,<scope>:<path>,...
+	scopeOutputPaths       string
+	scopeRotateOutputPaths string
+
 	// experimental: stackdriver support
 	useStackdriverFormat     bool
 	teeToStackdriver         bool
@@ -133,6 +174,21 @@ type Options struct {
 	teeToUDSServer   bool
 	udsSocketAddress string
 	udsServerPath    string
+	udsOptions       UDSOptions
+
+	// tee log to an OpenTelemetry collector
+	teeToOTLP   bool
+	otlpOptions OTLPOptions
+
+	// tee log to syslog and journald
+	teeToSyslog    bool
+	syslogOptions  SyslogOptions
+	teeToJournald  bool
+	journaldSocket string
+
+	// write log messages from a background goroutine
+	async        bool
+	asyncOptions AsyncOptions
 }
 
 // DefaultOptions returns a new set of options, initialized to the defaults
@@ -185,6 +241,48 @@ func (o *Options) WithTeeToUDS(addr, path string) *Options {
 	return o
 }
 
+// WithTeeToUDSWithOptions configures a parallel logging pipeline that writes logs to a server over UDS,
+// tuning how messages are queued, batched and retried.
+func (o *Options) WithTeeToUDSWithOptions(addr, path string, opts UDSOptions) *Options {
+	o.WithTeeToUDS(addr, path)
+	o.udsOptions = opts
+	return o
+}
+
+// WithTeeToOTLP configures a parallel logging pipeline that exports logs to an OpenTelemetry collector
+// over OTLP/gRPC or OTLP/HTTP.
+func (o *Options) WithTeeToOTLP(cfg OTLPOptions) *Options {
+	o.teeToOTLP = true
+	o.otlpOptions = cfg
+	return o
+}
+
+// WithTeeToSyslog configures a parallel logging pipeline that writes logs to a syslog server in the
+// RFC 5424 format. The scope and labels of each message are recorded as structured data.
+func (o *Options) WithTeeToSyslog(cfg SyslogOptions) *Options {
+	o.teeToSyslog = true
+	o.syslogOptions = cfg
+	return o
+}
+
+// WithTeeToJournald configures a parallel logging pipeline that writes logs to the systemd journal over
+// its native protocol. socket defaults to /run/systemd/journal/socket, and labels are recorded as journal
+// fields named after their uppercased keys.
+func (o *Options) WithTeeToJournald(socket string) *Options {
+	o.teeToJournald = true
+	o.journaldSocket = socket
+	return o
+}
+
+// WithAsync makes log calls queue messages to be written by a background goroutine, so that slow outputs
+// don't block the callers. The queue is flushed by Sync and Close, and before messages above the error
+// level, such as fatal ones, are written.
+func (o *Options) WithAsync(cfg AsyncOptions) *Options {
+	o.async = true
+	o.asyncOptions = cfg
+	return o
+}
+
 // SetOutputLevel sets the minimum log output level for a given scope.
 func (o *Options) SetOutputLevel(scope string, level Level) {
 	sl := scope + ":" + levelToString[level]
@@ -333,6 +431,172 @@ func (o *Options) GetLogCallers(scope string) bool {
 	return false
 }
 
+// AddLevelRule adds a rule enabling a lower level for the log calls of a given scope whose labels match.
+func (o *Options) AddLevelRule(scope string, rule LevelRule) {
+	entry := scope + ":" + rule.String()
+	if o.levelRules == "" {
+		o.levelRules = entry
+	} else {
+		o.levelRules += "," + entry
+	}
+}
+
+// GetLevelRules returns the level rules added for a given scope.
+func (o *Options) GetLevelRules(scope string) ([]LevelRule, error) {
+	var rules []LevelRule
+	for _, e := range strings.Split(o.levelRules, ",") {
+		if e == "" {
+			continue
+		}
+		s, r, err := convertScopedLevelRule(e)
+		if err != nil {
+			return nil, err
+		}
+		if s == scope {
+			rules = append(rules, r)
+		}
+	}
+	return rules, nil
+}
+
+// SetRedaction sets whether sensitive data is redacted from the output of a given scope. Redaction is
+// enabled by default.
+func (o *Options) SetRedaction(scope string, redact bool) {
+	var scopes []string
+	for _, s := range strings.Split(o.unredacted, ",") {
+		if s != "" && s != scope {
+			scopes = append(scopes, s)
+		}
+	}
+	if !redact {
+		scopes = append(scopes, scope)
+	}
+	o.unredacted = strings.Join(scopes, ",")
+}
+
+// GetRedaction returns whether sensitive data is redacted from the output of a given scope.
+func (o *Options) GetRedaction(scope string) bool {
+	for _, s := range strings.Split(o.unredacted, ",") {
+		if s == scope {
+			return false
+		}
+	}
+	return true
+}
+
+// SetSampling sets the sampling configuration for a given scope. The zero Sampling disables sampling.
+func (o *Options) SetSampling(scope string, cfg Sampling) {
+	var entries []string
+	prefix := scope + ":"
+	for _, e := range strings.Split(o.sampling, ",") {
+		if e != "" && !strings.HasPrefix(e, prefix) {
+			entries = append(entries, e)
+		}
+	}
+	if cfg.Enabled() {
+		entries = append(entries, prefix+cfg.String())
+	}
+	o.sampling = strings.Join(entries, ",")
+}
+
+// GetSampling returns the sampling configuration for a given scope.
+func (o *Options) GetSampling(scope string) (Sampling, error) {
+	prefix := scope + ":"
+	for _, e := range strings.Split(o.sampling, ",") {
+		if strings.HasPrefix(e, prefix) {
+			_, cfg, err := convertScopedSampling(e)
+			return cfg, err
+		}
+	}
+	return Sampling{}, nil
+}
+
+// SetDedupWindow sets the deduplication window for a given scope. A window of 0 disables deduplication.
+func (o *Options) SetDedupWindow(scope string, window time.Duration) {
+	var entries []string
+	prefix := scope + ":"
+	for _, e := range strings.Split(o.dedup, ",") {
+		if e != "" && !strings.HasPrefix(e, prefix) {
+			entries = append(entries, e)
+		}
+	}
+	if window > 0 {
+		entries = append(entries, prefix+window.String())
+	}
+	o.dedup = strings.Join(entries, ",")
+}
+
+// GetDedupWindow returns the deduplication window for a given scope.
+func (o *Options) GetDedupWindow(scope string) (time.Duration, error) {
+	prefix := scope + ":"
+	for _, e := range strings.Split(o.dedup, ",") {
+		if strings.HasPrefix(e, prefix) {
+			return parseDedupWindow(strings.TrimPrefix(e, prefix))
+		}
+	}
+	return 0, nil
+}
+
+// SetScopeOutputPaths routes the output of a scope to the given paths instead of OutputPaths and
+// RotateOutputPath. The special values stdout and stderr can be used to output to the standard I/O
+// streams. Using the default scope name replaces the sinks of every scope that isn't routed elsewhere.
+func (o *Options) SetScopeOutputPaths(scope string, paths ...string) {
+	o.scopeOutputPaths = setScopedPaths(o.scopeOutputPaths, scope, paths)
+}
+
+// GetScopeOutputPaths returns the paths the output of a scope is routed to, if any.
+func (o *Options) GetScopeOutputPaths(scope string) []string {
+	paths, _ := parseScopedPaths(o.scopeOutputPaths)
+	return paths[scope]
+}
+
+// SetScopeRotateOutputPath routes the output of a scope to its own rotating log file, which is
+// rotated independently of RotateOutputPath using the same rotation parameters.
+func (o *Options) SetScopeRotateOutputPath(scope string, path string) {
+	var paths []string
+	if path != "" {
+		paths = []string{path}
+	}
+	o.scopeRotateOutputPaths = setScopedPaths(o.scopeRotateOutputPaths, scope, paths)
+}
+
+// GetScopeRotateOutputPath returns the path of the rotating log file of a scope, if any.
+func (o *Options) GetScopeRotateOutputPath(scope string) string {
+	paths, _ := parseScopedPaths(o.scopeRotateOutputPaths)
+	return lastPath(paths[scope])
+}
+
+// setScopedPaths replaces the paths of scope in a <scope>:<path>,... list.
+func setScopedPaths(arg string, scope string, paths []string) string {
+	var entries []string
+	prefix := scope + ":"
+	for _, e := range strings.Split(arg, ",") {
+		if e != "" && !strings.HasPrefix(e, prefix) {
+			entries = append(entries, e)
+		}
+	}
+	for _, p := range paths {
+		entries = append(entries, prefix+p)
+	}
+	return strings.Join(entries, ",")
+}
+
+// parseScopedPaths breaks down a <scope>:<path>,<scope>:<path>,... list into the paths of each scope.
+func parseScopedPaths(arg string) (map[string][]string, error) {
+	paths := make(map[string][]string)
+	for _, e := range strings.Split(arg, ",") {
+		if e == "" {
+			continue
+		}
+		scope, path, ok := strings.Cut(e, ":")
+		if !ok || scope == "" || path == "" {
+			return nil, fmt.Errorf("invalid scope output path '%s'", e)
+		}
+		paths[scope] = append(paths[scope], path)
+	}
+	return paths, nil
+}
+
 func convertScopedLevel(sl string) (string, Level, error) {
 	var s string
 	var l string
@@ -391,9 +655,29 @@ func (o *Options) AttachFlags(
 	intVar(&o.RotationMaxBackups, "log_rotate_max_backups", o.RotationMaxBackups,
 		"The maximum number of log file backups to keep before older files are deleted (0 indicates no limit)")
 
+	stringVar(&o.RotationInterval, "log_rotate_interval", o.RotationInterval,
+		"The interval at which the log file is rotated in addition to its size, one of [hourly, daily]")
+
+	boolVar(&o.RotationCompress, "log_rotate_compress", o.RotationCompress,
+		"Whether to compress rotated log files with gzip")
+
+	stringVar(&o.scopeOutputPaths, "log_output_path", o.scopeOutputPaths,
+		"Comma-separated per-scope paths where to output the log, in the form of <scope>:<path>,<scope>:<path>,... "+
+			"Scopes without a path use the default scope's paths if given, otherwise --log_target and --log_rotate")
+
+	stringVar(&o.scopeRotateOutputPaths, "log_rotate_path", o.scopeRotateOutputPaths,
+		"Comma-separated per-scope paths for optional rotating log files, in the form of <scope>:<path>,<scope>:<path>,...")
+
 	boolVar(&o.JSONEncoding, "log_as_json", o.JSONEncoding,
 		"Whether to format output as JSON or in plain console-friendly format")
 
+	stringVar(&o.Encoding, "log_encoding", o.Encoding,
+		"The format of the log, one of [console, json, logfmt, ecs, gelf]. Takes precedence over --log_as_json")
+
+	stringVar(&o.ConfigFile, "log_config_file", o.ConfigFile,
+		"The path to a YAML or JSON file of per-scope output levels, stack trace levels, callers and sampling, "+
+			"which is watched and applied whenever it changes")
+
 	levelListString := fmt.Sprintf("[%s, %s, %s, %s, %s, %s]",
 		levelToString[DebugLevel],
 		levelToString[InfoLevel],
@@ -414,16 +698,36 @@ func (o *Options) AttachFlags(
 
 		stringVar(&o.outputLevels, "log_output_level", o.outputLevels,
 			fmt.Sprintf("Comma-separated minimum per-scope logging level of messages to output, in the form of "+
-				"<scope>:<level>,<scope>:<level>,... where scope can be one of [%s] and level can be one of %s",
+				"<scope>:<level>,<scope>:<level>,... where scope can be one of [%s] or a pattern such as xds.* and level can be one of %s",
 				s, levelListString))
 
 		stringVar(&o.stackTraceLevels, "log_stacktrace_level", o.stackTraceLevels,
 			fmt.Sprintf("Comma-separated minimum per-scope logging level at which stack traces are captured, in the form of "+
-				"<scope>:<level>,<scope:level>,... where scope can be one of [%s] and level can be one of %s",
+				"<scope>:<level>,<scope:level>,... where scope can be one of [%s] or a pattern such as xds.* and level can be one of %s",
 				s, levelListString))
 
 		stringVar(&o.logCallers, "log_caller", o.logCallers,
-			fmt.Sprintf("Comma-separated list of scopes for which to include caller information, scopes can be any of [%s]", s))
+			fmt.Sprintf("Comma-separated list of scopes for which to include caller information, scopes can be any of [%s] "+
+				"or a pattern such as xds.*", s))
+
+		stringVar(&o.levelRules, "log_level_rules", o.levelRules,
+			fmt.Sprintf("Comma-separated per-scope rules enabling a lower logging level for messages with matching labels, "+
+				"in the form of <scope>:<level>:<key>=<value>&<key>=<value>,... where scope can be one of [%s] or a pattern "+
+				"such as xds.*, e.g. ads:debug:proxy=foo.ns", s))
+
+		stringVar(&o.unredacted, "log_unredacted", o.unredacted,
+			fmt.Sprintf("Comma-separated list of scopes whose output is not redacted of sensitive data, for local debugging. "+
+				"Scopes can be any of [%s]", s))
+
+		stringVar(&o.sampling, "log_sampling", o.sampling,
+			fmt.Sprintf("Comma-separated per-scope sampling of messages to output, in the form of "+
+				"<scope>:<first>/<thereafter>/<interval>,... where scope can be one of [%s] or a pattern such as xds.*. Within each interval, the first "+
+				"<first> messages with the same level and text are output, then every <thereafter>th one", s))
+
+		stringVar(&o.dedup, "log_dedup", o.dedup,
+			fmt.Sprintf("Comma-separated per-scope deduplication of messages, in the form of <scope>:<window>,... where scope "+
+				"can be one of [%s] or a pattern such as xds.*. Repeats of a message with the same level, text and labels within "+
+				"the window are collapsed into a summary", s))
 	} else {
 		stringVar(&o.outputLevels, "log_output_level", o.outputLevels,
 			fmt.Sprintf("The minimum logging level of messages to output,  can be one of %s",
@@ -435,6 +739,22 @@ func (o *Options) AttachFlags(
 
 		stringVar(&o.logCallers, "log_caller", o.logCallers,
 			"Comma-separated list of scopes for which to include called information, scopes can be any of [default]")
+
+		stringVar(&o.levelRules, "log_level_rules", o.levelRules,
+			"Comma-separated rules enabling a lower logging level for messages with matching labels, in the form of "+
+				"default:<level>:<key>=<value>&<key>=<value>,... e.g. default:debug:proxy=foo.ns")
+
+		stringVar(&o.unredacted, "log_unredacted", o.unredacted,
+			"Comma-separated list of scopes whose output is not redacted of sensitive data, for local debugging. "+
+				"Scopes can be any of [default]")
+
+		stringVar(&o.sampling, "log_sampling", o.sampling,
+			"Sampling of messages to output, in the form of default:<first>/<thereafter>/<interval>. Within each interval, "+
+				"the first <first> messages with the same level and text are output, then every <thereafter>th one")
+
+		stringVar(&o.dedup, "log_dedup", o.dedup,
+			"Deduplication of messages, in the form of default:<window>. Repeats of a message with the same level, text "+
+				"and labels within the window are collapsed into a summary")
 	}
 
 	// NOTE: we don't currently expose a command-line option to control ErrorOutputPaths since it
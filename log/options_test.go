@@ -41,6 +41,17 @@ func TestOpts(t *testing.T) {
 			RotationMaxBackups: defaultRotationMaxBackups,
 		}},
 
+		{"--log_encoding logfmt", Options{
+			OutputPaths:        []string{defaultOutputPath},
+			ErrorOutputPaths:   []string{defaultErrorOutputPath},
+			outputLevels:       DefaultScopeName + ":" + levelToString[defaultOutputLevel],
+			stackTraceLevels:   DefaultScopeName + ":" + levelToString[defaultStackTraceLevel],
+			Encoding:           EncodingLogfmt,
+			RotationMaxAge:     defaultRotationMaxAge,
+			RotationMaxSize:    defaultRotationMaxSize,
+			RotationMaxBackups: defaultRotationMaxBackups,
+		}},
+
 		{"--log_target stdout --log_target stderr", Options{
 			OutputPaths:        []string{"stdout", "stderr"},
 			ErrorOutputPaths:   []string{defaultErrorOutputPath},
@@ -62,6 +73,17 @@ func TestOpts(t *testing.T) {
 			RotationMaxBackups: defaultRotationMaxBackups,
 		}},
 
+		{"--log_unredacted default", Options{
+			OutputPaths:        []string{defaultOutputPath},
+			ErrorOutputPaths:   []string{defaultErrorOutputPath},
+			outputLevels:       DefaultScopeName + ":" + levelToString[defaultOutputLevel],
+			stackTraceLevels:   DefaultScopeName + ":" + levelToString[defaultStackTraceLevel],
+			unredacted:         DefaultScopeName,
+			RotationMaxAge:     defaultRotationMaxAge,
+			RotationMaxSize:    defaultRotationMaxSize,
+			RotationMaxBackups: defaultRotationMaxBackups,
+		}},
+
 		{"--log_stacktrace_level debug", Options{
 			OutputPaths:        []string{defaultOutputPath},
 			ErrorOutputPaths:   []string{defaultErrorOutputPath},
@@ -252,6 +274,28 @@ func TestOpts(t *testing.T) {
 			RotationMaxSize:    defaultRotationMaxSize,
 			RotationMaxBackups: 1234,
 		}},
+
+		{"--log_output_path ads:/var/log/ads.log,default:stdout", Options{
+			OutputPaths:        []string{defaultOutputPath},
+			ErrorOutputPaths:   []string{defaultErrorOutputPath},
+			outputLevels:       DefaultScopeName + ":" + levelToString[defaultOutputLevel],
+			stackTraceLevels:   DefaultScopeName + ":" + levelToString[defaultStackTraceLevel],
+			scopeOutputPaths:   "ads:/var/log/ads.log,default:stdout",
+			RotationMaxAge:     defaultRotationMaxAge,
+			RotationMaxSize:    defaultRotationMaxSize,
+			RotationMaxBackups: defaultRotationMaxBackups,
+		}},
+
+		{"--log_rotate_path ads:/var/log/ads.log", Options{
+			OutputPaths:            []string{defaultOutputPath},
+			ErrorOutputPaths:       []string{defaultErrorOutputPath},
+			outputLevels:           DefaultScopeName + ":" + levelToString[defaultOutputLevel],
+			stackTraceLevels:       DefaultScopeName + ":" + levelToString[defaultStackTraceLevel],
+			scopeRotateOutputPaths: "ads:/var/log/ads.log",
+			RotationMaxAge:         defaultRotationMaxAge,
+			RotationMaxSize:        defaultRotationMaxSize,
+			RotationMaxBackups:     defaultRotationMaxBackups,
+		}},
 	}
 
 	for j := 0; j < 2; j++ {
@@ -432,3 +476,41 @@ func TestLogCallers(t *testing.T) {
 		t.Error("Expecting false")
 	}
 }
+
+func TestScopeOutputPaths(t *testing.T) {
+	o := DefaultOptions()
+
+	o.SetScopeOutputPaths("ads", "stdout", "/tmp/ads.log")
+	o.SetScopeOutputPaths("delta", "stderr")
+	if got := o.GetScopeOutputPaths("ads"); !reflect.DeepEqual(got, []string{"stdout", "/tmp/ads.log"}) {
+		t.Errorf("Got %v, expecting [stdout /tmp/ads.log]", got)
+	}
+
+	o.SetScopeOutputPaths("ads", "stderr")
+	if got := o.GetScopeOutputPaths("ads"); !reflect.DeepEqual(got, []string{"stderr"}) {
+		t.Errorf("Got %v, expecting [stderr]", got)
+	}
+	if got := o.GetScopeOutputPaths("delta"); !reflect.DeepEqual(got, []string{"stderr"}) {
+		t.Errorf("Got %v, expecting [stderr]", got)
+	}
+
+	o.SetScopeOutputPaths("ads")
+	if got := o.GetScopeOutputPaths("ads"); got != nil {
+		t.Errorf("Got %v, expecting no paths", got)
+	}
+
+	o.SetScopeRotateOutputPath("ads", "/tmp/ads.log")
+	if got := o.GetScopeRotateOutputPath("ads"); got != "/tmp/ads.log" {
+		t.Errorf("Got %v, expecting /tmp/ads.log", got)
+	}
+	o.SetScopeRotateOutputPath("ads", "")
+	if got := o.GetScopeRotateOutputPath("ads"); got != "" {
+		t.Errorf("Got %v, expecting no path", got)
+	}
+
+	for _, bad := range []string{"ads", "ads:", ":stdout"} {
+		if _, err := parseScopedPaths(bad); err == nil {
+			t.Errorf("Got success for %q, expecting error", bad)
+		}
+	}
+}
@@ -0,0 +1,540 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// OTLPProtocolGRPC exports logs with the OTLP/gRPC LogsService.
+	OTLPProtocolGRPC = "grpc"
+	// OTLPProtocolHTTP exports logs as binary protobuf with OTLP/HTTP.
+	OTLPProtocolHTTP = "http"
+
+	defaultOTLPBatchSize     = 512
+	defaultOTLPMaxQueueSize  = 2048
+	defaultOTLPFlushInterval = time.Second
+	defaultOTLPTimeout       = 10 * time.Second
+	otlpHTTPLogsPath         = "/v1/logs"
+)
+
+// OTLPOptions configures the export of logs to an OpenTelemetry collector.
+type OTLPOptions struct {
+	// Protocol is either OTLPProtocolGRPC (the default) or OTLPProtocolHTTP.
+	Protocol string
+
+	// Endpoint is the host:port of the collector. For OTLP/HTTP, a full URL may be given instead,
+	// otherwise logs are posted to /v1/logs.
+	Endpoint string
+
+	// Insecure disables TLS.
+	Insecure bool
+
+	// Headers are sent with every export request, e.g. for authentication.
+	Headers map[string]string
+
+	// Resource holds the attributes describing the process, e.g. service.name.
+	Resource map[string]string
+
+	// BatchSize is the number of records that triggers an export before FlushInterval elapses.
+	BatchSize int
+
+	// MaxQueueSize is the number of records held while waiting for export. Records logged while the
+	// queue is full are dropped.
+	MaxQueueSize int
+
+	// FlushInterval is the longest time a record waits before being exported.
+	FlushInterval time.Duration
+
+	// Timeout bounds each export request.
+	Timeout time.Duration
+}
+
+// otlpSeverityMapping maps the Zap log levels to OpenTelemetry severity numbers.
+//
+// See: https://opentelemetry.io/docs/specs/otel/logs/data-model/#field-severitynumber
+var otlpSeverityMapping = map[zapcore.Level]logspb.SeverityNumber{
+	zapcore.DebugLevel:  logspb.SeverityNumber_SEVERITY_NUMBER_DEBUG,
+	zapcore.InfoLevel:   logspb.SeverityNumber_SEVERITY_NUMBER_INFO,
+	zapcore.WarnLevel:   logspb.SeverityNumber_SEVERITY_NUMBER_WARN,
+	zapcore.ErrorLevel:  logspb.SeverityNumber_SEVERITY_NUMBER_ERROR,
+	zapcore.DPanicLevel: logspb.SeverityNumber_SEVERITY_NUMBER_FATAL,
+	zapcore.PanicLevel:  logspb.SeverityNumber_SEVERITY_NUMBER_FATAL,
+	zapcore.FatalLevel:  logspb.SeverityNumber_SEVERITY_NUMBER_FATAL,
+}
+
+// otlpExporter sends a batch of logs to a collector.
+type otlpExporter interface {
+	export(ctx context.Context, req *collogspb.ExportLogsServiceRequest) error
+	close() error
+}
+
+type otlpGRPCExporter struct {
+	conn    *grpc.ClientConn
+	client  collogspb.LogsServiceClient
+	headers metadata.MD
+}
+
+func (e *otlpGRPCExporter) export(ctx context.Context, req *collogspb.ExportLogsServiceRequest) error {
+	if len(e.headers) > 0 {
+		ctx = metadata.NewOutgoingContext(ctx, e.headers)
+	}
+	_, err := e.client.Export(ctx, req)
+	return err
+}
+
+func (e *otlpGRPCExporter) close() error {
+	return e.conn.Close()
+}
+
+type otlpHTTPExporter struct {
+	client  http.Client
+	url     string
+	headers map[string]string
+}
+
+func (e *otlpHTTPExporter) export(ctx context.Context, req *collogspb.ExportLogsServiceRequest) error {
+	body, err := proto.Marshal(req)
+	if err != nil {
+		return err
+	}
+	hreq, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	hreq.Header.Set("Content-Type", "application/x-protobuf")
+	for k, v := range e.headers {
+		hreq.Header.Set(k, v)
+	}
+	resp, err := e.client.Do(hreq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("collector returns non-ok status %v: %v", e.url, resp.Status)
+	}
+	return nil
+}
+
+func (e *otlpHTTPExporter) close() error {
+	e.client.CloseIdleConnections()
+	return nil
+}
+
+func newOTLPExporter(cfg OTLPOptions) (otlpExporter, error) {
+	if cfg.Endpoint == "" {
+		return nil, errors.New("an endpoint must be provided for OTLP export")
+	}
+
+	switch cfg.Protocol {
+	case "", OTLPProtocolGRPC:
+		creds := insecure.NewCredentials()
+		if !cfg.Insecure {
+			creds = credentials.NewTLS(&tls.Config{MinVersion: tls.VersionTLS12})
+		}
+		conn, err := grpc.Dial(cfg.Endpoint, grpc.WithTransportCredentials(creds))
+		if err != nil {
+			return nil, fmt.Errorf("unable to connect to OTLP collector %v: %v", cfg.Endpoint, err)
+		}
+		return &otlpGRPCExporter{
+			conn:    conn,
+			client:  collogspb.NewLogsServiceClient(conn),
+			headers: metadata.New(cfg.Headers),
+		}, nil
+
+	case OTLPProtocolHTTP:
+		url := cfg.Endpoint
+		if !strings.Contains(url, "://") {
+			scheme := "https://"
+			if cfg.Insecure {
+				scheme = "http://"
+			}
+			url = scheme + url + otlpHTTPLogsPath
+		}
+		return &otlpHTTPExporter{url: url, headers: cfg.Headers}, nil
+	}
+
+	return nil, fmt.Errorf("unknown OTLP protocol '%s'", cfg.Protocol)
+}
+
+// otlpRecord is a log record waiting for export, along with the name of the scope that emitted it.
+type otlpRecord struct {
+	scope  string
+	record *logspb.LogRecord
+}
+
+// otlpBatcher queues records and exports them in the background, shared by all cores of a configuration.
+type otlpBatcher struct {
+	exporter  otlpExporter
+	resource  *resourcepb.Resource
+	batchSize int
+	maxQueue  int
+	timeout   time.Duration
+
+	mu      sync.Mutex
+	pending []otlpRecord
+	// lastErr is the failure of the last background export, reported by the next Sync.
+	lastErr error
+	// dropped is the number of records dropped since the last Sync, which reports it once rather than
+	// on every write while the collector is unavailable.
+	dropped int
+
+	// exportMu serializes exports so records are delivered in order.
+	exportMu sync.Mutex
+	kick     chan struct{}
+	done     chan struct{}
+	wg       sync.WaitGroup
+	// closeOnce guards against Close being called more than once.
+	closeOnce sync.Once
+}
+
+func newOTLPBatcher(cfg OTLPOptions) (*otlpBatcher, error) {
+	exporter, err := newOTLPExporter(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultOTLPBatchSize
+	}
+	if cfg.MaxQueueSize <= 0 {
+		cfg.MaxQueueSize = defaultOTLPMaxQueueSize
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = defaultOTLPFlushInterval
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultOTLPTimeout
+	}
+
+	keys := make([]string, 0, len(cfg.Resource))
+	for k := range cfg.Resource {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	resource := &resourcepb.Resource{}
+	for _, k := range keys {
+		resource.Attributes = append(resource.Attributes, otlpAttribute(k, cfg.Resource[k]))
+	}
+
+	b := &otlpBatcher{
+		exporter:  exporter,
+		resource:  resource,
+		batchSize: cfg.BatchSize,
+		maxQueue:  cfg.MaxQueueSize,
+		timeout:   cfg.Timeout,
+		kick:      make(chan struct{}, 1),
+		done:      make(chan struct{}),
+	}
+
+	b.wg.Add(1)
+	go b.run(cfg.FlushInterval)
+
+	return b, nil
+}
+
+func (b *otlpBatcher) run(interval time.Duration) {
+	defer b.wg.Done()
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+		case <-b.kick:
+		case <-b.done:
+			return
+		}
+		if err := b.flush(); err != nil {
+			b.mu.Lock()
+			b.lastErr = err
+			b.mu.Unlock()
+		}
+	}
+}
+
+// add queues a record for export. Records are dropped while the queue is full.
+func (b *otlpBatcher) add(r otlpRecord) {
+	b.mu.Lock()
+	if len(b.pending) >= b.maxQueue {
+		b.dropped++
+		b.mu.Unlock()
+		otlpRecordsDropped.Increment()
+		return
+	}
+	b.pending = append(b.pending, r)
+	full := len(b.pending) >= b.batchSize
+	b.mu.Unlock()
+
+	if full {
+		select {
+		case b.kick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// flush exports all pending records.
+func (b *otlpBatcher) flush() error {
+	b.exportMu.Lock()
+	defer b.exportMu.Unlock()
+
+	b.mu.Lock()
+	pending := b.pending
+	b.pending = nil
+	b.mu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
+	defer cancel()
+	if err := b.exporter.export(ctx, b.request(pending)); err != nil {
+		return fmt.Errorf("error writing %d logs to OTLP collector: %v", len(pending), err)
+	}
+	return nil
+}
+
+// request groups records by scope, preserving the order in which scopes and records were logged.
+func (b *otlpBatcher) request(pending []otlpRecord) *collogspb.ExportLogsServiceRequest {
+	rl := &logspb.ResourceLogs{Resource: b.resource}
+	byScope := make(map[string]*logspb.ScopeLogs)
+	for _, r := range pending {
+		sl, ok := byScope[r.scope]
+		if !ok {
+			sl = &logspb.ScopeLogs{Scope: &commonpb.InstrumentationScope{Name: r.scope}}
+			byScope[r.scope] = sl
+			rl.ScopeLogs = append(rl.ScopeLogs, sl)
+		}
+		sl.LogRecords = append(sl.LogRecords, r.record)
+	}
+	return &collogspb.ExportLogsServiceRequest{ResourceLogs: []*logspb.ResourceLogs{rl}}
+}
+
+// sync exports all pending records, reporting any failure or dropped record since the last call.
+func (b *otlpBatcher) sync() error {
+	err := b.flush()
+
+	b.mu.Lock()
+	if err == nil {
+		err = b.lastErr
+	}
+	if err == nil && b.dropped > 0 {
+		err = fmt.Errorf("dropped %d log records because the OTLP export queue was full", b.dropped)
+	}
+	b.lastErr = nil
+	b.dropped = 0
+	b.mu.Unlock()
+
+	return err
+}
+
+func (b *otlpBatcher) close() error {
+	b.closeOnce.Do(func() { close(b.done) })
+	b.wg.Wait()
+	err := b.flush()
+	if cerr := b.exporter.close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// An otlpCore writes entries to an OpenTelemetry collector.
+type otlpCore struct {
+	batcher      *otlpBatcher
+	minimumLevel zapcore.Level
+	fields       []zapcore.Field
+}
+
+// teeToOTLP returns a zapcore.Core that writes entries to both the provided core and to an OpenTelemetry collector.
+func teeToOTLP(baseCore zapcore.Core, batcher *otlpBatcher) zapcore.Core {
+	oc := &otlpCore{batcher: batcher}
+	for l := zapcore.DebugLevel; l <= zapcore.FatalLevel; l++ {
+		if baseCore.Enabled(l) {
+			oc.minimumLevel = l
+			break
+		}
+	}
+	return zapcore.NewTee(baseCore, oc)
+}
+
+// Enabled implements zapcore.Core.
+func (oc *otlpCore) Enabled(l zapcore.Level) bool {
+	return l >= oc.minimumLevel
+}
+
+// With implements zapcore.Core.
+func (oc *otlpCore) With(fields []zapcore.Field) zapcore.Core {
+	return &otlpCore{
+		batcher:      oc.batcher,
+		minimumLevel: oc.minimumLevel,
+		fields:       append(oc.fields[:len(oc.fields):len(oc.fields)], fields...),
+	}
+}
+
+// Check implements zapcore.Core.
+func (oc *otlpCore) Check(e zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if oc.Enabled(e.Level) {
+		return ce.AddCore(e, oc)
+	}
+	return ce
+}
+
+// Sync implements zapcore.Core.
+func (oc *otlpCore) Sync() error {
+	return oc.batcher.sync()
+}
+
+// Write implements zapcore.Core. Log records are batched and exported asynchronously.
+func (oc *otlpCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	scope, msg, attrs, tc := structuredEntry(entry, oc.fields, fields)
+	if entry.Caller.Defined {
+		attrs["code.filepath"] = entry.Caller.File
+		attrs["code.lineno"] = entry.Caller.Line
+		setNotEmpty(attrs, "code.function", entry.Caller.Function)
+	}
+	setNotEmpty(attrs, "stacktrace", entry.Stack)
+
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	record := &logspb.LogRecord{
+		TimeUnixNano:         uint64(entry.Time.UnixNano()),
+		ObservedTimeUnixNano: uint64(time.Now().UnixNano()),
+		SeverityNumber:       otlpSeverityMapping[entry.Level],
+		SeverityText:         entry.Level.CapitalString(),
+		Body:                 otlpValue(msg),
+		Attributes:           make([]*commonpb.KeyValue, 0, len(keys)),
+	}
+	for _, k := range keys {
+		record.Attributes = append(record.Attributes, otlpAttribute(k, attrs[k]))
+	}
+	if tc != nil {
+		record.TraceId, _ = hex.DecodeString(tc.TraceID)
+		record.SpanId, _ = hex.DecodeString(tc.SpanID)
+		if tc.Sampled {
+			// the W3C sampled trace flag
+			record.Flags = 0x01
+		}
+	}
+
+	oc.batcher.add(otlpRecord{scope: scope, record: record})
+	return nil
+}
+
+func otlpAttribute(key string, value any) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: key, Value: otlpValue(value)}
+}
+
+// otlpValue converts a field value into its OTLP representation. Types without a direct
+// equivalent are recorded as strings.
+func otlpValue(v any) *commonpb.AnyValue {
+	switch t := v.(type) {
+	case nil:
+		return &commonpb.AnyValue{}
+	case string:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: t}}
+	case bool:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: t}}
+	case int:
+		return otlpInt(int64(t))
+	case int8:
+		return otlpInt(int64(t))
+	case int16:
+		return otlpInt(int64(t))
+	case int32:
+		return otlpInt(int64(t))
+	case int64:
+		return otlpInt(t)
+	case uint:
+		return otlpInt(int64(t))
+	case uint8:
+		return otlpInt(int64(t))
+	case uint16:
+		return otlpInt(int64(t))
+	case uint32:
+		return otlpInt(int64(t))
+	case uint64:
+		return otlpInt(int64(t))
+	case uintptr:
+		return otlpInt(int64(t))
+	case float32:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: float64(t)}}
+	case float64:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: t}}
+	case []byte:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_BytesValue{BytesValue: t}}
+	case time.Time:
+		return otlpValue(t.UTC().Format(time.RFC3339Nano))
+	case time.Duration:
+		return otlpValue(t.String())
+	case []any:
+		arr := &commonpb.ArrayValue{Values: make([]*commonpb.AnyValue, 0, len(t))}
+		for _, e := range t {
+			arr.Values = append(arr.Values, otlpValue(e))
+		}
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_ArrayValue{ArrayValue: arr}}
+	case map[string]any:
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		kvs := &commonpb.KeyValueList{Values: make([]*commonpb.KeyValue, 0, len(t))}
+		for _, k := range keys {
+			kvs.Values = append(kvs.Values, otlpAttribute(k, t[k]))
+		}
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_KvlistValue{KvlistValue: kvs}}
+	case error:
+		return otlpValue(t.Error())
+	case fmt.Stringer:
+		return otlpValue(t.String())
+	}
+	return otlpValue(fmt.Sprint(v))
+}
+
+func otlpInt(i int64) *commonpb.AnyValue {
+	return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: i}}
+}
@@ -0,0 +1,316 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+
+	"istio.io/pkg/structured"
+)
+
+type otlpCollector struct {
+	collogspb.UnimplementedLogsServiceServer
+
+	mu       sync.Mutex
+	requests []*collogspb.ExportLogsServiceRequest
+	headers  []string
+}
+
+func (c *otlpCollector) Export(ctx context.Context, req *collogspb.ExportLogsServiceRequest) (*collogspb.ExportLogsServiceResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	c.record(req, md.Get("x-tenant"))
+	return &collogspb.ExportLogsServiceResponse{}, nil
+}
+
+func (c *otlpCollector) record(req *collogspb.ExportLogsServiceRequest, headers []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.requests = append(c.requests, req)
+	c.headers = append(c.headers, headers...)
+}
+
+// scopeLogs returns the records received, keyed by scope name.
+func (c *otlpCollector) scopeLogs() map[string][]*logspb.LogRecord {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make(map[string][]*logspb.LogRecord)
+	for _, req := range c.requests {
+		for _, rl := range req.ResourceLogs {
+			for _, sl := range rl.ScopeLogs {
+				out[sl.Scope.Name] = append(out[sl.Scope.Name], sl.LogRecords...)
+			}
+		}
+	}
+	return out
+}
+
+func attributes(r *logspb.LogRecord) map[string]*commonpb.AnyValue {
+	out := make(map[string]*commonpb.AnyValue)
+	for _, kv := range r.Attributes {
+		out[kv.Key] = kv.Value
+	}
+	return out
+}
+
+func logToOTLP(t *testing.T, o *Options) {
+	t.Helper()
+	resetGlobals()
+	// the collector runs gRPC in this process, and it must not race with Configure replacing the gRPC logger
+	o.LogGrpc = false
+	s := RegisterScope("testOTLP", "")
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got %v, expecting success", err)
+	}
+	defer func() {
+		_ = Close()
+		resetGlobals()
+		_ = Configure(DefaultOptions())
+	}()
+
+	s.WithLabels("k", "v", "n", 3).WithContext(ContextWithTraceparent(context.Background(), testTraceparent)).Warn("hello")
+	s.Errorf(&structured.Error{MoreInfo: "more", Err: errors.New("boom")}, "failed")
+	Info("plain")
+	// syncing stdout fails when it is not a file, so only the records received are checked
+	_ = Sync()
+}
+
+func checkOTLPLogs(t *testing.T, c *otlpCollector) {
+	t.Helper()
+	logs := c.scopeLogs()
+
+	scoped := logs["testOTLP"]
+	if len(scoped) != 2 {
+		t.Fatalf("Got %d records for testOTLP, expecting 2", len(scoped))
+	}
+	r := scoped[0]
+	if r.Body.GetStringValue() != "hello" {
+		t.Errorf("Got body %v, expecting hello", r.Body)
+	}
+	if r.SeverityNumber != logspb.SeverityNumber_SEVERITY_NUMBER_WARN || r.SeverityText != "WARN" {
+		t.Errorf("Got severity %v %s, expecting WARN", r.SeverityNumber, r.SeverityText)
+	}
+	if r.TimeUnixNano == 0 {
+		t.Error("Expecting timestamp to be set")
+	}
+	attrs := attributes(r)
+	if attrs["k"].GetStringValue() != "v" || attrs["n"].GetIntValue() != 3 {
+		t.Errorf("Got attributes %v, expecting labels k=v n=3", attrs)
+	}
+	if hex.EncodeToString(r.TraceId) != testTraceID || hex.EncodeToString(r.SpanId) != testSpanID || r.Flags != 1 {
+		t.Errorf("Got trace %x span %x flags %d, expecting trace context", r.TraceId, r.SpanId, r.Flags)
+	}
+	if _, ok := attrs[traceIDKey]; ok {
+		t.Errorf("Got attributes %v, expecting trace context only in the record fields", attrs)
+	}
+
+	r = scoped[1]
+	attrs = attributes(r)
+	if r.Body.GetStringValue() != "failed" || r.SeverityNumber != logspb.SeverityNumber_SEVERITY_NUMBER_ERROR {
+		t.Errorf("Got %v, expecting error record with body failed", r)
+	}
+	if attrs["moreInfo"].GetStringValue() != "more" || attrs["err"].GetStringValue() != "boom" {
+		t.Errorf("Got attributes %v, expecting structured error details", attrs)
+	}
+	if _, ok := attrs["message"]; ok {
+		t.Errorf("Got attributes %v, expecting message only in the body", attrs)
+	}
+
+	if def := logs[DefaultScopeName]; len(def) == 0 || def[0].Body.GetStringValue() != "plain" {
+		t.Errorf("Got %v, expecting a record for the default scope", def)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	res := c.requests[0].ResourceLogs[0].Resource
+	if len(res.Attributes) != 1 || res.Attributes[0].Key != "service.name" || res.Attributes[0].Value.GetStringValue() != "test" {
+		t.Errorf("Got resource %v, expecting service.name=test", res)
+	}
+	if len(c.headers) == 0 || c.headers[0] != "acme" {
+		t.Errorf("Got headers %v, expecting x-tenant to be sent", c.headers)
+	}
+}
+
+func TestOTLPGRPC(t *testing.T) {
+	c := &otlpCollector{}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer()
+	collogspb.RegisterLogsServiceServer(srv, c)
+	go func() { _ = srv.Serve(lis) }()
+	defer srv.Stop()
+
+	for _, json := range []bool{false, true} {
+		c.requests, c.headers = nil, nil
+		o := DefaultOptions()
+		o.JSONEncoding = json
+		logToOTLP(t, o.WithTeeToOTLP(OTLPOptions{
+			Endpoint: lis.Addr().String(),
+			Insecure: true,
+			Headers:  map[string]string{"x-tenant": "acme"},
+			Resource: map[string]string{"service.name": "test"},
+		}))
+		checkOTLPLogs(t, c)
+	}
+}
+
+func TestOTLPHTTP(t *testing.T) {
+	c := &otlpCollector{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/logs" || r.Header.Get("Content-Type") != "application/x-protobuf" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		req := &collogspb.ExportLogsServiceRequest{}
+		if err := proto.Unmarshal(body, req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		c.record(req, r.Header.Values("x-tenant"))
+	}))
+	defer srv.Close()
+
+	logToOTLP(t, DefaultOptions().WithTeeToOTLP(OTLPOptions{
+		Protocol: OTLPProtocolHTTP,
+		Endpoint: srv.Listener.Addr().String(),
+		Insecure: true,
+		Headers:  map[string]string{"x-tenant": "acme"},
+		Resource: map[string]string{"service.name": "test"},
+	}))
+	checkOTLPLogs(t, c)
+}
+
+func TestOTLPBatching(t *testing.T) {
+	c := &otlpCollector{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		req := &collogspb.ExportLogsServiceRequest{}
+		_ = proto.Unmarshal(body, req)
+		c.record(req, nil)
+	}))
+	defer srv.Close()
+
+	b, err := newOTLPBatcher(OTLPOptions{
+		Protocol:      OTLPProtocolHTTP,
+		Endpoint:      srv.URL + "/custom",
+		BatchSize:     2,
+		MaxQueueSize:  3,
+		FlushInterval: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.close()
+
+	// a full batch is exported without waiting for the flush interval
+	for i := 0; i < 2; i++ {
+		b.add(otlpRecord{scope: "a", record: &logspb.LogRecord{}})
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(c.scopeLogs()["a"]) != 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := len(c.scopeLogs()["a"]); got != 2 {
+		t.Fatalf("Got %d records, expecting a full batch to be exported", got)
+	}
+
+	// records beyond the queue size are dropped
+	b.mu.Lock()
+	for len(b.pending) < 3 {
+		b.pending = append(b.pending, otlpRecord{scope: "b", record: &logspb.LogRecord{}})
+	}
+	b.mu.Unlock()
+	dropped := sumValue(t, "log_otlp_records_dropped_total")
+	b.add(otlpRecord{scope: "b", record: &logspb.LogRecord{}})
+	b.add(otlpRecord{scope: "b", record: &logspb.LogRecord{}})
+	if d := sumValue(t, "log_otlp_records_dropped_total") - dropped; d != 2 {
+		t.Errorf("Got %v dropped records, expecting 2", d)
+	}
+
+	// the drops are reported once by the next sync
+	if err := b.sync(); err == nil || !strings.Contains(err.Error(), "dropped 2 log records") {
+		t.Errorf("Got %v, expecting the dropped records to be reported", err)
+	}
+	if err := b.sync(); err != nil {
+		t.Errorf("Got %v, expecting the drops to be reported once", err)
+	}
+}
+
+func TestOTLPBadOptions(t *testing.T) {
+	for _, cfg := range []OTLPOptions{
+		{},
+		{Endpoint: "localhost:4317", Protocol: "carrier-pigeon"},
+	} {
+		if err := Configure(DefaultOptions().WithTeeToOTLP(cfg)); err == nil {
+			t.Errorf("Got success for %+v, expecting error", cfg)
+		}
+	}
+	_ = Configure(DefaultOptions())
+}
+
+func TestOTLPClosedOnReconfigure(t *testing.T) {
+	c := &otlpCollector{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		req := &collogspb.ExportLogsServiceRequest{}
+		_ = proto.Unmarshal(body, req)
+		c.record(req, nil)
+	}))
+	defer srv.Close()
+
+	resetGlobals()
+	defer func() {
+		resetGlobals()
+		_ = Configure(DefaultOptions())
+	}()
+	o := DefaultOptions().WithTeeToOTLP(OTLPOptions{
+		Protocol:      OTLPProtocolHTTP,
+		Endpoint:      srv.Listener.Addr().String(),
+		Insecure:      true,
+		FlushInterval: time.Hour,
+	})
+	o.LogGrpc = false
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got %v, expecting success", err)
+	}
+	Info("pending")
+
+	// replacing the configuration closes the batcher, which exports the pending records
+	if err := Configure(DefaultOptions()); err != nil {
+		t.Fatalf("Got %v, expecting success", err)
+	}
+	if def := c.scopeLogs()[DefaultScopeName]; len(def) != 1 || def[0].Body.GetStringValue() != "pending" {
+		t.Errorf("Got %v, expecting the pending record to be exported", def)
+	}
+}
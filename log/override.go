@@ -0,0 +1,136 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// LevelOverride describes a temporary change of the output level of a scope.
+type LevelOverride struct {
+	// Scope is the name of the scope.
+	Scope string
+	// Level is the output level in effect until Expires.
+	Level Level
+	// Previous is the output level restored when the override expires or is cancelled.
+	Previous Level
+	// Expires is when the override ends.
+	Expires time.Time
+}
+
+type levelOverride struct {
+	LevelOverride
+	timer *time.Timer
+}
+
+var (
+	overridesMu sync.Mutex
+	// overrides holds the active overrides, keyed by registered scope.
+	overrides = make(map[*Scope]*levelOverride)
+)
+
+// SetOutputLevelFor sets the output level of the scope for the given duration, after which the level in
+// effect before the override is restored. Overriding the level again extends or shortens the override,
+// still restoring the original level, while setting the level with SetOutputLevel ends the override
+// without restoring anything.
+func (s *Scope) SetOutputLevelFor(l Level, d time.Duration) {
+	overridesMu.Lock()
+	defer overridesMu.Unlock()
+
+	previous := s.GetOutputLevel()
+	if o, ok := overrides[s]; ok {
+		o.timer.Stop()
+		previous = o.Previous
+	}
+
+	o := &levelOverride{LevelOverride: LevelOverride{
+		Scope:    s.name,
+		Level:    l,
+		Previous: previous,
+		Expires:  time.Now().Add(d),
+	}}
+	o.timer = time.AfterFunc(d, func() { expireLevelOverride(s, o) })
+	overrides[s] = o
+	s.storeOutputLevel(l)
+}
+
+// GetLevelOverride returns the active override of the output level of the scope, if any.
+func (s *Scope) GetLevelOverride() (LevelOverride, bool) {
+	overridesMu.Lock()
+	defer overridesMu.Unlock()
+	if o, ok := overrides[s]; ok {
+		return o.LevelOverride, true
+	}
+	return LevelOverride{}, false
+}
+
+// LevelOverrides returns the active overrides of output levels, sorted by scope name.
+func LevelOverrides() []LevelOverride {
+	overridesMu.Lock()
+	defer overridesMu.Unlock()
+	out := make([]LevelOverride, 0, len(overrides))
+	for _, o := range overrides {
+		out = append(out, o.LevelOverride)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Scope < out[j].Scope })
+	return out
+}
+
+// CancelLevelOverride ends the override of the output level of the named scope, restoring the level in
+// effect before it. It returns false if the scope has no active override.
+func CancelLevelOverride(scope string) bool {
+	s := FindScope(scope)
+	if s == nil {
+		return false
+	}
+
+	overridesMu.Lock()
+	defer overridesMu.Unlock()
+	o, ok := overrides[s]
+	if !ok {
+		return false
+	}
+	o.timer.Stop()
+	delete(overrides, s)
+	s.storeOutputLevel(o.Previous)
+	return true
+}
+
+// expireLevelOverride restores the level in effect before o, unless o was replaced or ended meanwhile.
+func expireLevelOverride(s *Scope, o *levelOverride) {
+	overridesMu.Lock()
+	if overrides[s] != o {
+		overridesMu.Unlock()
+		return
+	}
+	delete(overrides, s)
+	s.storeOutputLevel(o.Previous)
+	overridesMu.Unlock()
+
+	defaultScope.Infof("temporary output level %s of scope %s expired, restored %s",
+		levelToString[o.Level], o.Scope, levelToString[o.Previous])
+}
+
+// dropLevelOverride ends the override of the output level of s, if any, without restoring anything.
+func dropLevelOverride(s *Scope) {
+	overridesMu.Lock()
+	defer overridesMu.Unlock()
+	if o, ok := overrides[s]; ok {
+		o.timer.Stop()
+		delete(overrides, s)
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"istio.io/pkg/structured"
+)
+
+func waitForLevel(t *testing.T, s *Scope, l Level) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for s.GetOutputLevel() != l {
+		if time.Now().After(deadline) {
+			t.Fatalf("Got %v, expecting the output level to become %v", s.GetOutputLevel(), l)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestLevelOverride(t *testing.T) {
+	_ = Configure(DefaultOptions())
+	s := RegisterScope("testLevelOverride", "")
+	s.SetOutputLevel(WarnLevel)
+
+	// the expiry is logged after the level is restored, so wait for the message before other tests
+	// reset the globals it uses
+	expired := make(chan struct{})
+	var once sync.Once
+	defer AddHandler(func(_ Level, _ *Scope, _ *structured.Error, msg string) {
+		if strings.Contains(msg, "scope testLevelOverride expired") {
+			once.Do(func() { close(expired) })
+		}
+	})()
+
+	s.SetOutputLevelFor(DebugLevel, 50*time.Millisecond)
+	if s.GetOutputLevel() != DebugLevel {
+		t.Errorf("Got %v, expecting the override to apply", s.GetOutputLevel())
+	}
+	o, ok := s.GetLevelOverride()
+	if !ok || o.Scope != "testLevelOverride" || o.Level != DebugLevel || o.Previous != WarnLevel || o.Expires.IsZero() {
+		t.Errorf("Got %+v %v, expecting an active override", o, ok)
+	}
+
+	// overriding again keeps the original level to restore
+	s.SetOutputLevelFor(InfoLevel, 50*time.Millisecond)
+	if o, _ := s.GetLevelOverride(); o.Previous != WarnLevel {
+		t.Errorf("Got %v, expecting warn to be restored", o.Previous)
+	}
+
+	found := false
+	for _, lo := range LevelOverrides() {
+		found = found || lo.Scope == "testLevelOverride"
+	}
+	if !found {
+		t.Errorf("Got %v, expecting the override to be listed", LevelOverrides())
+	}
+
+	waitForLevel(t, s, WarnLevel)
+	if _, ok := s.GetLevelOverride(); ok {
+		t.Error("Expecting the override to be removed once expired")
+	}
+	select {
+	case <-expired:
+	case <-time.After(5 * time.Second):
+		t.Error("Timed out waiting for the expiry to be logged")
+	}
+}
+
+func TestCancelLevelOverride(t *testing.T) {
+	s := RegisterScope("testCancelLevelOverride", "")
+	s.SetOutputLevel(ErrorLevel)
+
+	s.SetOutputLevelFor(DebugLevel, time.Hour)
+	if !CancelLevelOverride("testCancelLevelOverride") || s.GetOutputLevel() != ErrorLevel {
+		t.Errorf("Got %v, expecting the cancelled override to restore error", s.GetOutputLevel())
+	}
+	if CancelLevelOverride("testCancelLevelOverride") || CancelLevelOverride("missing") {
+		t.Error("Expecting no override to cancel")
+	}
+
+	// setting the level ends the override without restoring anything
+	s.SetOutputLevelFor(DebugLevel, 20*time.Millisecond)
+	s.SetOutputLevel(InfoLevel)
+	if _, ok := s.GetLevelOverride(); ok {
+		t.Error("Expecting SetOutputLevel to end the override")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if s.GetOutputLevel() != InfoLevel {
+		t.Errorf("Got %v, expecting the level set explicitly to be kept", s.GetOutputLevel())
+	}
+}
@@ -0,0 +1,287 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"istio.io/pkg/structured"
+)
+
+// RedactedValue replaces sensitive values in the log output.
+const RedactedValue = "[REDACTED]"
+
+var (
+	// defaultSensitiveKeys are label keys whose values are always redacted.
+	defaultSensitiveKeys = []string{"authorization", "password", "secret", "token"}
+
+	// defaultSensitivePatterns match bearer credentials of Authorization headers, token-shaped bearer
+	// credentials elsewhere, JWTs and PEM encoded private keys. Bearer credentials must be one of these so
+	// that prose such as "the bearer of" is kept.
+	defaultSensitivePatterns = []sensitivePattern{
+		{
+			re:          regexp.MustCompile(`(?i)(\bauthorization"?\s*[:=]\s*"?)bearer\s+[A-Za-z0-9\-._~+/]+=*`),
+			hint:        "authorization",
+			replacement: "${1}" + RedactedValue,
+		},
+		{
+			re:          regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9\-._~+/]{20,}=*`),
+			hint:        "bearer",
+			replacement: RedactedValue,
+		},
+		{
+			re:          regexp.MustCompile(`\beyJ[A-Za-z0-9_-]*\.eyJ[A-Za-z0-9_-]*\.[A-Za-z0-9_-]*`),
+			hint:        "eyj",
+			replacement: RedactedValue,
+		},
+		{
+			re:          regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`),
+			hint:        "private key",
+			replacement: RedactedValue,
+		},
+	}
+)
+
+// sensitivePattern is a pattern whose matches are replaced in the output.
+type sensitivePattern struct {
+	re *regexp.Regexp
+	// hint is a lowercase string that all matches contain regardless of case, so that the pattern is only
+	// run on the strings that contain it. Registered patterns have no hint and run on all strings.
+	hint string
+	// replacement is the template the matches are replaced with, see regexp.Regexp.Expand.
+	replacement string
+}
+
+// redactor holds the registered sensitive keys and patterns. It is immutable once stored.
+type redactor struct {
+	keys     map[string]struct{}
+	patterns []sensitivePattern
+}
+
+var (
+	redaction   atomic.Value
+	redactionMu sync.Mutex
+)
+
+func init() {
+	r := &redactor{keys: make(map[string]struct{})}
+	for _, k := range defaultSensitiveKeys {
+		r.keys[k] = struct{}{}
+	}
+	r.patterns = append(r.patterns, defaultSensitivePatterns...)
+	redaction.Store(r)
+}
+
+func getRedactor() *redactor {
+	return redaction.Load().(*redactor)
+}
+
+// updateRedactor replaces the redactor with a modified copy.
+func updateRedactor(update func(r *redactor)) {
+	redactionMu.Lock()
+	defer redactionMu.Unlock()
+
+	cur := getRedactor()
+	r := &redactor{
+		keys:     make(map[string]struct{}, len(cur.keys)),
+		patterns: append([]sensitivePattern(nil), cur.patterns...),
+	}
+	for k := range cur.keys {
+		r.keys[k] = struct{}{}
+	}
+	update(r)
+	redaction.Store(r)
+}
+
+// RegisterSensitiveKeys registers label and field keys whose values are replaced by RedactedValue in
+// the output of every scope that has redaction enabled. Keys are matched regardless of case.
+// The keys authorization, password, secret and token are registered by default.
+func RegisterSensitiveKeys(keys ...string) {
+	updateRedactor(func(r *redactor) {
+		for _, k := range keys {
+			r.keys[strings.ToLower(k)] = struct{}{}
+		}
+	})
+}
+
+// RegisterSensitivePattern registers a regular expression whose matches are replaced by RedactedValue in
+// messages, label values and error details of every scope that has redaction enabled. Patterns matching
+// bearer credentials, JWTs and PEM encoded private keys are registered by default.
+func RegisterSensitivePattern(expr string) error {
+	p, err := regexp.Compile(expr)
+	if err != nil {
+		return fmt.Errorf("invalid sensitive pattern '%s': %v", expr, err)
+	}
+	updateRedactor(func(r *redactor) {
+		r.patterns = append(r.patterns, sensitivePattern{re: p, replacement: RedactedValue})
+	})
+	return nil
+}
+
+func (r *redactor) sensitiveKey(key string) bool {
+	_, ok := r.keys[strings.ToLower(key)]
+	return ok
+}
+
+// redactString replaces the matches of all patterns in s. Patterns with a hint are skipped unless s
+// contains it, which is much cheaper than running them, as most strings hold no sensitive data.
+func (r *redactor) redactString(s string) string {
+	if s == "" {
+		return s
+	}
+	var lower string
+	for _, p := range r.patterns {
+		if p.hint != "" {
+			if lower == "" {
+				lower = strings.ToLower(s)
+			}
+			if !strings.Contains(lower, p.hint) {
+				continue
+			}
+		}
+		s = p.re.ReplaceAllString(s, p.replacement)
+	}
+	return s
+}
+
+// redactValue returns the redacted form of a label or field value, and whether it was changed. Values
+// other than numbers and booleans are checked in their string form.
+func (r *redactor) redactValue(key string, v any) (any, bool) {
+	if r.sensitiveKey(key) {
+		return RedactedValue, true
+	}
+
+	var s string
+	switch tv := v.(type) {
+	case nil, bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return v, false
+	case string:
+		s = tv
+	default:
+		s = fmt.Sprint(v)
+	}
+	if rs := r.redactString(s); rs != s {
+		return rs, true
+	}
+	return v, false
+}
+
+// redactRecord returns the message, labels and error details of a log call with sensitive data replaced.
+// scope and ie are copied before being changed.
+func (r *redactor) redactRecord(scope *Scope, ie *structured.Error, msg string) (*Scope, *structured.Error, string) {
+	msg = r.redactString(msg)
+
+	copied := false
+	for _, k := range scope.labelKeys {
+		if v, changed := r.redactValue(k, scope.labels[k]); changed {
+			if !copied {
+				scope = scope.copy()
+				copied = true
+			}
+			scope.labels[k] = v
+		}
+	}
+
+	if ie != nil {
+		out := *ie
+		out.MoreInfo = r.redactString(ie.MoreInfo)
+		out.Impact = r.redactString(ie.Impact)
+		out.Action = r.redactString(ie.Action)
+		out.LikelyCause = r.redactString(ie.LikelyCause)
+		if ie.Err != nil {
+			if s := ie.Err.Error(); r.redactString(s) != s {
+				out.Err = errors.New(r.redactString(s))
+			}
+		}
+		ie = &out
+	}
+	return scope, ie, msg
+}
+
+// redactFields returns fields with sensitive values replaced. fields is copied before being changed.
+func (r *redactor) redactFields(fields []zapcore.Field) []zapcore.Field {
+	copied := false
+	for i, f := range fields {
+		var v any
+		switch f.Type {
+		case zapcore.StringType:
+			v = f.String
+		case zapcore.ErrorType, zapcore.StringerType, zapcore.ReflectType, zapcore.ByteStringType, zapcore.BinaryType:
+			v = f.Interface
+			if b, ok := v.([]byte); ok {
+				v = string(b)
+			}
+		case zapcore.SkipType:
+			continue
+		default:
+			if !r.sensitiveKey(f.Key) {
+				continue
+			}
+		}
+		if rv, changed := r.redactValue(f.Key, v); changed {
+			if !copied {
+				fields = append([]zapcore.Field(nil), fields...)
+				copied = true
+			}
+			fields[i] = zap.String(f.Key, fmt.Sprint(rv))
+		}
+	}
+	return fields
+}
+
+// redactingCore redacts entries that were not logged through a scope, such as those of the global zap,
+// standard library and gRPC loggers. Entries logged through a scope are redacted before they reach the
+// core, as the console encoding flattens labels into the message.
+type redactingCore struct {
+	zapcore.Core
+}
+
+func newRedactingCore(core zapcore.Core) zapcore.Core {
+	return &redactingCore{Core: core}
+}
+
+// With implements zapcore.Core.
+func (rc *redactingCore) With(fields []zapcore.Field) zapcore.Core {
+	return &redactingCore{Core: rc.Core.With(getRedactor().redactFields(fields))}
+}
+
+// Check implements zapcore.Core.
+func (rc *redactingCore) Check(e zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if rc.Enabled(e.Level) {
+		return ce.AddCore(e, rc)
+	}
+	return ce
+}
+
+// Write implements zapcore.Core.
+func (rc *redactingCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	if findRecord(fields) == nil {
+		if s := FindScope(entry.LoggerName); s == nil || s.GetRedaction() {
+			r := getRedactor()
+			entry.Message = r.redactString(entry.Message)
+			entry.Stack = r.redactString(entry.Stack)
+			fields = r.redactFields(fields)
+		}
+	}
+	return rc.Core.Write(entry, fields)
+}
@@ -0,0 +1,302 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/yaml"
+
+	"istio.io/pkg/filewatcher"
+)
+
+// FileConfig holds the scope settings read from Options.ConfigFile, in YAML or JSON form:
+//
+//	outputLevels:
+//	  default: info
+//	  ads: debug
+//	stackTraceLevels:
+//	  ads: error
+//	logCallers: [ads]
+//	sampling:
+//	  ads: 100/10/1s
+//	dedup:
+//	  ads: 10s
+//
+// Maps are keyed by scope name or pattern, where the name "all" applies to every scope before any
+// individual settings. Settings for a scope also apply to its descendants, unless a more specific name
+// or pattern selects them. The file is applied on top of the settings given to Configure, and only changes the
+// scopes and settings it selects, replacing any changes made through ControlZ in between. When an update no
+// longer selects a setting, it gets back the value it had before the file set it, unless it was changed since.
+type FileConfig struct {
+	OutputLevels     map[string]string `json:"outputLevels,omitempty"`
+	StackTraceLevels map[string]string `json:"stackTraceLevels,omitempty"`
+	LogCallers       []string          `json:"logCallers,omitempty"`
+	Sampling         map[string]string `json:"sampling,omitempty"`
+	Dedup            map[string]string `json:"dedup,omitempty"`
+}
+
+// scopeSetting is a dynamically adjustable setting of scopes.
+type scopeSetting struct {
+	get func(*Scope) any
+	set func(*Scope, any)
+}
+
+var (
+	outputLevelSetting = &scopeSetting{
+		get: func(s *Scope) any { return s.GetOutputLevel() },
+		set: func(s *Scope, v any) { s.SetOutputLevel(v.(Level)) },
+	}
+	stackTraceLevelSetting = &scopeSetting{
+		get: func(s *Scope) any { return s.GetStackTraceLevel() },
+		set: func(s *Scope, v any) { s.SetStackTraceLevel(v.(Level)) },
+	}
+	logCallersSetting = &scopeSetting{
+		get: func(s *Scope) any { return s.GetLogCallers() },
+		set: func(s *Scope, v any) { s.SetLogCallers(v.(bool)) },
+	}
+	samplingSetting = &scopeSetting{
+		get: func(s *Scope) any { return s.GetSampling() },
+		set: func(s *Scope, v any) { s.SetSampling(v.(Sampling)) },
+	}
+	dedupSetting = &scopeSetting{
+		get: func(s *Scope) any { return s.GetDedupWindow() },
+		set: func(s *Scope, v any) { s.SetDedupWindow(v.(time.Duration)) },
+	}
+)
+
+// fileSettingKey identifies a setting of a scope.
+type fileSettingKey struct {
+	scope   *Scope
+	setting *scopeSetting
+}
+
+// fileSettingValue is a setting applied from the configuration file, along with the value it replaced.
+type fileSettingValue struct {
+	previous any
+	applied  any
+}
+
+var (
+	// newFileWatcher creates the watcher of the configuration file, and can be replaced by tests.
+	newFileWatcher filewatcher.NewFileWatcherFunc = filewatcher.NewWatcher
+
+	// configFileMu serializes updates from the configuration file.
+	configFileMu sync.Mutex
+	// stopConfigWatch stops watching the configuration file of the last Configure call.
+	stopConfigWatch func() error
+	// fileSettings holds the settings applied from the configuration file of the last Configure call.
+	fileSettings map[fileSettingKey]fileSettingValue
+)
+
+// loadConfigFile reads the configuration file at path. A missing file holds no settings.
+func loadConfigFile(path string) (*FileConfig, error) {
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &FileConfig{}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to read log configuration file %s: %v", path, err)
+	}
+
+	cfg := &FileConfig{}
+	if err := yaml.UnmarshalStrict(b, cfg); err != nil {
+		return nil, fmt.Errorf("invalid log configuration file %s: %v", path, err)
+	}
+	return cfg, nil
+}
+
+func parseLevel(l string) (Level, error) {
+	if level, ok := stringToLevel[l]; ok {
+		return level, nil
+	}
+	return NoneLevel, fmt.Errorf("invalid output level '%s'", l)
+}
+
+// overlayScoped parses the per-scope values of m and applies them to the scopes. The global override
+// is applied first, and each scope then gets the value of the scope name or pattern that selects it
+// most closely.
+func overlayScoped[T any](allScopes map[string]*Scope, m map[string]string, parse func(string) (T, error), setter func(*Scope, T)) error {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var patterns []string
+	var values []T
+	for _, name := range names {
+		v, err := parse(m[name])
+		if err != nil {
+			return fmt.Errorf("scope %s: %v", name, err)
+		}
+
+		if name == OverrideScopeName {
+			for _, scope := range allScopes {
+				setter(scope, v)
+			}
+			continue
+		}
+		patterns = append(patterns, name)
+		values = append(values, v)
+	}
+
+	applyScoped(allScopes, patterns, values, setter)
+	return nil
+}
+
+// applyConfigFile applies the settings of cfg to the scopes it selects. Settings set by a previous version
+// of the file but no longer selected are restored to the value they had before, unless they were changed
+// since. Other scopes and settings are left alone. Nothing is applied unless all of the settings are valid.
+func applyConfigFile(cfg *FileConfig) error {
+	allScopes := Scopes()
+
+	target := make(map[fileSettingKey]any)
+	setter := func(setting *scopeSetting) func(*Scope, any) {
+		return func(s *Scope, v any) { target[fileSettingKey{scope: s, setting: setting}] = v }
+	}
+	if err := overlayScoped(allScopes, cfg.OutputLevels, parseLevel, typed[Level](setter(outputLevelSetting))); err != nil {
+		return fmt.Errorf("invalid output level for %v", err)
+	}
+	if err := overlayScoped(allScopes, cfg.StackTraceLevels, parseLevel, typed[Level](setter(stackTraceLevelSetting))); err != nil {
+		return fmt.Errorf("invalid stack trace level for %v", err)
+	}
+	if err := overlayScoped(allScopes, cfg.Sampling, ParseSampling, typed[Sampling](setter(samplingSetting))); err != nil {
+		return fmt.Errorf("invalid sampling for %v", err)
+	}
+	if err := overlayScoped(allScopes, cfg.Dedup, parseDedupWindow, typed[time.Duration](setter(dedupSetting))); err != nil {
+		return fmt.Errorf("invalid deduplication window for %v", err)
+	}
+	processScopeList(allScopes, strings.Join(cfg.LogCallers, ","), func(s *Scope) { setter(logCallersSetting)(s, true) })
+
+	applied := make(map[fileSettingKey]fileSettingValue, len(target))
+	for key, v := range target {
+		fv, ok := fileSettings[key]
+		if !ok {
+			fv.previous = key.setting.get(key.scope)
+		}
+		if key.setting.get(key.scope) != v {
+			key.setting.set(key.scope, v)
+		}
+		fv.applied = v
+		applied[key] = fv
+	}
+	for key, fv := range fileSettings {
+		if _, ok := target[key]; !ok && key.setting.get(key.scope) == fv.applied {
+			key.setting.set(key.scope, fv.previous)
+		}
+	}
+	fileSettings = applied
+	return nil
+}
+
+// typed adapts a setter of settings of any type to values of type T.
+func typed[T any](setter func(*Scope, any)) func(*Scope, T) {
+	return func(s *Scope, v T) { setter(s, v) }
+}
+
+// watchConfigFile applies the configuration file of options, if any, and keeps applying it whenever
+// it changes until the returned function is called. Any previously watched file is no longer watched.
+func watchConfigFile(options *Options) (func() error, error) {
+	configFileMu.Lock()
+	defer configFileMu.Unlock()
+
+	if stopConfigWatch != nil {
+		_ = stopConfigWatch()
+		stopConfigWatch = nil
+	}
+	// the settings of the previous file are kept, unless the new one changes them
+	fileSettings = nil
+
+	path := options.ConfigFile
+	if path == "" {
+		return func() error { return nil }, nil
+	}
+
+	cfg, err := loadConfigFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyConfigFile(cfg); err != nil {
+		return nil, fmt.Errorf("log configuration file %s: %v", path, err)
+	}
+
+	w := newFileWatcher()
+	if err := w.Add(path); err != nil {
+		_ = w.Close()
+		return nil, fmt.Errorf("unable to watch log configuration file %s: %v", path, err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case _, ok := <-w.Events(path):
+				if !ok {
+					return
+				}
+				reloadConfigFile(options, done)
+			case err, ok := <-w.Errors(path):
+				if !ok {
+					return
+				}
+				defaultScope.Warnf("error watching log configuration file %s: %v", path, err)
+			}
+		}
+	}()
+
+	var once sync.Once
+	stop := func() error {
+		var err error
+		once.Do(func() {
+			close(done)
+			err = w.Close()
+		})
+		return err
+	}
+	stopConfigWatch = stop
+	return stop, nil
+}
+
+// reloadConfigFile applies the configuration file of options after it changed. Invalid updates
+// are rejected, leaving the current settings in place.
+func reloadConfigFile(options *Options, done chan struct{}) {
+	configFileMu.Lock()
+	defer configFileMu.Unlock()
+
+	select {
+	case <-done:
+		// superseded by a later call to Configure
+		return
+	default:
+	}
+
+	path := options.ConfigFile
+	cfg, err := loadConfigFile(path)
+	if err == nil {
+		err = applyConfigFile(cfg)
+	}
+	if err != nil {
+		defaultScope.Errorf("rejected update of log configuration file %s: %v", path, err)
+		return
+	}
+	defaultScope.Infof("applied log configuration file %s", path)
+}
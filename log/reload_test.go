@@ -0,0 +1,273 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"istio.io/pkg/filewatcher"
+)
+
+func writeConfigFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConfigFile(t *testing.T) {
+	resetGlobals()
+	a := RegisterScope("testConfigFileA", "")
+	b := RegisterScope("testConfigFileB", "")
+
+	newWatcher, watcher := filewatcher.NewFakeWatcher(nil)
+	old := newFileWatcher
+	newFileWatcher = newWatcher
+	defer func() {
+		newFileWatcher = old
+		resetGlobals()
+		_ = Configure(DefaultOptions())
+	}()
+
+	path := filepath.Join(t.TempDir(), "log.yaml")
+	writeConfigFile(t, path, `
+outputLevels:
+  all: warn
+  testConfigFileA: debug
+stackTraceLevels:
+  testConfigFileB: error
+logCallers: [testConfigFileA]
+sampling:
+  testConfigFileB: 10/5/1s
+dedup:
+  testConfigFileA: 30s
+`)
+
+	logPath := filepath.Join(t.TempDir(), "out.log")
+	o := DefaultOptions()
+	o.OutputPaths = []string{logPath}
+	o.SetOutputLevel("testConfigFileB", ErrorLevel)
+	o.ConfigFile = path
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got %v, expecting success", err)
+	}
+
+	if a.GetOutputLevel() != DebugLevel || !a.GetLogCallers() || a.GetDedupWindow() != 30*time.Second {
+		t.Errorf("Got %v %v %v, expecting scope settings from the file", a.GetOutputLevel(), a.GetLogCallers(), a.GetDedupWindow())
+	}
+	if b.GetOutputLevel() != WarnLevel || b.GetStackTraceLevel() != ErrorLevel || b.GetSampling() != (Sampling{Interval: time.Second, First: 10, Thereafter: 5}) {
+		t.Errorf("Got %v %v %v, expecting the file to override the options", b.GetOutputLevel(), b.GetStackTraceLevel(), b.GetSampling())
+	}
+	if defaultScope.GetOutputLevel() != WarnLevel {
+		t.Errorf("Got %v, expecting the override to apply to the default scope", defaultScope.GetOutputLevel())
+	}
+
+	reload := func(content string) {
+		t.Helper()
+		writeConfigFile(t, path, content)
+		watcher.InjectEvent(path, fsnotify.Event{Name: path, Op: fsnotify.Write})
+	}
+	waitFor := func(cond func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatal("Timed out waiting for the configuration file to be applied")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	// settings no longer in the file revert to the options
+	reload(`{"outputLevels": {"testConfigFileA": "error"}}`)
+	waitFor(func() bool { return a.GetOutputLevel() == ErrorLevel })
+	if a.GetLogCallers() || a.GetDedupWindow() != 0 || b.GetOutputLevel() != ErrorLevel || b.GetStackTraceLevel() != NoneLevel ||
+		b.GetSampling().Enabled() {
+		t.Errorf("Got %v %v %v %v %v, expecting removed settings to revert",
+			a.GetLogCallers(), a.GetDedupWindow(), b.GetOutputLevel(), b.GetStackTraceLevel(), b.GetSampling())
+	}
+	if defaultScope.GetOutputLevel() != InfoLevel {
+		t.Errorf("Got %v, expecting the default scope to revert", defaultScope.GetOutputLevel())
+	}
+
+	// invalid updates are rejected as a whole
+	for _, bad := range []string{
+		`{"outputLevels": {"testConfigFileA": "info", "testConfigFileB": "loud"}}`,
+		`{"sampling": {"testConfigFileB": "1/1"}}`,
+		`{"dedup": {"testConfigFileB": "soon"}}`,
+		`{"outputLevel": {"testConfigFileA": "info"}}`,
+		`outputLevels: [`,
+	} {
+		reload(bad)
+		waitFor(func() bool {
+			out, _ := os.ReadFile(logPath)
+			return strings.Contains(string(out), "rejected update of log configuration file")
+		})
+		_ = os.Truncate(logPath, 0)
+		if a.GetOutputLevel() != ErrorLevel || b.GetOutputLevel() != ErrorLevel {
+			t.Errorf("Got %v %v for %q, expecting no partial update", a.GetOutputLevel(), b.GetOutputLevel(), bad)
+		}
+	}
+
+	// configuring again stops watching the file
+	if err := Configure(DefaultOptions()); err != nil {
+		t.Fatalf("Got %v, expecting success", err)
+	}
+	if a.GetOutputLevel() != ErrorLevel {
+		t.Errorf("Got %v, expecting settings to be kept", a.GetOutputLevel())
+	}
+}
+
+func TestConfigFileInvalid(t *testing.T) {
+	dir := t.TempDir()
+	newWatcher, _ := filewatcher.NewFakeWatcher(nil)
+	old := newFileWatcher
+	newFileWatcher = newWatcher
+	defer func() {
+		newFileWatcher = old
+		_ = Configure(DefaultOptions())
+	}()
+
+	path := filepath.Join(dir, "log.yaml")
+	writeConfigFile(t, path, `outputLevels: {default: loud}`)
+	o := DefaultOptions()
+	o.ConfigFile = path
+	if err := Configure(o); err == nil || !strings.Contains(err.Error(), "invalid output level") {
+		t.Errorf("Got %v, expecting an invalid output level error", err)
+	}
+
+	// a missing file holds no settings
+	o.ConfigFile = filepath.Join(dir, "missing.yaml")
+	if err := Configure(o); err != nil {
+		t.Errorf("Got %v, expecting success", err)
+	}
+}
+
+func TestConfigureFailureLeavesNothingRunning(t *testing.T) {
+	resetGlobals()
+	a := RegisterScope("testConfigureFailure", "")
+	watchers := 0
+	newWatcher, _ := filewatcher.NewFakeWatcher(nil)
+	old := newFileWatcher
+	newFileWatcher = func() filewatcher.FileWatcher {
+		watchers++
+		return newWatcher()
+	}
+	defer func() {
+		newFileWatcher = old
+		resetGlobals()
+		_ = Configure(DefaultOptions())
+	}()
+	if err := Configure(DefaultOptions()); err != nil {
+		t.Fatalf("Got %v, expecting success", err)
+	}
+	goroutines := runtime.NumGoroutine()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "log.yaml")
+	writeConfigFile(t, path, `outputLevels: {testConfigureFailure: debug}`)
+	o := DefaultOptions()
+	o.ConfigFile = path
+	o.RotateOutputPath = filepath.Join(dir, "rotated.log")
+	o.WithTeeToUDS("localhost", filepath.Join(dir, "missing.sock"))
+	o.WithTeeToSyslog(SyslogOptions{Network: "unix", Address: filepath.Join(dir, "missing.sock")})
+	o.WithAsync(AsyncOptions{})
+	if err := Configure(o); err == nil {
+		t.Fatal("Got success, expecting the syslog writer to fail")
+	}
+
+	if watchers != 0 || stopConfigWatch != nil {
+		t.Errorf("Got %d watchers, expecting the configuration file not to be watched", watchers)
+	}
+	if a.GetOutputLevel() != InfoLevel {
+		t.Errorf("Got %v, expecting the configuration file not to be applied", a.GetOutputLevel())
+	}
+	rotatingFilesMu.Lock()
+	files := len(rotatingFiles)
+	rotatingFilesMu.Unlock()
+	if files != 0 {
+		t.Errorf("Got %d rotating files, expecting the previous ones to be kept", files)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > goroutines {
+		if time.Now().After(deadline) {
+			t.Fatalf("Got %d goroutines, expecting %d", runtime.NumGoroutine(), goroutines)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestConfigFileKeepsOtherSettings(t *testing.T) {
+	resetGlobals()
+	a := RegisterScope("testConfigFileKeepA", "")
+	b := RegisterScope("testConfigFileKeepB", "")
+	defer func() {
+		resetGlobals()
+		_ = Configure(DefaultOptions())
+	}()
+
+	path := filepath.Join(t.TempDir(), "log.yaml")
+	writeConfigFile(t, path, `{"outputLevels": {"testConfigFileKeepA": "debug"}}`)
+	o := DefaultOptions()
+	o.ConfigFile = path
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got %v, expecting success", err)
+	}
+
+	// settings made in code and temporary overrides of scopes the file doesn't select are kept
+	b.SetStackTraceLevel(ErrorLevel)
+	b.SetOutputLevelFor(DebugLevel, time.Hour)
+	writeConfigFile(t, path, `{"outputLevels": {"testConfigFileKeepA": "warn"}, "logCallers": [testConfigFileKeepA]}`)
+	if err := reapplyConfigFile(path); err != nil {
+		t.Fatalf("Got %v, expecting success", err)
+	}
+	if a.GetOutputLevel() != WarnLevel || !a.GetLogCallers() {
+		t.Errorf("Got %v %v, expecting the file to apply", a.GetOutputLevel(), a.GetLogCallers())
+	}
+	if _, ok := b.GetLevelOverride(); !ok || b.GetOutputLevel() != DebugLevel || b.GetStackTraceLevel() != ErrorLevel {
+		t.Errorf("Got %v %v, expecting the settings of the scope to be kept", b.GetOutputLevel(), b.GetStackTraceLevel())
+	}
+
+	// settings no longer selected are restored, unless they were changed since
+	a.SetStackTraceLevel(ErrorLevel)
+	writeConfigFile(t, path, `{}`)
+	if err := reapplyConfigFile(path); err != nil {
+		t.Fatalf("Got %v, expecting success", err)
+	}
+	if a.GetOutputLevel() != InfoLevel || a.GetLogCallers() || a.GetStackTraceLevel() != ErrorLevel {
+		t.Errorf("Got %v %v %v, expecting the settings from before the file", a.GetOutputLevel(), a.GetLogCallers(),
+			a.GetStackTraceLevel())
+	}
+	a.SetOutputLevel(InfoLevel)
+	b.SetOutputLevel(InfoLevel)
+}
+
+// reapplyConfigFile applies the configuration file at path like an update of the file does.
+func reapplyConfigFile(path string) error {
+	cfg, err := loadConfigFile(path)
+	if err != nil {
+		return err
+	}
+	configFileMu.Lock()
+	defer configFileMu.Unlock()
+	return applyConfigFile(cfg)
+}
@@ -0,0 +1,150 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// Rotation intervals selectable with Options.RotationInterval.
+const (
+	// RotateHourly rotates the log file at the start of every hour.
+	RotateHourly = "hourly"
+	// RotateDaily rotates the log file at midnight UTC.
+	RotateDaily = "daily"
+)
+
+// rotationIntervals maps the names of the rotation intervals to their durations.
+var rotationIntervals = map[string]time.Duration{
+	"":           0,
+	RotateHourly: time.Hour,
+	RotateDaily:  24 * time.Hour,
+}
+
+// rotationNow returns the current time when checking whether a log file is due for rotation. It is
+// replaced in tests.
+var rotationNow = time.Now
+
+// rotatingFile is a log file rotated when reaching its maximum size, and optionally at the start of
+// every interval.
+type rotatingFile struct {
+	*lumberjack.Logger
+	interval time.Duration
+
+	mu sync.Mutex
+	// start of the interval the current file was written in
+	period time.Time
+}
+
+func newRotatingFile(path string, options *Options) (*rotatingFile, error) {
+	interval, ok := rotationIntervals[options.RotationInterval]
+	if !ok {
+		return nil, fmt.Errorf("invalid log rotation interval '%s'", options.RotationInterval)
+	}
+
+	rf := &rotatingFile{
+		Logger: &lumberjack.Logger{
+			Filename:   path,
+			MaxSize:    options.RotationMaxSize,
+			MaxBackups: options.RotationMaxBackups,
+			MaxAge:     options.RotationMaxAge,
+			Compress:   options.RotationCompress,
+		},
+		interval: interval,
+	}
+	if interval > 0 {
+		rf.period = rotationNow().Truncate(interval)
+		// an existing file written in an earlier interval is rotated by the first write
+		if fi, err := os.Stat(path); err == nil {
+			rf.period = fi.ModTime().Truncate(interval)
+		}
+	}
+	return rf, nil
+}
+
+// Write implements io.Writer, rotating the file first if a new interval started since the last write.
+func (rf *rotatingFile) Write(p []byte) (int, error) {
+	if rf.interval > 0 {
+		period := rotationNow().Truncate(rf.interval)
+		rf.mu.Lock()
+		rotate := period.After(rf.period)
+		if rotate {
+			rf.period = period
+		}
+		rf.mu.Unlock()
+
+		if rotate {
+			if err := rf.Logger.Rotate(); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return rf.Logger.Write(p)
+}
+
+// Sync implements zapcore.WriteSyncer. Writes go straight to the file, so there is nothing to flush.
+func (rf *rotatingFile) Sync() error {
+	return nil
+}
+
+var (
+	rotatingFiles   []*rotatingFile
+	rotatingFilesMu sync.Mutex
+)
+
+// setRotatingFiles replaces the rotating log files of the current configuration. The files of the
+// previous configuration are closed, which is safe as any later write reopens them.
+func setRotatingFiles(files []*rotatingFile) {
+	rotatingFilesMu.Lock()
+	old := rotatingFiles
+	rotatingFiles = files
+	rotatingFilesMu.Unlock()
+
+	for _, rf := range old {
+		_ = rf.Close()
+	}
+}
+
+// Reopen closes the rotating log files, which are reopened by the next write to them. This allows external
+// tools such as logrotate to move the files away and have them recreated, see also appsignals.ReopenLogs.
+func Reopen() error {
+	rotatingFilesMu.Lock()
+	defer rotatingFilesMu.Unlock()
+
+	for _, rf := range rotatingFiles {
+		if err := rf.Close(); err != nil {
+			return fmt.Errorf("unable to close log file '%s': %v", rf.Filename, err)
+		}
+	}
+	return nil
+}
+
+// Rotate rotates the rotating log files immediately, regardless of their size and age.
+func Rotate() error {
+	rotatingFilesMu.Lock()
+	defer rotatingFilesMu.Unlock()
+
+	for _, rf := range rotatingFiles {
+		if err := rf.Rotate(); err != nil {
+			return fmt.Errorf("unable to rotate log file '%s': %v", rf.Filename, err)
+		}
+	}
+	return nil
+}
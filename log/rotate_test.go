@@ -0,0 +1,166 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func configureRotation(t *testing.T, o *Options) {
+	t.Helper()
+	if err := Configure(o); err != nil {
+		t.Fatalf("Unable to configure logging: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = Configure(DefaultOptions())
+	})
+}
+
+func TestRotateInterval(t *testing.T) {
+	now := time.Date(2026, 1, 2, 10, 30, 0, 0, time.UTC)
+	rotationNow = func() time.Time { return now }
+	defer func() { rotationNow = time.Now }()
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "rot.log")
+	o := DefaultOptions()
+	o.OutputPaths = []string{}
+	o.RotateOutputPath = file
+	o.RotationInterval = RotateHourly
+	o.RotationCompress = true
+	configureRotation(t, o)
+
+	Info("first")
+	now = now.Add(20 * time.Minute)
+	Info("same hour")
+	if n := waitForFiles(t, dir, 1); n != 1 {
+		t.Fatalf("Got %d files, expecting no rotation within the hour", n)
+	}
+
+	now = now.Add(20 * time.Minute)
+	Info("next hour")
+	// the backup is compressed in the background
+	if n := waitForFiles(t, dir, 2); n != 2 {
+		t.Fatalf("Got %d files, expecting a backup after the hour", n)
+	}
+
+	var backup string
+	deadline := time.Now().Add(5 * time.Second)
+	for backup == "" && time.Now().Before(deadline) {
+		matches, _ := filepath.Glob(filepath.Join(dir, "rot-*.log.gz"))
+		if len(matches) == 1 {
+			backup = matches[0]
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if backup == "" {
+		t.Fatal("Expecting the backup to be compressed")
+	}
+
+	f, err := os.Open(backup)
+	if err != nil {
+		t.Fatalf("Got failure '%v', expecting success", err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("Got failure '%v', expecting success", err)
+	}
+	old, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("Got failure '%v', expecting success", err)
+	}
+	if !strings.Contains(string(old), "first") || !strings.Contains(string(old), "same hour") || strings.Contains(string(old), "next hour") {
+		t.Errorf("Got backup %s, expecting the messages of the first hour", old)
+	}
+
+	content, _ := os.ReadFile(file)
+	if !strings.Contains(string(content), "next hour") || strings.Contains(string(content), "first") {
+		t.Errorf("Got %s, expecting only the messages of the next hour", content)
+	}
+}
+
+func TestRotateIntervalExistingFile(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "rot.log")
+	if err := os.WriteFile(file, []byte("yesterday\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	yesterday := time.Now().Add(-24 * time.Hour)
+	if err := os.Chtimes(file, yesterday, yesterday); err != nil {
+		t.Fatal(err)
+	}
+
+	o := DefaultOptions()
+	o.OutputPaths = []string{}
+	o.RotateOutputPath = file
+	o.RotationInterval = RotateDaily
+	configureRotation(t, o)
+
+	Info("today")
+	if n := waitForFiles(t, dir, 2); n != 2 {
+		t.Errorf("Got %d files, expecting the file of an earlier day to be rotated", n)
+	}
+}
+
+func TestReopenAndRotate(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "rot.log")
+	o := DefaultOptions()
+	o.OutputPaths = []string{}
+	o.RotateOutputPath = file
+	configureRotation(t, o)
+
+	Info("before")
+	// an external tool moves the file away, then asks for it to be reopened
+	if err := os.Rename(file, file+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Reopen(); err != nil {
+		t.Fatalf("Got failure '%v', expecting success", err)
+	}
+	Info("after")
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("Got failure '%v', expecting the file to be recreated", err)
+	}
+	if !strings.Contains(string(content), "after") || strings.Contains(string(content), "before") {
+		t.Errorf("Got %s, expecting only the messages after reopening", content)
+	}
+
+	if err := Rotate(); err != nil {
+		t.Fatalf("Got failure '%v', expecting success", err)
+	}
+	if n := waitForFiles(t, dir, 3); n != 3 {
+		t.Errorf("Got %d files, expecting a backup to be created", n)
+	}
+}
+
+func TestBadRotateInterval(t *testing.T) {
+	o := DefaultOptions()
+	o.RotateOutputPath = filepath.Join(t.TempDir(), "rot.log")
+	o.RotationInterval = "weekly"
+	if err := Configure(o); err == nil {
+		t.Error("Got success, expecting error")
+	}
+	_ = Configure(DefaultOptions())
+}
@@ -0,0 +1,78 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"go.uber.org/zap/zapcore"
+)
+
+// scopeRoutingCore writes each entry to the core of the scope that emitted it, falling back to a
+// shared core for scopes without their own sinks.
+type scopeRoutingCore struct {
+	fallback zapcore.Core
+	// routes is keyed by scope name. The default scope always uses the fallback.
+	routes map[string]zapcore.Core
+}
+
+func newScopeRoutingCore(fallback zapcore.Core, routes map[string]zapcore.Core) zapcore.Core {
+	if len(routes) == 0 {
+		return fallback
+	}
+	return &scopeRoutingCore{fallback: fallback, routes: routes}
+}
+
+func (rc *scopeRoutingCore) route(name string) zapcore.Core {
+	if c, ok := rc.routes[name]; ok {
+		return c
+	}
+	return rc.fallback
+}
+
+func (rc *scopeRoutingCore) Enabled(l zapcore.Level) bool {
+	return rc.fallback.Enabled(l)
+}
+
+func (rc *scopeRoutingCore) With(fields []zapcore.Field) zapcore.Core {
+	routes := make(map[string]zapcore.Core, len(rc.routes))
+	for name, c := range rc.routes {
+		routes[name] = c.With(fields)
+	}
+	return &scopeRoutingCore{
+		fallback: rc.fallback.With(fields),
+		routes:   routes,
+	}
+}
+
+func (rc *scopeRoutingCore) Check(e zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if rc.Enabled(e.Level) {
+		return ce.AddCore(e, rc)
+	}
+	return ce
+}
+
+func (rc *scopeRoutingCore) Write(e zapcore.Entry, fields []zapcore.Field) error {
+	return rc.route(e.LoggerName).Write(e, fields)
+}
+
+func (rc *scopeRoutingCore) Sync() error {
+	// sync every core, reporting the first failure
+	err := rc.fallback.Sync()
+	for _, c := range rc.routes {
+		if serr := c.Sync(); err == nil {
+			err = serr
+		}
+	}
+	return err
+}
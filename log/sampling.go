@@ -0,0 +1,191 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// Sampling limits the volume of output of a scope. Within each Interval, the first First messages
+// with a given level and text are output, after which only every Thereafter-th message is output.
+// A Thereafter of 0 drops every message beyond the first First. The zero value disables sampling.
+// Error and fatal messages are never sampled.
+type Sampling struct {
+	Interval   time.Duration
+	First      int
+	Thereafter int
+}
+
+// Enabled returns whether the sampling configuration limits output at all.
+func (s Sampling) Enabled() bool {
+	return s.Interval > 0
+}
+
+// String returns the sampling configuration in the <first>/<thereafter>/<interval> form
+// accepted by the --log_sampling flag.
+func (s Sampling) String() string {
+	return fmt.Sprintf("%d/%d/%s", s.First, s.Thereafter, s.Interval)
+}
+
+// ParseSampling parses a sampling configuration in the <first>/<thereafter>/<interval> form, e.g. "100/10/1s".
+// An interval of 0 disables sampling.
+func ParseSampling(arg string) (Sampling, error) {
+	pieces := strings.Split(arg, "/")
+	if len(pieces) != 3 {
+		return Sampling{}, fmt.Errorf("invalid sampling format '%s'", arg)
+	}
+	first, err := strconv.Atoi(pieces[0])
+	if err != nil || first < 0 {
+		return Sampling{}, fmt.Errorf("invalid sampling first count '%s'", arg)
+	}
+	thereafter, err := strconv.Atoi(pieces[1])
+	if err != nil || thereafter < 0 {
+		return Sampling{}, fmt.Errorf("invalid sampling thereafter count '%s'", arg)
+	}
+	interval, err := time.ParseDuration(pieces[2])
+	if err != nil || interval < 0 {
+		return Sampling{}, fmt.Errorf("invalid sampling interval '%s'", arg)
+	}
+	return Sampling{Interval: interval, First: first, Thereafter: thereafter}, nil
+}
+
+// convertScopedSampling parses a <scope>:<first>/<thereafter>/<interval> entry.
+func convertScopedSampling(ss string) (string, Sampling, error) {
+	scope, arg, ok := strings.Cut(ss, ":")
+	if !ok {
+		return "", Sampling{}, fmt.Errorf("invalid sampling format '%s'", ss)
+	}
+	s, err := ParseSampling(arg)
+	return scope, s, err
+}
+
+// samplerBuckets is the number of counters kept per level. Messages whose text hashes to the
+// same bucket share a counter.
+const samplerBuckets = 1024
+
+type samplerCounters [samplerBuckets]samplerCounter
+
+// sampler applies a Sampling configuration to the output of a scope.
+type sampler struct {
+	cfg Sampling
+	// counters of each level, allocated when the first message of the level is sampled
+	counters [DebugLevel + 1]atomic.Pointer[samplerCounters]
+
+	// dropped is the number of messages dropped since the last summary line.
+	dropped        atomic.Uint64
+	summaryPending atomic.Bool
+}
+
+type samplerCounter struct {
+	resetAt atomic.Int64
+	count   atomic.Uint64
+}
+
+// incCheckReset increments the counter, resetting it first if its interval has passed.
+func (c *samplerCounter) incCheckReset(now time.Time, interval time.Duration) uint64 {
+	tn := now.UnixNano()
+	resetAfter := c.resetAt.Load()
+	if resetAfter > tn {
+		return c.count.Add(1)
+	}
+
+	c.count.Store(1)
+
+	newResetAfter := tn + interval.Nanoseconds()
+	if !c.resetAt.CompareAndSwap(resetAfter, newResetAfter) {
+		// We raced with another goroutine trying to reset, and it also reset
+		// the counter to 1, so we need to reincrement the counter.
+		return c.count.Add(1)
+	}
+
+	return 1
+}
+
+func newSampler(cfg Sampling) *sampler {
+	if !cfg.Enabled() {
+		return nil
+	}
+	return &sampler{cfg: cfg}
+}
+
+// allow returns whether a message should be output, recording it as dropped otherwise. Error and fatal
+// messages are always output, so that a fatal message still exits.
+func (s *sampler) allow(scope *Scope, level Level, msg string) bool {
+	if level <= ErrorLevel {
+		return true
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(msg))
+	n := s.levelCounters(level)[h.Sum32()%samplerBuckets].incCheckReset(time.Now(), s.cfg.Interval)
+	if n <= uint64(s.cfg.First) {
+		return true
+	}
+	if s.cfg.Thereafter > 0 && (n-uint64(s.cfg.First))%uint64(s.cfg.Thereafter) == 0 {
+		return true
+	}
+
+	s.dropped.Add(1)
+	samplingDropped.With(scopeTag.Value(scope.name)).Increment()
+	if s.summaryPending.CompareAndSwap(false, true) {
+		time.AfterFunc(s.cfg.Interval, func() {
+			s.summaryPending.Store(false)
+			if d := s.dropped.Swap(0); d > 0 {
+				emit(scope, zapcore.WarnLevel, fmt.Sprintf("suppressed %d messages", d), nil)
+			}
+		})
+	}
+	return false
+}
+
+// levelCounters returns the counters of level, allocating them if needed.
+func (s *sampler) levelCounters(level Level) *samplerCounters {
+	if c := s.counters[level].Load(); c != nil {
+		return c
+	}
+	c := &samplerCounters{}
+	if !s.counters[level].CompareAndSwap(nil, c) {
+		return s.counters[level].Load()
+	}
+	return c
+}
+
+// SetSampling adjusts the sampling configuration of the scope. The zero Sampling disables sampling.
+// Setting the configuration in effect keeps the current counters.
+func (s *Scope) SetSampling(cfg Sampling) {
+	if smp := s.getSampler(); smp != nil && smp.cfg == cfg {
+		return
+	}
+	s.sampler.Store(newSampler(cfg))
+}
+
+// GetSampling returns the sampling configuration of the scope.
+func (s *Scope) GetSampling() Sampling {
+	if smp := s.getSampler(); smp != nil {
+		return smp.cfg
+	}
+	return Sampling{}
+}
+
+func (s *Scope) getSampler() *sampler {
+	smp, _ := s.sampler.Load().(*sampler)
+	return smp
+}
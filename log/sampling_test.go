@@ -0,0 +1,151 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSampling(t *testing.T) {
+	s := RegisterScope("testSampling", "")
+	defer s.SetSampling(Sampling{})
+
+	lines := runTest(t, func() {
+		s.SetSampling(Sampling{Interval: time.Hour, First: 2, Thereafter: 3})
+		for i := 0; i < 10; i++ {
+			s.Info("storm")
+		}
+		// messages with other text or level are counted separately
+		s.Info("calm")
+		s.Warn("storm")
+	})
+
+	// 1st, 2nd, 5th and 8th
+	mustMatchLength(t, 6, lines)
+	for _, l := range lines[:4] {
+		mustRegexMatchString(t, l, "info\ttestSampling\tstorm$")
+	}
+	mustRegexMatchString(t, lines[4], "info\ttestSampling\tcalm$")
+	mustRegexMatchString(t, lines[5], "warn\ttestSampling\tstorm$")
+}
+
+func TestSamplingSummary(t *testing.T) {
+	s := RegisterScope("testSamplingSummary", "")
+	defer s.SetSampling(Sampling{})
+
+	lines := runTest(t, func() {
+		s.SetSampling(Sampling{Interval: 10 * time.Millisecond, First: 1})
+		for i := 0; i < 5; i++ {
+			s.Info("storm")
+		}
+		time.Sleep(100 * time.Millisecond)
+	})
+
+	mustMatchLength(t, 2, lines)
+	mustRegexMatchString(t, lines[0], "info\ttestSamplingSummary\tstorm$")
+	mustRegexMatchString(t, lines[1], "warn\ttestSamplingSummary\tsuppressed 4 messages$")
+}
+
+func TestSamplingOptions(t *testing.T) {
+	resetGlobals()
+	s := RegisterScope("testSamplingOptions", "")
+
+	o := DefaultOptions()
+	o.SetSampling("testSamplingOptions", Sampling{Interval: time.Second, First: 100, Thereafter: 10})
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got %v, expecting success", err)
+	}
+	want := Sampling{Interval: time.Second, First: 100, Thereafter: 10}
+	if got := s.GetSampling(); got != want {
+		t.Errorf("Got %v, expecting %v", got, want)
+	}
+	if got, err := o.GetSampling("testSamplingOptions"); err != nil || got != want {
+		t.Errorf("Got %v, %v, expecting %v", got, err, want)
+	}
+	if defaultScope.GetSampling().Enabled() {
+		t.Error("Expecting default scope to not be sampled")
+	}
+
+	o = DefaultOptions()
+	o.sampling = "all:5/0/1m"
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got %v, expecting success", err)
+	}
+	if got := defaultScope.GetSampling(); got != (Sampling{Interval: time.Minute, First: 5}) {
+		t.Errorf("Got %v, expecting override to apply to the default scope", got)
+	}
+
+	for _, bad := range []string{"default", "default:1/2", "default:a/1/1s", "default:1/-1/1s", "default:1/1/x"} {
+		o = DefaultOptions()
+		o.sampling = bad
+		if err := Configure(o); err == nil || !strings.Contains(err.Error(), "sampling") {
+			t.Errorf("Got %v for %q, expecting sampling error", err, bad)
+		}
+	}
+
+	resetGlobals()
+	_ = Configure(DefaultOptions())
+}
+
+func TestSamplingKeepsErrors(t *testing.T) {
+	s := RegisterScope("testSamplingErrors", "")
+	defer s.SetSampling(Sampling{})
+
+	var calls []string
+	file := configureWithExit(t, DefaultOptions(), &calls)
+
+	// every message beyond the first is sampled out
+	s.SetSampling(Sampling{Interval: time.Hour, First: 1})
+	for i := 0; i < 2; i++ {
+		s.Info("storm")
+		s.Error("failed")
+		s.Fatal("fatal")
+	}
+	if got := strings.Join(calls, ","); got != "exit,exit" {
+		t.Errorf("Got calls %s, expecting every fatal message to exit", got)
+	}
+
+	content, _ := os.ReadFile(file)
+	if got := strings.Count(string(content), "failed"); got != 2 {
+		t.Errorf("Got %d error messages, expecting 2", got)
+	}
+	if got := strings.Count(string(content), "storm"); got != 1 {
+		t.Errorf("Got %d info messages, expecting 1", got)
+	}
+}
+
+func TestSamplingCounters(t *testing.T) {
+	s := RegisterScope("testSamplingCounters", "")
+	defer s.SetSampling(Sampling{})
+
+	cfg := Sampling{Interval: time.Hour, First: 1}
+	s.SetSampling(cfg)
+	smp := s.getSampler()
+	smp.allow(s, InfoLevel, "storm")
+	for _, l := range []Level{ErrorLevel, WarnLevel, DebugLevel} {
+		if smp.counters[l].Load() != nil {
+			t.Errorf("Got counters for level %v, expecting them to be allocated on first use", l)
+		}
+	}
+
+	// setting the same configuration keeps the counters
+	s.SetSampling(cfg)
+	if s.getSampler() != smp || smp.allow(s, InfoLevel, "storm") {
+		t.Error("Expecting the sampler to be kept")
+	}
+}
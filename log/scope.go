@@ -55,18 +55,31 @@ type Scope struct {
 	outputLevel     atomic.Value
 	stackTraceLevel atomic.Value
 	logCallers      atomic.Value
+	sampler         atomic.Value
+	dedup           atomic.Value
+	redact          atomic.Value
+
+	// level rules and counters of emitted messages, shared by the copies of the scope
+	levelRules    *levelRules
+	entryCounters *entryCounters
 
 	// labels data - key slice to preserve ordering
 	labelKeys []string
 	labels    map[string]any
+
+	// trace context attached with WithContext
+	trace *TraceContext
+
+	// program counter of the call the entry is for, located in place of callerSkip if set
+	callerPC uintptr
 }
 
 var (
 	scopes = make(map[string]*Scope)
 	lock   sync.RWMutex
 
-	defaultHandlers []scopeHandlerCallbackFunc
-	// Write lock should only be taken during program startup.
+	defaultHandlers []*scopeHandler
+	// Write lock should only be taken during program startup, or by tests adding handlers.
 	defaultHandlersMu sync.RWMutex
 )
 
@@ -78,26 +91,62 @@ type scopeHandlerCallbackFunc func(
 	ie *structured.Error,
 	msg string)
 
+// scopeHandler gives a registered callback an identity, so that it can be removed.
+type scopeHandler struct {
+	callback scopeHandlerCallbackFunc
+}
+
 // registerDefaultHandler registers a scope handler that is called by default from all scopes. It is appended to the
-// current list of default scope handlers.
-func registerDefaultHandler(callback scopeHandlerCallbackFunc) {
+// current list of default scope handlers, and the returned function removes it.
+func registerDefaultHandler(callback scopeHandlerCallbackFunc) func() {
 	defaultHandlersMu.Lock()
 	defer defaultHandlersMu.Unlock()
-	defaultHandlers = append(defaultHandlers, callback)
+	h := &scopeHandler{callback: callback}
+	defaultHandlers = append(defaultHandlers, h)
+
+	return func() {
+		defaultHandlersMu.Lock()
+		defer defaultHandlersMu.Unlock()
+		out := make([]*scopeHandler, 0, len(defaultHandlers))
+		for _, dh := range defaultHandlers {
+			if dh != h {
+				out = append(out, dh)
+			}
+		}
+		defaultHandlers = out
+	}
+}
+
+// HandlerFunc receives the messages logged through scopes at or above their output level, along with the
+// scope holding the labels of the message and any structured error. Handlers must not modify their arguments.
+type HandlerFunc func(level Level, scope *Scope, ie *structured.Error, msg string)
+
+// AddHandler registers a handler called for every message logged through scopes, after the messages have
+// been written to the configured outputs. It returns a function that removes the handler. This is mainly
+// useful to capture log messages in tests, see the logtest package.
+func AddHandler(h HandlerFunc) (remove func()) {
+	return registerDefaultHandler(scopeHandlerCallbackFunc(h))
 }
 
 // RegisterScope registers a new logging scope. If the same name is used multiple times
 // for a single process, the same Scope struct is returned.
 //
-// Scope names cannot include colons, commas, or periods.
+// Scope names cannot include colons, commas, or wildcards. Periods separate the names of parent and
+// child scopes, e.g. xds.ads is a child of xds, and a newly registered scope starts with the output level,
+// stack trace level and caller setting of its nearest registered ancestor.
 func RegisterScope(name string, description string) *Scope {
 	// We only allow internal callers to set callerSkip
 	return registerScope(name, description, 0)
 }
 
 func registerScope(name string, description string, callerSkip int) *Scope {
-	if strings.ContainsAny(name, ":,.") {
-		panic(fmt.Sprintf("scope name %s is invalid, it cannot contain colons, commas, or periods", name))
+	if strings.ContainsAny(name, ":,"+scopeWildcard) {
+		panic(fmt.Sprintf("scope name %s is invalid, it cannot contain colons, commas, or wildcards", name))
+	}
+	for _, segment := range strings.Split(name, ".") {
+		if segment == "" {
+			panic(fmt.Sprintf("scope name %s is invalid, it cannot contain empty segments between periods", name))
+		}
 	}
 
 	lock.Lock()
@@ -109,10 +158,18 @@ func registerScope(name string, description string, callerSkip int) *Scope {
 			name:        name,
 			description: description,
 			callerSkip:  callerSkip,
+
+			levelRules:    &levelRules{},
+			entryCounters: newEntryCounters(name),
+			labels:        make(map[string]any),
 		}
 		s.SetOutputLevel(InfoLevel)
 		s.SetStackTraceLevel(NoneLevel)
 		s.SetLogCallers(false)
+		s.SetSampling(Sampling{})
+		s.SetDedupWindow(0)
+		s.SetRedaction(true)
+		applyLaterSettings(s, inheritSettings(s))
 
 		if name != DefaultScopeName {
 			s.nameToEmit = name
@@ -121,8 +178,7 @@ func registerScope(name string, description string, callerSkip int) *Scope {
 		scopes[name] = s
 	}
 
-	s.labels = make(map[string]any)
-
+	// a registered scope is shared, so registering it again must not change it
 	return s
 }
 
@@ -150,7 +206,7 @@ func Scopes() map[string]*Scope {
 
 // Fatal uses fmt.Sprint to construct and log a message at fatal level.
 func (s *Scope) Fatal(args ...any) {
-	if s.GetOutputLevel() >= FatalLevel {
+	if s.enabled(FatalLevel) {
 		ie, firstIdx := getErrorStruct(args)
 		if firstIdx == 0 {
 			s.callHandlers(FatalLevel, s, ie, fmt.Sprint(args...))
@@ -162,7 +218,7 @@ func (s *Scope) Fatal(args ...any) {
 
 // Fatalf uses fmt.Sprintf to construct and log a message at fatal level.
 func (s *Scope) Fatalf(args ...any) {
-	if s.GetOutputLevel() >= FatalLevel {
+	if s.enabled(FatalLevel) {
 		ie, firstIdx := getErrorStruct(args)
 		msg := fmt.Sprint(args[firstIdx])
 		if len(args) > 1 {
@@ -172,21 +228,22 @@ func (s *Scope) Fatalf(args ...any) {
 	}
 }
 
-// FatalEnabled returns whether output of messages using this scope is currently enabled for fatal-level output.
+// FatalEnabled returns whether output of messages using this scope is currently enabled for fatal-level output,
+// including through level rules matching its labels.
 func (s *Scope) FatalEnabled() bool {
-	return s.GetOutputLevel() >= FatalLevel
+	return s.enabled(FatalLevel)
 }
 
 // Error outputs a message at error level.
 func (s *Scope) Error(args any) {
-	if s.GetOutputLevel() >= ErrorLevel {
+	if s.enabled(ErrorLevel) {
 		s.callHandlers(ErrorLevel, s, nil, fmt.Sprint(args))
 	}
 }
 
 // Errorf uses fmt.Sprintf to construct and log a message at error level.
 func (s *Scope) Errorf(args ...any) {
-	if s.GetOutputLevel() >= ErrorLevel {
+	if s.enabled(ErrorLevel) {
 		ie, firstIdx := getErrorStruct(args)
 		msg := fmt.Sprint(args[firstIdx])
 		if len(args) > 1 {
@@ -196,21 +253,22 @@ func (s *Scope) Errorf(args ...any) {
 	}
 }
 
-// ErrorEnabled returns whether output of messages using this scope is currently enabled for error-level output.
+// ErrorEnabled returns whether output of messages using this scope is currently enabled for error-level output,
+// including through level rules matching its labels.
 func (s *Scope) ErrorEnabled() bool {
-	return s.GetOutputLevel() >= ErrorLevel
+	return s.enabled(ErrorLevel)
 }
 
 // Warn outputs a message at warn level.
 func (s *Scope) Warn(args any) {
-	if s.GetOutputLevel() >= WarnLevel {
+	if s.enabled(WarnLevel) {
 		s.callHandlers(WarnLevel, s, nil, fmt.Sprint(args))
 	}
 }
 
 // Warnf uses fmt.Sprintf to construct and log a message at warn level.
 func (s *Scope) Warnf(args ...any) {
-	if s.GetOutputLevel() >= WarnLevel {
+	if s.enabled(WarnLevel) {
 		ie, firstIdx := getErrorStruct(args)
 		msg := fmt.Sprint(args[firstIdx])
 		if len(args) > 1 {
@@ -220,21 +278,22 @@ func (s *Scope) Warnf(args ...any) {
 	}
 }
 
-// WarnEnabled returns whether output of messages using this scope is currently enabled for warn-level output.
+// WarnEnabled returns whether output of messages using this scope is currently enabled for warn-level output,
+// including through level rules matching its labels.
 func (s *Scope) WarnEnabled() bool {
-	return s.GetOutputLevel() >= WarnLevel
+	return s.enabled(WarnLevel)
 }
 
 // Info outputs a message at info level.
 func (s *Scope) Info(args any) {
-	if s.GetOutputLevel() >= InfoLevel {
+	if s.enabled(InfoLevel) {
 		s.callHandlers(InfoLevel, s, nil, fmt.Sprint(args))
 	}
 }
 
 // Infof uses fmt.Sprintf to construct and log a message at info level.
 func (s *Scope) Infof(args ...any) {
-	if s.GetOutputLevel() >= InfoLevel {
+	if s.enabled(InfoLevel) {
 		ie, firstIdx := getErrorStruct(args)
 		msg := fmt.Sprint(args[firstIdx])
 		if len(args) > 1 {
@@ -244,21 +303,22 @@ func (s *Scope) Infof(args ...any) {
 	}
 }
 
-// InfoEnabled returns whether output of messages using this scope is currently enabled for info-level output.
+// InfoEnabled returns whether output of messages using this scope is currently enabled for info-level output,
+// including through level rules matching its labels.
 func (s *Scope) InfoEnabled() bool {
-	return s.GetOutputLevel() >= InfoLevel
+	return s.enabled(InfoLevel)
 }
 
 // Debug outputs a message at debug level.
 func (s *Scope) Debug(args any) {
-	if s.GetOutputLevel() >= DebugLevel {
+	if s.enabled(DebugLevel) {
 		s.callHandlers(DebugLevel, s, nil, fmt.Sprint(args))
 	}
 }
 
 // Debugf uses fmt.Sprintf to construct and log a message at debug level.
 func (s *Scope) Debugf(args ...any) {
-	if s.GetOutputLevel() >= DebugLevel {
+	if s.enabled(DebugLevel) {
 		ie, firstIdx := getErrorStruct(args)
 		msg := fmt.Sprint(args[firstIdx])
 		if len(args) > 1 {
@@ -268,9 +328,10 @@ func (s *Scope) Debugf(args ...any) {
 	}
 }
 
-// DebugEnabled returns whether output of messages using this scope is currently enabled for debug-level output.
+// DebugEnabled returns whether output of messages using this scope is currently enabled for debug-level output,
+// including through level rules matching its labels.
 func (s *Scope) DebugEnabled() bool {
-	return s.GetOutputLevel() >= DebugLevel
+	return s.enabled(DebugLevel)
 }
 
 // Name returns this scope's name.
@@ -283,9 +344,19 @@ func (s *Scope) Description() string {
 	return s.description
 }
 
-// SetOutputLevel adjusts the output level associated with the scope.
+// SetOutputLevel adjusts the output level associated with the scope. It ends any temporary override
+// set with SetOutputLevelFor.
 func (s *Scope) SetOutputLevel(l Level) {
+	dropLevelOverride(s)
+	s.storeOutputLevel(l)
+}
+
+// storeOutputLevel sets the output level of the scope. The verbosity of klog follows the level of the klog scope.
+func (s *Scope) storeOutputLevel(l Level) {
 	s.outputLevel.Store(l)
+	if s.name == KlogScopeName {
+		setKlogVerbosity(l)
+	}
 }
 
 // GetOutputLevel returns the output level associated with the scope.
@@ -313,6 +384,23 @@ func (s *Scope) GetLogCallers() bool {
 	return s.logCallers.Load().(bool)
 }
 
+// SetRedaction adjusts whether sensitive data is redacted from the output of the scope. Redaction is
+// enabled by default, and is meant to be disabled only for local debugging.
+func (s *Scope) SetRedaction(redact bool) {
+	s.redact.Store(redact)
+}
+
+// GetRedaction returns whether sensitive data is redacted from the output of the scope.
+func (s *Scope) GetRedaction() bool {
+	redact, ok := s.redact.Load().(bool)
+	return !ok || redact
+}
+
+// Labels returns a copy of the labels added to s with WithLabels.
+func (s *Scope) Labels() map[string]any {
+	return copyStringInterfaceMap(s.labels)
+}
+
 // copy makes a copy of s and returns a pointer to it.
 func (s *Scope) copy() *Scope {
 	out := *s
@@ -353,7 +441,7 @@ func (s *Scope) callHandlers(
 	defaultHandlersMu.RLock()
 	defer defaultHandlersMu.RUnlock()
 	for _, h := range defaultHandlers {
-		h(severity, scope, ie, msg)
+		h.callback(severity, scope, ie, msg)
 	}
 }
 
@@ -20,6 +20,7 @@ import (
 	"regexp"
 	"strconv"
 	"testing"
+	"time"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -90,6 +91,42 @@ func TestKlog(t *testing.T) {
 	}
 }
 
+func TestKlogVerbosity(t *testing.T) {
+	defer KlogScope.SetOutputLevel(InfoLevel)
+	defer EnableKlogWithVerbosity(0)
+
+	lines := runTest(t, func() {
+		klog.V(1).Info("hidden")
+
+		// debug level enables the debug output of klog
+		KlogScope.SetOutputLevelFor(DebugLevel, time.Hour)
+		klog.V(4).Info("debug")
+		klog.V(5).Info("hidden")
+
+		// a requested verbosity applies while at debug level, even if lower than the default
+		EnableKlogWithVerbosity(6)
+		klog.V(6).Info("verbose")
+		EnableKlogWithVerbosity(2)
+		klog.V(2).Info("requested")
+		klog.V(3).Info("hidden")
+
+		KlogScope.SetOutputLevel(InfoLevel)
+		klog.V(4).Info("hidden")
+	})
+
+	mustMatchLength(t, 3, lines)
+	mustRegexMatchString(t, lines[0], "debug\tklog\tdebug$")
+	mustRegexMatchString(t, lines[1], "debug\tklog\tverbose$")
+	mustRegexMatchString(t, lines[2], "info\tklog\trequested$")
+
+	// a requested verbosity raises the scope to debug level
+	EnableKlogWithVerbosity(6)
+	_ = Configure(DefaultOptions())
+	if KlogScope.GetOutputLevel() != DebugLevel || !klog.V(6).Enabled() || klog.V(7).Enabled() {
+		t.Errorf("Got %v, expecting Configure to enable the requested verbosity", KlogScope.GetOutputLevel())
+	}
+}
+
 func TestBasicScopes(t *testing.T) {
 	s := RegisterScope("testScope", "z")
 
@@ -487,7 +524,8 @@ func TestBadNames(t *testing.T) {
 	badNames := []string{
 		"a:b",
 		"a,b",
-		"a.b",
+		"a..b",
+		"a*b",
 
 		":ab",
 		",ab",
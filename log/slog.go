@@ -0,0 +1,161 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"context"
+	"log/slog"
+)
+
+// SlogScopeKey is the attribute key that selects the scope a slog.Logger writes to, e.g.
+// slog.Default().With(log.SlogScopeKey, "ads"). Unregistered scope names are kept as labels.
+const SlogScopeKey = "scope"
+
+// slogCallerSkip is the number of frames between a slog.Logger method and the scope handlers, in place
+// of the scope's own caller skip. It only locates the caller of records made without a program counter.
+const slogCallerSkip = 2
+
+// slogHandler is a slog.Handler that writes records to a Scope. This lets code using log/slog share
+// the output levels, sinks and formatting of the scopes. slog levels below info map to debug, and
+// levels at or above error map to error; records never terminate the process.
+// Attributes become labels, with the names of enclosing groups joined to their keys by periods.
+type slogHandler struct {
+	scope *Scope
+	// labels added with WithAttrs - key slice to preserve ordering
+	labelKeys []string
+	labels    []any
+	prefix    string
+}
+
+// NewSlogHandler creates a new slog.Handler that writes records to the given scope.
+func NewSlogHandler(scope *Scope) slog.Handler {
+	return &slogHandler{scope: scope}
+}
+
+// SetSlogDefault makes a handler writing to the given scope the default slog handler, so that
+// libraries using the top-level slog functions obey the output level of the scope.
+func SetSlogDefault(scope *Scope) {
+	slog.SetDefault(slog.New(NewSlogHandler(scope)))
+}
+
+func fromSlogLevel(l slog.Level) Level {
+	switch {
+	case l >= slog.LevelError:
+		return ErrorLevel
+	case l >= slog.LevelWarn:
+		return WarnLevel
+	case l >= slog.LevelInfo:
+		return InfoLevel
+	}
+	return DebugLevel
+}
+
+// Enabled implements slog.Handler.
+func (h *slogHandler) Enabled(_ context.Context, l slog.Level) bool {
+	level := fromSlogLevel(l)
+	// level rules can only be evaluated once the labels of the record are known
+	return h.scope.GetOutputLevel() >= level || h.scope.ruleEnabled(level)
+}
+
+// Handle implements slog.Handler.
+func (h *slogHandler) Handle(ctx context.Context, r slog.Record) error {
+	level := fromSlogLevel(r.Level)
+	if !h.Enabled(ctx, r.Level) {
+		return nil
+	}
+
+	// the registered scope is only copied here, so that level changes made after the handler
+	// was created still apply
+	out := h.scope.copy()
+	out.labelKeys = append([]string(nil), h.scope.labelKeys...)
+	// the caller is located from the record, so that wrappers of slog.Logger can report their own callers
+	out.callerSkip = slogCallerSkip
+	out.callerPC = r.PC
+	if tc, ok := TraceFromContext(ctx); ok {
+		out.trace = &tc
+	}
+	for i, k := range h.labelKeys {
+		out.addLabel(k, h.labels[i])
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		addSlogAttr(h.prefix, a, out.addLabel)
+		return true
+	})
+
+	if !out.enabled(level) {
+		return nil
+	}
+	out.callHandlers(level, out, nil, r.Message)
+	return nil
+}
+
+// WithAttrs implements slog.Handler.
+func (h *slogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	out := &slogHandler{
+		scope:     h.scope,
+		labelKeys: append([]string(nil), h.labelKeys...),
+		labels:    append([]any(nil), h.labels...),
+		prefix:    h.prefix,
+	}
+	for _, a := range attrs {
+		if h.prefix == "" && a.Key == SlogScopeKey && a.Value.Kind() == slog.KindString {
+			if s := FindScope(a.Value.String()); s != nil {
+				out.scope = s
+				continue
+			}
+		}
+		addSlogAttr(h.prefix, a, func(k string, v any) {
+			out.labelKeys = append(out.labelKeys, k)
+			out.labels = append(out.labels, v)
+		})
+	}
+	return out
+}
+
+// WithGroup implements slog.Handler.
+func (h *slogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	out := *h
+	out.prefix = h.prefix + name + "."
+	return &out
+}
+
+// addSlogAttr flattens a into labels, following the slog.Handler rules for empty attributes and groups.
+func addSlogAttr(prefix string, a slog.Attr, add func(k string, v any)) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			addSlogAttr(prefix, ga, add)
+		}
+		return
+	}
+	add(prefix+a.Key, a.Value.Any())
+}
+
+// addLabel adds a label to s, which must be a copy of a registered scope.
+func (s *Scope) addLabel(key string, value any) {
+	if _, ok := s.labels[key]; !ok {
+		s.labelKeys = append(s.labelKeys, key)
+	}
+	s.labels[key] = value
+}
@@ -0,0 +1,110 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"context"
+	"log/slog"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSlogHandler(t *testing.T) {
+	s := RegisterScope("testSlog", "")
+	defer s.SetOutputLevel(InfoLevel)
+
+	lines := runTest(t, func() {
+		l := slog.New(NewSlogHandler(s))
+		l.Info("hello", "k", "v", slog.Group("g", "a", 1, slog.Group("", "inline", true)))
+		l.With("w", "x").WithGroup("grp").With("y", 2).Warn("grouped", "z", time.Second)
+		l.Error("failed", slog.Group("empty"), slog.Attr{})
+		l.Debug("hidden")
+		l.Log(context.Background(), slog.LevelWarn+1, "custom")
+
+		s.SetOutputLevel(DebugLevel)
+		l.Log(context.Background(), slog.LevelDebug-4, "trace")
+		l.InfoContext(ContextWithTraceparent(context.Background(), testTraceparent), "traced")
+	})
+
+	mustMatchLength(t, 6, lines)
+	mustRegexMatchString(t, lines[0], "info\ttestSlog\thello\tk=v g.a=1 g.inline=true$")
+	mustRegexMatchString(t, lines[1], "warn\ttestSlog\tgrouped\tw=x grp.y=2 grp.z=1s$")
+	mustRegexMatchString(t, lines[2], "error\ttestSlog\tfailed$")
+	mustRegexMatchString(t, lines[3], "warn\ttestSlog\tcustom$")
+	mustRegexMatchString(t, lines[4], "debug\ttestSlog\ttrace$")
+	mustRegexMatchString(t, lines[5], "info\ttestSlog\ttraced\ttrace_id="+testTraceID+" span_id="+testSpanID+"$")
+}
+
+func TestSlogHandlerEnabled(t *testing.T) {
+	s := RegisterScope("testSlogEnabled", "")
+	defer s.SetOutputLevel(InfoLevel)
+
+	h := NewSlogHandler(s)
+	s.SetOutputLevel(WarnLevel)
+	if h.Enabled(context.Background(), slog.LevelInfo) || !h.Enabled(context.Background(), slog.LevelWarn) {
+		t.Error("Expecting the handler to follow the scope output level")
+	}
+	s.SetOutputLevel(DebugLevel)
+	if !h.Enabled(context.Background(), slog.LevelDebug) {
+		t.Error("Expecting level changes to apply to existing handlers")
+	}
+}
+
+func TestSetSlogDefault(t *testing.T) {
+	old := slog.Default()
+	defer slog.SetDefault(old)
+
+	s := RegisterScope("testSlogDefault", "")
+	other := RegisterScope("testSlogOther", "")
+	defer other.SetOutputLevel(InfoLevel)
+	defer other.SetLogCallers(false)
+
+	lines := runTest(t, func() {
+		SetSlogDefault(s)
+		other.SetOutputLevel(WarnLevel)
+		other.SetLogCallers(true)
+
+		slog.Info("default")
+		slog.With(SlogScopeKey, "testSlogOther").Info("filtered")
+		slog.With(SlogScopeKey, "testSlogOther").Warn("routed")
+		slog.With(SlogScopeKey, "unknown").Info("unrouted")
+	})
+
+	mustMatchLength(t, 3, lines)
+	mustRegexMatchString(t, lines[0], "info\ttestSlogDefault\tdefault$")
+	mustRegexMatchString(t, lines[1], "warn\ttestSlogOther\tlog/slog_test.go:\\d+\trouted$")
+	mustRegexMatchString(t, lines[2], "info\ttestSlogDefault\tunrouted\tscope=unknown$")
+}
+
+func TestSlogCallerFromRecord(t *testing.T) {
+	s := RegisterScope("testSlogCaller", "")
+	defer s.SetLogCallers(false)
+
+	var line int
+	lines := runTest(t, func() {
+		s.SetLogCallers(true)
+		// wrappers of slog.Logger set the program counter of their own callers
+		var pcs [1]uintptr
+		runtime.Callers(1, pcs[:])
+		f, _ := runtime.CallersFrames(pcs[:]).Next()
+		line = f.Line
+		_ = NewSlogHandler(s).Handle(context.Background(), slog.NewRecord(time.Now(), slog.LevelInfo, "wrapped", pcs[0]))
+	})
+
+	mustMatchLength(t, 1, lines)
+	mustRegexMatchString(t, lines[0], "info\ttestSlogCaller\tlog/slog_test.go:"+strconv.Itoa(line)+"\twrapped$")
+}
@@ -59,6 +59,7 @@ func encodeStackdriverLevel(l zapcore.Level, enc zapcore.PrimitiveArrayEncoder)
 // A stackdriverCore writes entries to a Google Cloud Logging API.
 type stackdriverCore struct {
 	logger       *logging.Logger
+	project      string
 	minimumLevel zapcore.Level
 	fields       map[string]any
 }
@@ -82,7 +83,7 @@ func teeToStackdriver(baseCore zapcore.Core, project, quotaProject, logName stri
 	} else {
 		logger = client.Logger(logName)
 	}
-	sdCore := &stackdriverCore{logger: logger}
+	sdCore := &stackdriverCore{logger: logger, project: project}
 
 	for l := zapcore.DebugLevel; l <= zapcore.FatalLevel; l++ {
 		if baseCore.Enabled(l) {
@@ -103,6 +104,7 @@ func (sc *stackdriverCore) Enabled(l zapcore.Level) bool {
 func (sc *stackdriverCore) With(fields []zapcore.Field) zapcore.Core {
 	return &stackdriverCore{
 		logger:       sc.logger,
+		project:      sc.project,
 		minimumLevel: sc.minimumLevel,
 		fields:       clone(sc.fields, fields),
 	}
@@ -136,11 +138,21 @@ func (sc *stackdriverCore) Write(entry zapcore.Entry, fields []zapcore.Field) er
 	payload["logger"] = entry.LoggerName
 	payload["message"] = entry.Message
 
-	sc.logger.Log(logging.Entry{
+	e := logging.Entry{
 		Timestamp: entry.Time,
 		Severity:  severity,
 		Payload:   payload,
-	})
+	}
+	if r := findRecord(fields); r != nil && r.scope.trace != nil {
+		for _, k := range traceKeys {
+			delete(payload, k)
+		}
+		e.Trace = stackdriverTrace(sc.project, r.scope.trace.TraceID)
+		e.SpanID = r.scope.trace.SpanID
+		e.TraceSampled = r.scope.trace.Sampled
+	}
+
+	sc.logger.Log(e)
 
 	return nil
 }
@@ -0,0 +1,337 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	defaultSyslogNetwork  = "unixgram"
+	defaultSyslogAddress  = "/dev/log"
+	defaultSyslogFacility = 1
+	// defaultSyslogSDID identifies the structured data element holding scope and labels. 32473 is the
+	// private enterprise number reserved for documentation, see RFC 5612.
+	defaultSyslogSDID = "istio@32473"
+	// defaultSyslogWriteTimeout bounds the time a message waits for a server that stopped reading.
+	defaultSyslogWriteTimeout = time.Second
+)
+
+// syslogSeverityMapping maps the Zap log levels to syslog severities.
+//
+// See: https://www.rfc-editor.org/rfc/rfc5424#section-6.2.1
+var syslogSeverityMapping = map[zapcore.Level]int{
+	zapcore.DebugLevel:  7, // debug
+	zapcore.InfoLevel:   6, // informational
+	zapcore.WarnLevel:   4, // warning
+	zapcore.ErrorLevel:  3, // error
+	zapcore.DPanicLevel: 2, // critical
+	zapcore.PanicLevel:  2, // critical
+	zapcore.FatalLevel:  2, // critical
+}
+
+// SyslogOptions configures the export of logs to a syslog server, using the RFC 5424 format.
+type SyslogOptions struct {
+	// Network is one of unixgram (the default), unix, udp or tcp. Messages sent over the stream networks
+	// unix and tcp are framed with octet counting, see RFC 6587.
+	Network string
+
+	// Address is the path or host:port of the server. It defaults to /dev/log for the unix networks.
+	Address string
+
+	// Facility is the syslog facility code, e.g. 16 for local0. It defaults to 1, user-level messages.
+	Facility int
+
+	// AppName defaults to the name of the program.
+	AppName string
+
+	// Hostname defaults to the host name reported by the kernel.
+	Hostname string
+
+	// StructuredDataID identifies the structured data element that holds the scope and labels of
+	// each message. It defaults to istio@32473.
+	StructuredDataID string
+
+	// WriteTimeout bounds the time spent connecting to the server and sending each message, after which
+	// the connection is reopened. It defaults to one second.
+	WriteTimeout time.Duration
+}
+
+// syslogWriter sends messages to a syslog server, shared by all cores of a configuration.
+type syslogWriter struct {
+	network string
+	address string
+	stream  bool
+	timeout time.Duration
+
+	// header is the part of the message header that does not vary between messages
+	facility int
+	header   string
+	sdID     string
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func newSyslogWriter(opts SyslogOptions) (*syslogWriter, error) {
+	if opts.Network == "" {
+		opts.Network = defaultSyslogNetwork
+	}
+	var stream bool
+	switch opts.Network {
+	case "unixgram", "udp":
+	case "unix", "tcp":
+		stream = true
+	default:
+		return nil, fmt.Errorf("unknown syslog network '%s'", opts.Network)
+	}
+	if opts.Address == "" {
+		if !strings.HasPrefix(opts.Network, "unix") {
+			return nil, fmt.Errorf("an address must be provided for syslog over %s", opts.Network)
+		}
+		opts.Address = defaultSyslogAddress
+	}
+	if opts.Facility < 0 || opts.Facility > 23 {
+		return nil, fmt.Errorf("invalid syslog facility %d", opts.Facility)
+	} else if opts.Facility == 0 {
+		opts.Facility = defaultSyslogFacility
+	}
+	if opts.AppName == "" {
+		opts.AppName = filepath.Base(os.Args[0])
+	}
+	if opts.Hostname == "" {
+		opts.Hostname, _ = os.Hostname()
+	}
+	if opts.StructuredDataID == "" {
+		opts.StructuredDataID = defaultSyslogSDID
+	}
+	if opts.WriteTimeout <= 0 {
+		opts.WriteTimeout = defaultSyslogWriteTimeout
+	}
+
+	w := &syslogWriter{
+		network:  opts.Network,
+		address:  opts.Address,
+		stream:   stream,
+		timeout:  opts.WriteTimeout,
+		facility: opts.Facility,
+		header: strings.Join([]string{
+			syslogHeaderField(opts.Hostname, 255),
+			syslogHeaderField(opts.AppName, 48),
+			strconv.Itoa(os.Getpid()),
+			"-", // MSGID
+		}, " "),
+		sdID: syslogName(opts.StructuredDataID),
+	}
+
+	// fail early if the server can't be reached
+	if err := w.connect(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *syslogWriter) connect() error {
+	conn, err := net.DialTimeout(w.network, w.address, w.timeout)
+	if err != nil {
+		return fmt.Errorf("unable to connect to syslog server %s: %v", w.address, err)
+	}
+	w.conn = conn
+	return nil
+}
+
+// write sends a message, reconnecting once if the connection failed. Each write has a deadline, so that a
+// server that stopped reading doesn't block the callers of the scopes, and a write that timed out reconnects
+// like other failures, since part of a framed message may have been sent.
+func (w *syslogWriter) write(msg []byte) error {
+	if w.stream {
+		// octet counting framing
+		msg = append([]byte(strconv.Itoa(len(msg))+" "), msg...)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if w.conn == nil {
+			if err = w.connect(); err != nil {
+				continue
+			}
+		}
+		if err = w.conn.SetWriteDeadline(time.Now().Add(w.timeout)); err == nil {
+			_, err = w.conn.Write(msg)
+		}
+		if err == nil {
+			return nil
+		}
+		_ = w.conn.Close()
+		w.conn = nil
+	}
+	return fmt.Errorf("failed to write log to syslog server %s: %v", w.address, err)
+}
+
+func (w *syslogWriter) close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
+
+// format renders an entry as an RFC 5424 message. The scope, labels, error details and trace context
+// of the entry are recorded as parameters of a single structured data element.
+func (w *syslogWriter) format(entry zapcore.Entry, with, fields []zapcore.Field) []byte {
+	scope, msg, attrs, tc := structuredEntry(entry, with, fields)
+	if tc != nil {
+		attrs[traceIDKey] = tc.TraceID
+		attrs[spanIDKey] = tc.SpanID
+	}
+	if entry.Caller.Defined {
+		attrs["caller"] = entry.Caller.TrimmedPath()
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "<%d>1 %s %s [%s scope=\"", w.facility*8+syslogSeverityMapping[entry.Level],
+		entry.Time.UTC().Format("2006-01-02T15:04:05.000000Z07:00"), w.header, w.sdID)
+	writeSyslogParamValue(&b, scope)
+	b.WriteByte('"')
+
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		b.WriteByte(' ')
+		b.WriteString(syslogName(k))
+		b.WriteString(`="`)
+		writeSyslogParamValue(&b, fmt.Sprint(attrs[k]))
+		b.WriteByte('"')
+	}
+
+	b.WriteString("] ")
+	b.WriteString(msg)
+	if entry.Stack != "" {
+		b.WriteByte('\n')
+		b.WriteString(entry.Stack)
+	}
+	return b.Bytes()
+}
+
+// syslogHeaderField replaces the characters not allowed in a header field, and truncates it to max.
+func syslogHeaderField(s string, max int) string {
+	if s == "" {
+		return "-"
+	}
+	b := []byte(s)
+	for i, c := range b {
+		if c < 33 || c > 126 {
+			b[i] = '_'
+		}
+	}
+	if len(b) > max {
+		b = b[:max]
+	}
+	return string(b)
+}
+
+// syslogName replaces the characters not allowed in a structured data ID or parameter name, and
+// truncates it to 32 characters.
+func syslogName(s string) string {
+	b := []byte(syslogHeaderField(s, 32))
+	for i, c := range b {
+		if c == '=' || c == ']' || c == '"' {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
+
+// writeSyslogParamValue writes a parameter value, escaping the characters that must be escaped.
+func writeSyslogParamValue(b *bytes.Buffer, v string) {
+	for i := 0; i < len(v); i++ {
+		switch v[i] {
+		case '"', '\\', ']':
+			b.WriteByte('\\')
+		}
+		b.WriteByte(v[i])
+	}
+}
+
+// A syslogCore writes entries to a syslog server.
+type syslogCore struct {
+	writer       *syslogWriter
+	minimumLevel zapcore.Level
+	fields       []zapcore.Field
+}
+
+// teeToSyslog returns a zapcore.Core that writes entries to both the provided core and to a syslog server.
+func teeToSyslog(baseCore zapcore.Core, writer *syslogWriter) zapcore.Core {
+	sc := &syslogCore{writer: writer}
+	for l := zapcore.DebugLevel; l <= zapcore.FatalLevel; l++ {
+		if baseCore.Enabled(l) {
+			sc.minimumLevel = l
+			break
+		}
+	}
+	return zapcore.NewTee(baseCore, sc)
+}
+
+// Enabled implements zapcore.Core.
+func (sc *syslogCore) Enabled(l zapcore.Level) bool {
+	return l >= sc.minimumLevel
+}
+
+// With implements zapcore.Core.
+func (sc *syslogCore) With(fields []zapcore.Field) zapcore.Core {
+	return &syslogCore{
+		writer:       sc.writer,
+		minimumLevel: sc.minimumLevel,
+		fields:       append(sc.fields[:len(sc.fields):len(sc.fields)], fields...),
+	}
+}
+
+// Check implements zapcore.Core.
+func (sc *syslogCore) Check(e zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if sc.Enabled(e.Level) {
+		return ce.AddCore(e, sc)
+	}
+	return ce
+}
+
+// Sync implements zapcore.Core. Messages are written as they are logged, so there is nothing to flush.
+func (sc *syslogCore) Sync() error {
+	return nil
+}
+
+// Write implements zapcore.Core. It writes a log entry to the syslog server.
+func (sc *syslogCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	return sc.writer.write(sc.writer.format(entry, sc.fields, fields))
+}
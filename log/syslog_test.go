@@ -0,0 +1,275 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"istio.io/pkg/structured"
+)
+
+func logToSyslog(t *testing.T, cfg SyslogOptions) {
+	t.Helper()
+	resetGlobals()
+	s := RegisterScope("testSyslog", "")
+	o := DefaultOptions()
+	o.WithTeeToSyslog(cfg)
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got %v, expecting success", err)
+	}
+	defer func() {
+		_ = Close()
+		resetGlobals()
+		_ = Configure(DefaultOptions())
+	}()
+
+	s.WithLabels("k", `a "quoted" ]value\`, "bad key=", 3).
+		WithContext(ContextWithTraceparent(context.Background(), testTraceparent)).Warn("hello")
+	s.Errorf(&structured.Error{MoreInfo: "more", Err: errors.New("boom")}, "failed")
+}
+
+// readPackets returns the messages received on a datagram socket until n were read.
+func readPackets(t *testing.T, conn net.PacketConn, n int) []string {
+	t.Helper()
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var out []string
+	buf := make([]byte, 65536)
+	for len(out) < n {
+		l, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("Got %v after %d messages, expecting %d", err, len(out), n)
+		}
+		out = append(out, string(buf[:l]))
+	}
+	return out
+}
+
+func checkSyslogMessages(t *testing.T, msgs []string) {
+	t.Helper()
+	header := regexp.MustCompile(`^<(\d+)>1 \d{4}-\d\d-\d\dT\d\d:\d\d:\d\d\.\d{6}Z myhost app ` + `\d+ - \[istio@32473 scope="testSyslog" `)
+
+	m := header.FindStringSubmatch(msgs[0])
+	if m == nil {
+		t.Fatalf("Got %q, expecting an RFC 5424 message", msgs[0])
+	}
+	if pri, _ := strconv.Atoi(m[1]); pri != 16*8+4 {
+		t.Errorf("Got priority %d, expecting local0.warning", pri)
+	}
+	for _, want := range []string{
+		`bad_key_="3"`,
+		`k="a \"quoted\" \]value\\"`,
+		`trace_id="` + testTraceID + `"`,
+		`span_id="` + testSpanID + `"`,
+	} {
+		if !strings.Contains(msgs[0], want) {
+			t.Errorf("Got %q, expecting it to contain %s", msgs[0], want)
+		}
+	}
+	if !strings.HasSuffix(msgs[0], "] hello") {
+		t.Errorf("Got %q, expecting message hello", msgs[0])
+	}
+
+	if !strings.HasPrefix(msgs[1], "<131>1 ") || !strings.Contains(msgs[1], `err="boom"`) ||
+		!strings.Contains(msgs[1], `moreInfo="more"`) || !strings.HasSuffix(msgs[1], "] failed") {
+		t.Errorf("Got %q, expecting error message with details", msgs[1])
+	}
+}
+
+var testSyslogOptions = SyslogOptions{Facility: 16, AppName: "app", Hostname: "myhost"}
+
+func TestSyslogUnixgram(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log.sock")
+	conn, err := net.ListenPacket("unixgram", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	cfg := testSyslogOptions
+	cfg.Address = path
+	logToSyslog(t, cfg)
+	checkSyslogMessages(t, readPackets(t, conn, 2))
+}
+
+func TestSyslogUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	cfg := testSyslogOptions
+	cfg.Network = "udp"
+	cfg.Address = conn.LocalAddr().String()
+	logToSyslog(t, cfg)
+	checkSyslogMessages(t, readPackets(t, conn, 2))
+}
+
+func TestSyslogTCP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	msgs := make(chan []string, 1)
+	go func() {
+		var out []string
+		defer func() { msgs <- out }()
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for {
+			// octet counting framing
+			size, err := r.ReadString(' ')
+			if err != nil {
+				return
+			}
+			n, err := strconv.Atoi(strings.TrimSuffix(size, " "))
+			if err != nil {
+				return
+			}
+			buf := make([]byte, n)
+			if _, err := io.ReadFull(r, buf); err != nil {
+				return
+			}
+			out = append(out, string(buf))
+		}
+	}()
+
+	cfg := testSyslogOptions
+	cfg.Network = "tcp"
+	cfg.Address = l.Addr().String()
+	logToSyslog(t, cfg)
+
+	got := <-msgs
+	if len(got) != 2 {
+		t.Fatalf("Got %q, expecting 2 messages", got)
+	}
+	checkSyslogMessages(t, got)
+}
+
+func TestSyslogBadOptions(t *testing.T) {
+	defer func() { _ = Configure(DefaultOptions()) }()
+	cases := []struct {
+		cfg  SyslogOptions
+		want string
+	}{
+		{SyslogOptions{Network: "sctp"}, "unknown syslog network"},
+		{SyslogOptions{Network: "udp"}, "an address must be provided"},
+		{SyslogOptions{Address: "/x", Facility: 24}, "invalid syslog facility"},
+		{SyslogOptions{Network: "unix", Address: filepath.Join(t.TempDir(), "missing.sock")}, "unable to connect to syslog server"},
+	}
+	for _, c := range cases {
+		o := DefaultOptions()
+		o.WithTeeToSyslog(c.cfg)
+		if err := Configure(o); err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("Got %v for %+v, expecting %s", err, c.cfg, c.want)
+		}
+	}
+}
+
+func TestSyslogWriteTimeout(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	// the server accepts a single connection, and never reads from it
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err == nil {
+			accepted <- conn
+		}
+		_ = l.Close()
+	}()
+
+	w, err := newSyslogWriter(SyslogOptions{Network: "tcp", Address: l.Addr().String(), WriteTimeout: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Got %v, expecting success", err)
+	}
+	defer w.close()
+	defer func() { (<-accepted).Close() }()
+
+	// writes succeed until the buffers of the connection are full
+	msg := make([]byte, 1<<20)
+	var d time.Duration
+	for i := 0; i < 1000 && err == nil; i++ {
+		start := time.Now()
+		err = w.write(msg)
+		d = time.Since(start)
+	}
+	// the write timed out, and the connection could not be reopened
+	if err == nil || !strings.Contains(err.Error(), "unable to connect") {
+		t.Errorf("Got %v, expecting the write to time out and reconnect", err)
+	}
+	if d > 2*time.Second {
+		t.Errorf("Got a write blocked for %v, expecting the timeout to bound it", d)
+	}
+}
+
+func TestSyslogClosedOnReconfigure(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	closed := make(chan error, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			closed <- err
+			return
+		}
+		defer conn.Close()
+		_, err = io.Copy(io.Discard, conn)
+		closed <- err
+	}()
+
+	defer func() { _ = Configure(DefaultOptions()) }()
+	cfg := testSyslogOptions
+	cfg.Network = "tcp"
+	cfg.Address = l.Addr().String()
+	if err := Configure(DefaultOptions().WithTeeToSyslog(cfg)); err != nil {
+		t.Fatalf("Got %v, expecting success", err)
+	}
+
+	// replacing the configuration closes the connection to the server
+	if err := Configure(DefaultOptions()); err != nil {
+		t.Fatalf("Got %v, expecting success", err)
+	}
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Errorf("Got %v, expecting the connection to be closed", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Expecting the connection to be closed")
+	}
+}
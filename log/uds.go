@@ -19,40 +19,275 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"sync"
 	"time"
 
-	"go.uber.org/zap/buffer"
 	"go.uber.org/zap/zapcore"
 )
 
-// An udsCore write entries to an UDS server with HTTP Post. Log messages will be encoded into a JSON array.
+// DropPolicy selects which messages are discarded when a queue of log messages is full.
+type DropPolicy int
+
+const (
+	// DropNewest discards the messages that do not fit in the queue.
+	DropNewest DropPolicy = iota
+	// DropOldest discards the oldest queued messages to make room for new ones.
+	DropOldest
+)
+
+const (
+	defaultUDSQueueSize      = 1000
+	defaultUDSBatchSize      = 100
+	defaultUDSFlushInterval  = time.Second
+	defaultUDSTimeout        = 100 * time.Millisecond
+	defaultUDSMaxRetries     = 3
+	defaultUDSInitialBackoff = 100 * time.Millisecond
+	defaultUDSMaxBackoff     = 2 * time.Second
+)
+
+// UDSOptions tunes the delivery of logs to a server over UDS. Zero values select the defaults.
+type UDSOptions struct {
+	// QueueSize is the number of messages held while waiting to be sent. It defaults to 1000.
+	QueueSize int
+
+	// DropPolicy selects the messages discarded when the queue is full. It defaults to DropNewest.
+	DropPolicy DropPolicy
+
+	// BatchSize is the largest number of messages sent in a single request, and the number of queued
+	// messages that triggers a request before FlushInterval elapses. It defaults to 100.
+	BatchSize int
+
+	// FlushInterval is the longest time a message waits before being sent. It defaults to 1s.
+	FlushInterval time.Duration
+
+	// Timeout bounds each request. It defaults to 100ms.
+	Timeout time.Duration
+
+	// MaxRetries is the number of times a failed request is retried before its messages are
+	// discarded. It defaults to 3, and a negative value disables retries.
+	MaxRetries int
+
+	// InitialBackoff is the delay before the first retry, doubling for each further retry up to
+	// MaxBackoff. They default to 100ms and 2s.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+func (o UDSOptions) withDefaults() UDSOptions {
+	if o.QueueSize <= 0 {
+		o.QueueSize = defaultUDSQueueSize
+	}
+	if o.BatchSize <= 0 {
+		o.BatchSize = defaultUDSBatchSize
+	}
+	if o.FlushInterval <= 0 {
+		o.FlushInterval = defaultUDSFlushInterval
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = defaultUDSTimeout
+	}
+	if o.MaxRetries == 0 {
+		o.MaxRetries = defaultUDSMaxRetries
+	} else if o.MaxRetries < 0 {
+		o.MaxRetries = 0
+	}
+	if o.InitialBackoff <= 0 {
+		o.InitialBackoff = defaultUDSInitialBackoff
+	}
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = defaultUDSMaxBackoff
+	}
+	return o
+}
+
+// udsSender queues messages and sends them in batches to an UDS server with HTTP Post, shared by all
+// cores of a configuration. Each batch is encoded into a JSON array.
+type udsSender struct {
+	client http.Client
+	url    string
+	opts   UDSOptions
+
+	mu    sync.Mutex
+	queue []string
+
+	// sendMu serializes requests so messages are delivered in order.
+	sendMu sync.Mutex
+	kick   chan struct{}
+	done   chan struct{}
+	wg     sync.WaitGroup
+	// closeOnce guards against Close being called more than once.
+	closeOnce sync.Once
+}
+
+func newUDSSender(address, path string, opts UDSOptions) *udsSender {
+	opts = opts.withDefaults()
+	s := &udsSender{
+		client: http.Client{
+			Transport: &http.Transport{
+				DialContext: func(_ context.Context, _, _ string) (net.Conn, error) {
+					return net.Dial("unix", address)
+				},
+			},
+			Timeout: opts.Timeout,
+		},
+		url:  "http://unix" + path,
+		opts: opts,
+		kick: make(chan struct{}, 1),
+		done: make(chan struct{}),
+	}
+
+	s.wg.Add(1)
+	go s.run()
+
+	return s
+}
+
+func (s *udsSender) run() {
+	defer s.wg.Done()
+
+	t := time.NewTicker(s.opts.FlushInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+		case <-s.kick:
+		case <-s.done:
+			return
+		}
+		// failures are recorded in the metrics
+		_ = s.flush()
+	}
+}
+
+// enqueue adds a message to the queue, applying the drop policy if it is full.
+func (s *udsSender) enqueue(msg string) {
+	s.mu.Lock()
+	if len(s.queue) >= s.opts.QueueSize {
+		if s.opts.DropPolicy == DropNewest {
+			s.mu.Unlock()
+			udsMessagesDropped.Increment()
+			return
+		}
+		s.queue = s.queue[1:]
+		udsMessagesDropped.Increment()
+	}
+	s.queue = append(s.queue, msg)
+	full := len(s.queue) >= s.opts.BatchSize
+	s.mu.Unlock()
+
+	if full {
+		select {
+		case s.kick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// flush sends all queued messages, reporting the first batch that could not be delivered.
+func (s *udsSender) flush() error {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+
+	var err error
+	for {
+		s.mu.Lock()
+		n := len(s.queue)
+		if n > s.opts.BatchSize {
+			n = s.opts.BatchSize
+		}
+		batch := s.queue[:n:n]
+		s.queue = s.queue[n:]
+		s.mu.Unlock()
+
+		if len(batch) == 0 {
+			return err
+		}
+		if serr := s.sendWithRetry(batch); serr != nil && err == nil {
+			err = serr
+		}
+	}
+}
+
+func (s *udsSender) closed() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// sendWithRetry sends a batch, retrying with exponential backoff. Retries stop early once the sender is closed.
+func (s *udsSender) sendWithRetry(batch []string) error {
+	msg, err := json.Marshal(batch)
+	if err != nil {
+		udsBatchesFailed.Increment()
+		return fmt.Errorf("failed to sync uds log: %v", err)
+	}
+
+	backoff := s.opts.InitialBackoff
+	for attempt := 0; ; attempt++ {
+		if err = s.send(msg); err == nil {
+			udsBatchesSent.Increment()
+			return nil
+		}
+		if attempt >= s.opts.MaxRetries || s.closed() {
+			break
+		}
+
+		t := time.NewTimer(backoff)
+		select {
+		case <-t.C:
+		case <-s.done:
+			t.Stop()
+		}
+		if backoff *= 2; backoff > s.opts.MaxBackoff {
+			backoff = s.opts.MaxBackoff
+		}
+	}
+
+	udsBatchesFailed.Increment()
+	return err
+}
+
+func (s *udsSender) send(msg []byte) error {
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(msg))
+	if err != nil {
+		return fmt.Errorf("failed to send logs to uds server %v: %v", s.url, err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("uds server returns non-ok status %v: %v", s.url, resp.Status)
+	}
+	return nil
+}
+
+// close stops the background flushing and makes a final attempt to send queued messages.
+func (s *udsSender) close() error {
+	s.closeOnce.Do(func() { close(s.done) })
+	s.wg.Wait()
+	err := s.flush()
+	s.client.CloseIdleConnections()
+	return err
+}
+
+// An udsCore writes entries to an UDS server through a udsSender.
 type udsCore struct {
-	client       http.Client
+	sender       *udsSender
 	minimumLevel zapcore.Level
-	url          string
 	enc          zapcore.Encoder
-	buffers      []*buffer.Buffer
-	mu           sync.Mutex
 }
 
 // teeToUDSServer returns a zapcore.Core that writes entries to both the provided core and to an uds server.
-func teeToUDSServer(baseCore zapcore.Core, address, path string) zapcore.Core {
-	c := http.Client{
-		Transport: &http.Transport{
-			DialContext: func(_ context.Context, _, _ string) (net.Conn, error) {
-				return net.Dial("unix", address)
-			},
-		},
-		Timeout: 100 * time.Millisecond,
-	}
+func teeToUDSServer(baseCore zapcore.Core, sender *udsSender) zapcore.Core {
 	uc := &udsCore{
-		client:  c,
-		url:     "http://unix" + path,
-		enc:     zapcore.NewJSONEncoder(defaultEncoderConfig),
-		buffers: make([]*buffer.Buffer, 0),
+		sender: sender,
+		enc:    zapcore.NewJSONEncoder(defaultEncoderConfig),
 	}
 	for l := zapcore.DebugLevel; l <= zapcore.FatalLevel; l++ {
 		if baseCore.Enabled(l) {
@@ -70,9 +305,14 @@ func (u *udsCore) Enabled(l zapcore.Level) bool {
 
 // With implements zapcore.Core.
 func (u *udsCore) With(fields []zapcore.Field) zapcore.Core {
+	enc := u.enc.Clone()
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
 	return &udsCore{
-		client:       u.client,
+		sender:       u.sender,
 		minimumLevel: u.minimumLevel,
+		enc:          enc,
 	}
 }
 
@@ -84,44 +324,18 @@ func (u *udsCore) Check(e zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.Chec
 	return ce
 }
 
-// Sync implements zapcore.Core. It sends log messages with HTTP POST.
+// Sync implements zapcore.Core. It sends all queued log messages.
 func (u *udsCore) Sync() error {
-	logs := u.logsFromBuffer()
-	msg, err := json.Marshal(logs)
-	if err != nil {
-		return fmt.Errorf("failed to sync uds log: %v", err)
-	}
-	resp, err := u.client.Post(u.url, "application/json", bytes.NewReader(msg))
-	if err != nil {
-		return fmt.Errorf("failed to send logs to uds server %v: %v", u.url, err)
-	}
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("uds server returns non-ok status %v: %v", u.url, resp.Status)
-	}
-	return nil
+	return u.sender.flush()
 }
 
-// Write implements zapcore.Core. Log messages will be temporarily buffered and sent to
-// UDS server asyncrhonously.
+// Write implements zapcore.Core. Log messages are queued and sent to the UDS server asynchronously.
 func (u *udsCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
 	buffer, err := u.enc.EncodeEntry(entry, fields)
 	if err != nil {
 		return fmt.Errorf("failed to write log to uds logger: %v", err)
 	}
-	u.mu.Lock()
-	u.buffers = append(u.buffers, buffer)
-	u.mu.Unlock()
+	u.sender.enqueue(buffer.String())
+	buffer.Free()
 	return nil
 }
-
-func (u *udsCore) logsFromBuffer() []string {
-	u.mu.Lock()
-	defer u.mu.Unlock()
-	logs := make([]string, 0, len(u.buffers))
-	for _, b := range u.buffers {
-		logs = append(logs, b.String())
-		b.Free()
-	}
-	u.buffers = make([]*buffer.Buffer, 0)
-	return logs
-}
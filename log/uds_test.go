@@ -21,7 +21,11 @@ import (
 	"net/http"
 	"path/filepath"
 	"reflect"
+	"sync"
 	"testing"
+	"time"
+
+	"go.opencensus.io/stats/view"
 )
 
 type udsServer struct {
@@ -99,3 +103,176 @@ func TestUDSLog(t *testing.T) {
 		t.Fatalf("number received log messages got %v want %v", got, want)
 	}
 }
+
+// sumValue returns the current value of an unlabeled sum metric.
+func sumValue(t *testing.T, name string) float64 {
+	t.Helper()
+	rows, err := view.RetrieveData(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) == 0 {
+		return 0
+	}
+	return rows[0].Data.(*view.SumData).Value
+}
+
+// flakyUDSServer fails the first requests it receives, then records the messages of later ones.
+type flakyUDSServer struct {
+	mu       sync.Mutex
+	failures int
+	messages []string
+}
+
+func (fs *flakyUDSServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.failures > 0 {
+		fs.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	messages := []string{}
+	body, _ := io.ReadAll(r.Body)
+	if err := json.Unmarshal(body, &messages); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	fs.messages = append(fs.messages, messages...)
+}
+
+func (fs *flakyUDSServer) received() int {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return len(fs.messages)
+}
+
+func startUDSServer(t *testing.T, h http.Handler) string {
+	t.Helper()
+	socketPath := filepath.Join(t.TempDir(), "test.sock")
+	l, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("failed to create uds listener: %v", err)
+	}
+	srv := &http.Server{Handler: h}
+	go func() { _ = srv.Serve(l) }()
+	t.Cleanup(func() { _ = srv.Close() })
+	return socketPath
+}
+
+func TestUDSRetry(t *testing.T) {
+	fs := &flakyUDSServer{failures: 2}
+	s := newUDSSender(startUDSServer(t, fs), "/", UDSOptions{
+		FlushInterval:  time.Hour,
+		InitialBackoff: time.Millisecond,
+	})
+	defer s.close()
+
+	sent, failed := sumValue(t, "log_uds_batches_sent_total"), sumValue(t, "log_uds_batches_failed_total")
+	s.enqueue("one")
+	s.enqueue("two")
+	if err := s.flush(); err != nil {
+		t.Fatalf("Got %v, expecting the batch to be retried until it succeeds", err)
+	}
+	if got := fs.received(); got != 2 {
+		t.Errorf("Got %d messages, expecting 2", got)
+	}
+	if got := sumValue(t, "log_uds_batches_sent_total") - sent; got != 1 {
+		t.Errorf("Got %v sent batches, expecting 1", got)
+	}
+
+	// batches are discarded once the retries are exhausted
+	fs.mu.Lock()
+	fs.failures = 10
+	fs.mu.Unlock()
+	s.enqueue("three")
+	if err := s.flush(); err == nil {
+		t.Error("Expecting the batch to fail")
+	}
+	if got := sumValue(t, "log_uds_batches_failed_total") - failed; got != 1 {
+		t.Errorf("Got %v failed batches, expecting 1", got)
+	}
+	if err := s.flush(); err != nil || fs.received() != 2 {
+		t.Errorf("Got %v, %d messages, expecting the failed batch to be discarded", err, fs.received())
+	}
+}
+
+func TestUDSBatching(t *testing.T) {
+	fs := &flakyUDSServer{}
+	s := newUDSSender(startUDSServer(t, fs), "/", UDSOptions{
+		BatchSize:     2,
+		FlushInterval: 10 * time.Millisecond,
+	})
+	defer s.close()
+
+	// messages are sent in the background, without waiting for Sync
+	for _, m := range []string{"a", "b", "c"} {
+		s.enqueue(m)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for fs.received() != 3 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if !reflect.DeepEqual(fs.messages, []string{"a", "b", "c"}) {
+		t.Errorf("Got %v, expecting messages to be sent in order", fs.messages)
+	}
+}
+
+func TestUDSDropPolicy(t *testing.T) {
+	for _, tc := range []struct {
+		policy DropPolicy
+		want   []string
+	}{
+		{DropNewest, []string{"a", "b"}},
+		{DropOldest, []string{"c", "d"}},
+	} {
+		// no server is listening, so nothing leaves the queue
+		s := newUDSSender(filepath.Join(t.TempDir(), "missing.sock"), "/", UDSOptions{
+			QueueSize:     2,
+			DropPolicy:    tc.policy,
+			FlushInterval: time.Hour,
+			MaxRetries:    -1,
+		})
+		dropped := sumValue(t, "log_uds_messages_dropped_total")
+		for _, m := range []string{"a", "b", "c", "d"} {
+			s.enqueue(m)
+		}
+		s.mu.Lock()
+		got := append([]string(nil), s.queue...)
+		s.mu.Unlock()
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("Got %v for policy %v, expecting %v", got, tc.policy, tc.want)
+		}
+		if d := sumValue(t, "log_uds_messages_dropped_total") - dropped; d != 2 {
+			t.Errorf("Got %v dropped messages, expecting 2", d)
+		}
+		if err := s.close(); err == nil {
+			t.Error("Expecting the final flush to fail")
+		}
+		_ = s.close()
+	}
+}
+
+func TestUDSClosedOnReconfigure(t *testing.T) {
+	fs := &flakyUDSServer{}
+	resetGlobals()
+	defer func() {
+		resetGlobals()
+		_ = Configure(DefaultOptions())
+	}()
+	o := DefaultOptions().WithTeeToUDSWithOptions(startUDSServer(t, fs), "/", UDSOptions{FlushInterval: time.Hour})
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got %v, expecting success", err)
+	}
+	Info("pending")
+
+	// replacing the configuration closes the sender, which sends the queued messages
+	if err := Configure(DefaultOptions()); err != nil {
+		t.Fatalf("Got %v, expecting success", err)
+	}
+	if got := fs.received(); got != 1 {
+		t.Errorf("Got %d messages, expecting the queued message to be sent", got)
+	}
+}
@@ -55,7 +55,29 @@ func ZapLogHandlerCallbackFunc(
 	ie *structured.Error,
 	msg string,
 ) {
-	var fields []zapcore.Field
+	if smp := scope.getSampler(); smp != nil && !smp.allow(scope, level, msg) {
+		return
+	}
+	if d := scope.getDeduper(); d != nil && !d.allow(level, scope, ie, msg) {
+		return
+	}
+	writeRecord(level, scope, ie, msg)
+}
+
+// writeRecord counts, redacts and formats a message that passed sampling and deduplication, and emits it.
+func writeRecord(
+	level Level,
+	scope *Scope,
+	ie *structured.Error,
+	msg string,
+) {
+	scope.countEntry(level, ie)
+	if scope.GetRedaction() {
+		scope, ie, msg = getRedactor().redactRecord(scope, ie, msg)
+	}
+
+	// the original message, labels and error details ride along for sinks that record them natively
+	fields := []zapcore.Field{recordField(scope, ie, msg)}
 	if useJSON.Load().(bool) {
 		if ie != nil {
 			fields = appendNotEmptyField(fields, "message", msg)
@@ -75,10 +97,13 @@ func ZapLogHandlerCallbackFunc(
 				Interface: v,
 			})
 		}
+		if scope.trace != nil {
+			fields = traceFields(fields, scope.trace)
+		}
 	} else {
 		sb := &strings.Builder{}
 		sb.WriteString(msg)
-		if ie != nil || len(scope.labelKeys) > 0 {
+		if ie != nil || len(scope.labelKeys) > 0 || scope.trace != nil {
 			sb.WriteString("\t")
 		}
 		if ie != nil {
@@ -96,11 +121,91 @@ func ZapLogHandlerCallbackFunc(
 			sb.WriteString(fmt.Sprintf("%s=%v", k, scope.labels[k]))
 			space = true
 		}
+		if scope.trace != nil {
+			if space {
+				sb.WriteString(" ")
+			}
+			sb.WriteString(fmt.Sprintf("%s=%s %s=%s", traceIDKey, scope.trace.TraceID, spanIDKey, scope.trace.SpanID))
+		}
 		msg = sb.String()
 	}
 	emit(scope, toZapLevel[level], msg, fields)
 }
 
+// record holds the parts of a log message before they are flattened for the console or JSON encoders.
+type record struct {
+	scope *Scope
+	ie    *structured.Error
+	msg   string
+}
+
+// recordField wraps a record in a field that is ignored by encoders.
+func recordField(scope *Scope, ie *structured.Error, msg string) zapcore.Field {
+	return zapcore.Field{Type: zapcore.SkipType, Interface: &record{scope: scope, ie: ie, msg: msg}}
+}
+
+// findRecord returns the record carried by fields, if any.
+func findRecord(fields []zapcore.Field) *record {
+	for _, f := range fields {
+		if f.Type == zapcore.SkipType {
+			if r, ok := f.Interface.(*record); ok {
+				return r
+			}
+		}
+	}
+	return nil
+}
+
+// structuredEntry returns the scope name, message, attributes and trace context of an entry for sinks
+// that record them natively. Fields added to the core with With come first, and are followed by fields.
+func structuredEntry(entry zapcore.Entry, with, fields []zapcore.Field) (string, string, map[string]any, *TraceContext) {
+	enc := zapcore.NewMapObjectEncoder()
+	for _, f := range with {
+		f.AddTo(enc)
+	}
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+	attrs := enc.Fields
+
+	scope := entry.LoggerName
+	msg := entry.Message
+	var tc *TraceContext
+	if r := findRecord(fields); r != nil {
+		// use the unflattened message, labels and error details rather than their encoded forms
+		scope = r.scope.name
+		msg = r.msg
+		delete(attrs, "message")
+		for _, k := range r.scope.labelKeys {
+			attrs[k] = r.scope.labels[k]
+		}
+		if r.ie != nil {
+			setNotEmpty(attrs, "moreInfo", r.ie.MoreInfo)
+			setNotEmpty(attrs, "impact", r.ie.Impact)
+			setNotEmpty(attrs, "action", r.ie.Action)
+			setNotEmpty(attrs, "likelyCause", r.ie.LikelyCause)
+			setNotEmpty(attrs, "err", toErrString(r.ie.Err))
+		}
+		if r.scope.trace != nil {
+			tc = r.scope.trace
+			for _, k := range traceKeys {
+				delete(attrs, k)
+			}
+		}
+	}
+	if scope == "" {
+		scope = DefaultScopeName
+	}
+	return scope, msg, attrs, tc
+}
+
+// setNotEmpty sets key to value in m. If value is empty, it does nothing.
+func setNotEmpty(m map[string]any, key, value string) {
+	if value != "" {
+		m[key] = value
+	}
+}
+
 // appendNotEmptyField appends a field with key:value to fields. If value is empty, it does nothing.
 func appendNotEmptyField(fields []zapcore.Field, key, value string) []zapcore.Field {
 	if key == "" || value == "" {
@@ -119,7 +224,7 @@ func appendNotEmptyString(sb *strings.Builder, key, value string) {
 
 // callerSkipOffset is how many callers to pop off the stack to determine the caller function locality, used for
 // adding file/line number to log output.
-const callerSkipOffset = 4
+const callerSkipOffset = 5
 
 func dumpStack(level zapcore.Level, scope *Scope) bool {
 	thresh := toLevel[level]
@@ -142,7 +247,12 @@ func emit(scope *Scope, level zapcore.Level, msg string, fields []zapcore.Field)
 	}
 
 	if scope.GetLogCallers() {
-		e.Caller = zapcore.NewEntryCaller(runtime.Caller(scope.callerSkip + callerSkipOffset))
+		if scope.callerPC != 0 {
+			f, _ := runtime.CallersFrames([]uintptr{scope.callerPC}).Next()
+			e.Caller = zapcore.NewEntryCaller(f.PC, f.File, f.Line, f.PC != 0)
+		} else {
+			e.Caller = zapcore.NewEntryCaller(runtime.Caller(scope.callerSkip + callerSkipOffset))
+		}
 	}
 
 	if dumpStack(level, scope) {
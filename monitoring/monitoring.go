@@ -18,7 +18,9 @@ import (
 	"context"
 	"fmt"
 	"math"
+	"os"
 	"sync"
+	"sync/atomic"
 
 	"go.opencensus.io/metric"
 	"go.opencensus.io/metric/metricdata"
@@ -26,8 +28,6 @@ import (
 	"go.opencensus.io/stats"
 	"go.opencensus.io/stats/view"
 	"go.opencensus.io/tag"
-
-	"istio.io/pkg/log"
 )
 
 type (
@@ -154,14 +154,44 @@ var (
 	recordHookMutex sync.RWMutex
 
 	derivedRegistry = metric.NewRegistry()
+
+	// logFuncs reports the failures of derived metrics, see SetLogFuncs
+	logFuncs atomic.Pointer[loggers]
 )
 
+type loggers struct {
+	warnf, errorf func(format string, args ...any)
+}
+
 func init() {
 	recordHooks = make(map[string]RecordHook)
 	// ensures exporters can see any derived metrics
 	metricproducer.GlobalManager().AddProducer(derivedRegistry)
 }
 
+// SetLogFuncs sets the functions reporting the failures of derived metrics, which are written to stderr
+// until then. The istio.io/pkg/log package sets them to log through its default scope, as it records
+// metrics itself and can't be imported by this package.
+func SetLogFuncs(warnf, errorf func(format string, args ...any)) {
+	logFuncs.Store(&loggers{warnf: warnf, errorf: errorf})
+}
+
+func warnf(format string, args ...any) {
+	if l := logFuncs.Load(); l != nil {
+		l.warnf(format, args...)
+		return
+	}
+	_, _ = fmt.Fprintf(os.Stderr, "warn\t"+format+"\n", args...)
+}
+
+func errorf(format string, args ...any) {
+	if l := logFuncs.Load(); l != nil {
+		l.errorf(format, args...)
+		return
+	}
+	_, _ = fmt.Fprintf(os.Stderr, "error\t"+format+"\n", args...)
+}
+
 // RegisterRecordHook adds a RecordHook for a given measure.
 func RegisterRecordHook(name string, h RecordHook) {
 	recordHookMutex.Lock()
@@ -274,7 +304,7 @@ func NewDerivedGauge(name, description string, opts ...DerivedOptions) DerivedMe
 		metric.WithLabelKeys(options.labelKeys...),
 		metric.WithUnit(metricdata.UnitDimensionless)) // TODO: allow unit in options
 	if err != nil {
-		log.Warnf("failed to add metric %q: %v", name, err)
+		warnf("failed to add metric %q: %v", name, err)
 	}
 	derived := &derivedFloat64Metric{
 		base: m,
@@ -318,7 +348,7 @@ func (d *derivedFloat64Metric) Register() error {
 func (d *derivedFloat64Metric) ValueFrom(valueFn func() float64, labelValues ...string) {
 	if len(labelValues) == 0 {
 		if err := d.base.UpsertEntry(valueFn); err != nil {
-			log.Errorf("failed to add value for derived metric %q: %v", d.name, err)
+			errorf("failed to add value for derived metric %q: %v", d.name, err)
 		}
 		return
 	}
@@ -327,7 +357,7 @@ func (d *derivedFloat64Metric) ValueFrom(valueFn func() float64, labelValues ...
 		lv = append(lv, metricdata.NewLabelValue(l))
 	}
 	if err := d.base.UpsertEntry(valueFn, lv...); err != nil {
-		log.Errorf("failed to add value for derived metric %q: %v", d.name, err)
+		errorf("failed to add value for derived metric %q: %v", d.name, err)
 	}
 }
 
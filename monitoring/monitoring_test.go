@@ -250,6 +250,27 @@ func TestDerivedGauge(t *testing.T) {
 	}
 }
 
+func TestDerivedGaugeFailureLogged(t *testing.T) {
+	var mu sync.Mutex
+	var logged []string
+	logf := func(format string, args ...any) {
+		mu.Lock()
+		defer mu.Unlock()
+		logged = append(logged, fmt.Sprintf(format, args...))
+	}
+	monitoring.SetLogFuncs(logf, logf)
+
+	gauge := monitoring.NewDerivedGauge("test_derived_gauge_failure", "Testing failures of derived gauges",
+		monitoring.WithLabelKeys("blah"))
+	gauge.ValueFrom(func() float64 { return 1 }, "too", "many")
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(logged) != 1 || !strings.Contains(logged[0], `failed to add value for derived metric "test_derived_gauge_failure"`) {
+		t.Errorf("Got %q, expecting an error about the label values", logged)
+	}
+}
+
 func TestDerivedGaugeWithLabels(t *testing.T) {
 	testDerivedGauge := monitoring.NewDerivedGauge(
 		"test_derived_gauge",